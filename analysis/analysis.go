@@ -0,0 +1,138 @@
+// go-ungrammar: static analysis of grammars.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+// Package analysis implements static analyses of Ungrammar grammars that
+// matter when a grammar drives a parser: detecting left recursion and
+// non-productive rules, and computing the lookahead sets (nullable, FIRST
+// and FOLLOW) and LL(1) conflicts of rules.
+//
+// References to undefined rules are ignored by the analyses (they are
+// reported by Grammar.Validate); such rules are treated as if they derived a
+// non-empty token sequence.
+package analysis
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/eliben/go-ungrammar"
+)
+
+// Diagnostic codes of problems reported by Check.
+const (
+	CodeLeftRecursion ungrammar.Code = "left-recursion"
+	CodeNonProductive ungrammar.Code = "non-productive"
+)
+
+// Cycle is a cycle of references between rules: Rules[i] refers to
+// Rules[i+1], and the last rule refers back to Rules[0]. A cycle of length 1
+// is a rule referring to itself.
+type Cycle struct {
+	Rules []string
+
+	// Refs[i] is the reference to the rule following Rules[i] in the cycle,
+	// found in the definition of Rules[i].
+	Refs []*ungrammar.Node
+}
+
+// String returns the path of the cycle, e.g. "Expr -> BinExpr -> Expr".
+func (c Cycle) String() string {
+	return strings.Join(slices.Concat(c.Rules, c.Rules[:1]), " -> ")
+}
+
+// IsDirect reports whether the cycle is a rule referring to itself.
+func (c Cycle) IsDirect() bool {
+	return len(c.Rules) == 1
+}
+
+// Check runs the analyses of this package that find problems in g and
+// returns them as diagnostics:
+//
+//   - Left-recursive cycles (see LeftRecursion) are reported as warnings with
+//     CodeLeftRecursion, since only some parsers can't handle them.
+//   - Non-productive rules (see NonProductive) are reported as errors with
+//     CodeNonProductive.
+//
+// Each diagnostic is reported at the first reference of a cycle, with the
+// other references of the cycle as related locations.
+func Check(g *ungrammar.Grammar) ungrammar.ErrorList {
+	var errs ungrammar.ErrorList
+	for _, c := range LeftRecursion(g) {
+		kind := "indirectly"
+		if c.IsDirect() {
+			kind = "directly"
+		}
+		errs.Add(cycleDiagnostic(c, ungrammar.SeverityWarning, CodeLeftRecursion,
+			fmt.Sprintf("rule %s is %s left-recursive: %s", c.Rules[0], kind, c)))
+	}
+
+	onCycle := make(map[string]bool)
+	for _, c := range NonProductive(g) {
+		for _, name := range c.Rules {
+			onCycle[name] = true
+		}
+		errs.Add(cycleDiagnostic(c, ungrammar.SeverityError, CodeNonProductive,
+			fmt.Sprintf("rule %s can only derive itself: %s", c.Rules[0], c)))
+	}
+
+	// Rules that aren't on a non-productive cycle themselves, but depend on one.
+	np := nonProductiveRules(g)
+	for _, name := range g.OrderedNames() {
+		if !np[name] || onCycle[name] {
+			continue
+		}
+		ref := firstRef(g.Rules[name], np)
+		errs.Add(&ungrammar.Diagnostic{
+			Severity: ungrammar.SeverityError,
+			Code:     CodeNonProductive,
+			Span:     ref.Span(),
+			Message:  fmt.Sprintf("rule %s is non-productive: it requires non-productive rule %s", name, ref.Name),
+		})
+	}
+	return errs
+}
+
+func cycleDiagnostic(c Cycle, sev ungrammar.Severity, code ungrammar.Code, msg string) *ungrammar.Diagnostic {
+	d := &ungrammar.Diagnostic{
+		Severity: sev,
+		Code:     code,
+		Span:     c.Refs[0].Span(),
+		Message:  msg,
+	}
+	for i := 1; i < len(c.Refs); i++ {
+		d.Related = append(d.Related, ungrammar.Related{
+			Span:    c.Refs[i].Span(),
+			Message: fmt.Sprintf("%s refers to %s here", c.Rules[i], c.Refs[i].Name),
+		})
+	}
+	return d
+}
+
+// firstRef returns the first reference in r to a rule in names, not counting
+// references under '?' or '*'.
+func firstRef(r ungrammar.Rule, names map[string]bool) *ungrammar.Node {
+	switch rr := r.(type) {
+	case *ungrammar.Node:
+		if names[rr.Name] {
+			return rr
+		}
+	case *ungrammar.Labeled:
+		return firstRef(rr.Rule, names)
+	case *ungrammar.Seq:
+		for _, sub := range rr.Rules {
+			if ref := firstRef(sub, names); ref != nil {
+				return ref
+			}
+		}
+	case *ungrammar.Alt:
+		for _, sub := range rr.Rules {
+			if ref := firstRef(sub, names); ref != nil {
+				return ref
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+// go-ungrammar: left recursion and non-productive cycles.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package analysis
+
+import (
+	"slices"
+
+	"github.com/eliben/go-ungrammar"
+)
+
+// LeftRecursion returns the left-recursive cycles of g. A rule is
+// left-recursive if it can derive a sequence starting with itself, either
+// directly:
+//
+//	Expr = Expr '+' Atom | Atom
+//
+// or indirectly, through other rules:
+//
+//	Expr = BinExpr | Atom
+//	BinExpr = lhs:Expr '+' rhs:Expr
+//
+// Rules preceded only by rules that can derive the empty sequence count as
+// leading, so "X = Y? X 'a'" is left-recursive as well.
+//
+// For every left-recursive rule, in the order of g.OrderedNames, the shortest
+// cycle through it is reported, starting at that rule; cycles already
+// reported starting at another rule are skipped.
+func LeftRecursion(g *ungrammar.Grammar) []Cycle {
+	nullable := nullableRules(g)
+	return findCycles(g, func(name string) []*ungrammar.Node {
+		return leftRefs(g.Rules[name], nullable)
+	})
+}
+
+// NonProductive returns the cycles of non-productive rules in g: rules that
+// can't derive any finite sequence of tokens because every alternative they
+// have requires deriving themselves again, like:
+//
+//	A = 'a' B
+//	B = 'b' A
+//
+// Cycles are reported as by LeftRecursion. Rules that aren't on such a cycle
+// but can't be derived without one are non-productive too; Check reports
+// them.
+func NonProductive(g *ungrammar.Grammar) []Cycle {
+	np := nonProductiveRules(g)
+	return findCycles(g, func(name string) []*ungrammar.Node {
+		if !np[name] {
+			return nil
+		}
+		var refs []*ungrammar.Node
+		for _, ref := range requiredRefs(g.Rules[name]) {
+			if np[ref.Name] {
+				refs = append(refs, ref)
+			}
+		}
+		return refs
+	})
+}
+
+// findCycles finds the shortest cycle through each rule of g in the graph
+// whose edges out of each rule are given by edges, and returns the distinct
+// cycles found.
+func findCycles(g *ungrammar.Grammar, edges func(name string) []*ungrammar.Node) []Cycle {
+	names := g.OrderedNames()
+	index := make(map[string]int)
+	for i, name := range names {
+		index[name] = i
+	}
+
+	var cycles []Cycle
+	seen := make(map[string]bool)
+	for _, start := range names {
+		c, ok := shortestCycle(start, edges)
+		if !ok {
+			continue
+		}
+
+		// Identify the cycle by its rotation starting at its earliest rule.
+		first := 0
+		for i, name := range c.Rules {
+			if index[name] < index[c.Rules[first]] {
+				first = i
+			}
+		}
+		rotated := append(slices.Clone(c.Rules[first:]), c.Rules[:first]...)
+		key := Cycle{Rules: rotated}.String()
+		if !seen[key] {
+			seen[key] = true
+			cycles = append(cycles, c)
+		}
+	}
+	return cycles
+}
+
+// shortestCycle finds the shortest cycle from start back to itself with a
+// breadth-first search.
+func shortestCycle(start string, edges func(name string) []*ungrammar.Node) (Cycle, bool) {
+	// via maps each visited rule to the reference it was first reached by.
+	via := make(map[string]*ungrammar.Node)
+	from := make(map[string]string)
+	queue := []string{start}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, ref := range edges(name) {
+			if ref.Name == start {
+				// Reconstruct the path backwards from name.
+				c := Cycle{
+					Rules: []string{name},
+					Refs:  []*ungrammar.Node{ref},
+				}
+				for n := name; n != start; n = from[n] {
+					c.Rules = append(c.Rules, from[n])
+					c.Refs = append(c.Refs, via[n])
+				}
+				slices.Reverse(c.Rules)
+				slices.Reverse(c.Refs)
+				return c, true
+			}
+			if _, ok := via[ref.Name]; !ok {
+				via[ref.Name] = ref
+				from[ref.Name] = name
+				queue = append(queue, ref.Name)
+			}
+		}
+	}
+	return Cycle{}, false
+}
+
+// nullableRules returns the set of rules in g that can derive the empty
+// sequence, computed as a fixed point.
+func nullableRules(g *ungrammar.Grammar) map[string]bool {
+	nullable := make(map[string]bool)
+	for changed := true; changed; {
+		changed = false
+		for name, r := range g.Rules {
+			if !nullable[name] && isNullable(r, nullable) {
+				nullable[name] = true
+				changed = true
+			}
+		}
+	}
+	return nullable
+}
+
+// isNullable reports whether r can derive the empty sequence, given the set
+// of nullable rules.
+func isNullable(r ungrammar.Rule, nullable map[string]bool) bool {
+	switch rr := r.(type) {
+	case *ungrammar.Node:
+		return nullable[rr.Name]
+	case *ungrammar.Labeled:
+		return isNullable(rr.Rule, nullable)
+	case *ungrammar.Opt, *ungrammar.Rep:
+		return true
+	case *ungrammar.Seq:
+		for _, sub := range rr.Rules {
+			if !isNullable(sub, nullable) {
+				return false
+			}
+		}
+		return true
+	case *ungrammar.Alt:
+		for _, sub := range rr.Rules {
+			if isNullable(sub, nullable) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// leftRefs returns the references in r that can appear first in a sequence
+// derived from r: the leading references of each alternative, including ones
+// preceded only by nullable rules.
+func leftRefs(r ungrammar.Rule, nullable map[string]bool) []*ungrammar.Node {
+	switch rr := r.(type) {
+	case *ungrammar.Node:
+		return []*ungrammar.Node{rr}
+	case *ungrammar.Labeled:
+		return leftRefs(rr.Rule, nullable)
+	case *ungrammar.Opt:
+		return leftRefs(rr.Rule, nullable)
+	case *ungrammar.Rep:
+		return leftRefs(rr.Rule, nullable)
+	case *ungrammar.Seq:
+		var refs []*ungrammar.Node
+		for _, sub := range rr.Rules {
+			refs = append(refs, leftRefs(sub, nullable)...)
+			if !isNullable(sub, nullable) {
+				break
+			}
+		}
+		return refs
+	case *ungrammar.Alt:
+		var refs []*ungrammar.Node
+		for _, sub := range rr.Rules {
+			refs = append(refs, leftRefs(sub, nullable)...)
+		}
+		return refs
+	}
+	return nil
+}
+
+// nonProductiveRules returns the set of rules in g that can't derive a finite
+// sequence of tokens. It's the complement of the productive rules, which are
+// computed as a fixed point.
+func nonProductiveRules(g *ungrammar.Grammar) map[string]bool {
+	productive := make(map[string]bool)
+	for changed := true; changed; {
+		changed = false
+		for name, r := range g.Rules {
+			if !productive[name] && isProductive(g, r, productive) {
+				productive[name] = true
+				changed = true
+			}
+		}
+	}
+
+	np := make(map[string]bool)
+	for name := range g.Rules {
+		if !productive[name] {
+			np[name] = true
+		}
+	}
+	return np
+}
+
+func isProductive(g *ungrammar.Grammar, r ungrammar.Rule, productive map[string]bool) bool {
+	switch rr := r.(type) {
+	case *ungrammar.Node:
+		_, defined := g.Rules[rr.Name]
+		return productive[rr.Name] || !defined
+	case *ungrammar.Labeled:
+		return isProductive(g, rr.Rule, productive)
+	case *ungrammar.Seq:
+		for _, sub := range rr.Rules {
+			if !isProductive(g, sub, productive) {
+				return false
+			}
+		}
+		return true
+	case *ungrammar.Alt:
+		for _, sub := range rr.Rules {
+			if isProductive(g, sub, productive) {
+				return true
+			}
+		}
+		return false
+	}
+	// Tokens, '?' and '*' which can derive the empty sequence, and rules
+	// missing due to syntax errors, which are assumed to be productive like
+	// undefined rules.
+	return true
+}
+
+// requiredRefs returns the references in r that aren't under a '?' or '*';
+// these are the references that can make r non-productive.
+func requiredRefs(r ungrammar.Rule) []*ungrammar.Node {
+	switch rr := r.(type) {
+	case *ungrammar.Node:
+		return []*ungrammar.Node{rr}
+	case *ungrammar.Labeled:
+		return requiredRefs(rr.Rule)
+	case *ungrammar.Seq:
+		var refs []*ungrammar.Node
+		for _, sub := range rr.Rules {
+			refs = append(refs, requiredRefs(sub)...)
+		}
+		return refs
+	case *ungrammar.Alt:
+		var refs []*ungrammar.Node
+		for _, sub := range rr.Rules {
+			refs = append(refs, requiredRefs(sub)...)
+		}
+		return refs
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package analysis
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/eliben/go-ungrammar"
+)
+
+func mustParse(t *testing.T, input string) *ungrammar.Grammar {
+	t.Helper()
+	g, err := ungrammar.NewParser(input).ParseGrammar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func cycleStrings(cycles []Cycle) []string {
+	var ss []string
+	for _, c := range cycles {
+		ss = append(ss, c.String())
+	}
+	return ss
+}
+
+func TestLeftRecursion(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  []string
+	}{
+		{`x = 'a' x | 'b'`, nil},
+		{`x = x 'a' | 'b'`, []string{"x -> x"}},
+		{`x = y 'a' y = x | 'b'`, []string{"x -> y -> x"}},
+		{`x = y 'a' y = z z = 'c' | x`, []string{"x -> y -> z -> x"}},
+
+		// Leading nullable rules.
+		{`x = y? x 'a' | 'b' y = 'c'`, []string{"x -> x"}},
+		{`x = e x 'a' | 'b' e = 'c'*`, []string{"x -> x"}},
+		{`x = e x 'a' | 'b' e = 'c'`, nil},
+		{`x = (l:'a')? (x)* 'b'`, []string{"x -> x"}},
+
+		// b is on the same shortest cycle as a, which is only reported once.
+		{`a = b b = a | c c = b`, []string{"a -> b -> a", "c -> b -> c"}},
+
+		// Undefined rules are ignored.
+		{`x = u x`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got := cycleStrings(LeftRecursion(mustParse(t, tt.input)))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCycleRefs(t *testing.T) {
+	g := mustParse(t, `Expr = Lit | BinExpr
+BinExpr = lhs:Expr '+' rhs:Expr
+Lit = 'int'`)
+	cycles := LeftRecursion(g)
+	if len(cycles) != 1 {
+		t.Fatalf("got %d cycles, want 1", len(cycles))
+	}
+	c := cycles[0]
+	if c.IsDirect() {
+		t.Errorf("got direct cycle, want indirect")
+	}
+
+	var gotRefs []string
+	for _, ref := range c.Refs {
+		gotRefs = append(gotRefs, ref.Name+"@"+ref.Location().String())
+	}
+	wantRefs := []string{"BinExpr@1:14", "Expr@2:15"}
+	if !slices.Equal(gotRefs, wantRefs) {
+		t.Errorf("got refs %v, want %v", gotRefs, wantRefs)
+	}
+}
+
+func TestNonProductive(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  []string
+	}{
+		{`x = 'a' x | 'b'`, nil},
+		{`x = 'a' x`, []string{"x -> x"}},
+		{`x = x?`, nil},
+		{`a = 'a' b b = 'b' a`, []string{"a -> b -> a"}},
+		{`a = b | c b = a c = 'c' b`, []string{"a -> b -> a", "c -> b -> a -> c"}},
+
+		// c depends on the a-b cycle, but isn't on it.
+		{`c = a a = 'a' b b = 'b' a`, []string{"a -> b -> a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got := cycleStrings(NonProductive(mustParse(t, tt.input)))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	g := mustParse(t, `x = x 'a' | 'b'
+c = a
+a = 'a' b
+b = 'b' a`)
+
+	var got []string
+	for _, d := range Check(g) {
+		got = append(got, d.Severity.String()+": "+d.Error())
+	}
+	want := []string{
+		"warning: 1:5: rule x is directly left-recursive: x -> x",
+		"error: 3:9: rule a can only derive itself: a -> b -> a",
+		"error: 2:5: rule c is non-productive: it requires non-productive rule a",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q\nwant %q", got, want)
+	}
+}
+
+// Check runs on grammars returned with syntax errors, whose rules may be
+// partial.
+func TestCheckPartial(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  []string
+	}{
+		{"x = l:\ny = x", nil},
+		{"x = 'a' (\ny = x y", []string{"error: 2:7: rule y can only derive itself: y -> y"}},
+		{"x = y |\ny = x", []string{"warning: 1:5: rule x is indirectly left-recursive: x -> y -> x"}},
+		{"x = x ( | 'b')", []string{
+			"warning: 1:5: rule x is directly left-recursive: x -> x",
+			"error: 1:5: rule x can only derive itself: x -> x",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			g, err := ungrammar.NewParser(tt.input).ParseGrammar()
+			if err == nil {
+				t.Fatal("got no syntax error")
+			}
+			var got []string
+			for _, d := range Check(g) {
+				got = append(got, d.Severity.String()+": "+d.Error())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckTestdata(t *testing.T) {
+	var tests = []struct {
+		filename string
+		wantLR   []string
+	}{
+		{"exprlang.ungrammar", []string{"Expr -> BinExpr -> Expr"}},
+		{"ungrammar.ungrammar", []string{"Rule -> Rule"}},
+		{"rust.ungrammar", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			src, err := os.ReadFile(filepath.Join("..", "testdata", tt.filename))
+			if err != nil {
+				t.Fatal(err)
+			}
+			g := mustParse(t, string(src))
+			if cycles := NonProductive(g); len(cycles) > 0 {
+				t.Errorf("got non-productive cycles %v", cycles)
+			}
+			got := cycleStrings(LeftRecursion(g))
+			if tt.wantLR != nil && !slices.Equal(got, tt.wantLR) {
+				t.Errorf("got %q, want %q", got, tt.wantLR)
+			}
+			if len(got) == 0 {
+				t.Errorf("got no left recursion")
+			}
+		})
+	}
+}
@@ -0,0 +1,353 @@
+// go-ungrammar: nullable, FIRST and FOLLOW sets and LL(1) conflicts.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/eliben/go-ungrammar"
+)
+
+// EndOfInput is the member of FOLLOW sets standing for the end of the input;
+// it's in the FOLLOW sets of the roots passed to ComputeLookahead.
+const EndOfInput = ""
+
+// TokenSet is a set of token values (the Value of Token rules).
+type TokenSet map[string]bool
+
+// Sorted returns the tokens in s in sorted order.
+func (s TokenSet) Sorted() []string {
+	toks := make([]string, 0, len(s))
+	for tok := range s {
+		toks = append(toks, tok)
+	}
+	sort.Strings(toks)
+	return toks
+}
+
+// String returns the tokens in s in sorted order, in Ungrammar syntax, e.g.
+// "{'(', 'ident'}". EndOfInput is written as $.
+func (s TokenSet) String() string {
+	return "{" + tokenList(s.Sorted()) + "}"
+}
+
+// addAll adds the tokens in other to s and reports whether s changed.
+func (s TokenSet) addAll(other TokenSet) bool {
+	changed := false
+	for tok := range other {
+		if !s[tok] {
+			s[tok] = true
+			changed = true
+		}
+	}
+	return changed
+}
+
+func tokenList(toks []string) string {
+	quoted := make([]string, len(toks))
+	for i, tok := range toks {
+		if tok == EndOfInput {
+			quoted[i] = "$"
+		} else {
+			quoted[i] = ungrammar.FormatRule(&ungrammar.Token{Value: tok})
+		}
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// Lookahead holds the nullability, FIRST and FOLLOW sets of the rules of a
+// grammar and of all their sub-rules, as used to build predictive parsers:
+//
+//   - A rule is nullable if it can derive the empty sequence.
+//   - The FIRST set of a rule is the set of tokens that can start a sequence
+//     derived from it.
+//   - The FOLLOW set of a rule is the set of tokens that can immediately
+//     follow a sequence derived from it.
+//
+// Sub-rules are identified by the Rule values in the grammar's rule trees;
+// named rules are identified by name. Create a Lookahead with
+// ComputeLookahead.
+type Lookahead struct {
+	g *ungrammar.Grammar
+
+	nullable map[string]bool
+	first    map[string]TokenSet
+	follow   map[string]TokenSet
+
+	subFirst  map[ungrammar.Rule]TokenSet
+	subFollow map[ungrammar.Rule]TokenSet
+}
+
+// ComputeLookahead computes the Lookahead sets of g. The FOLLOW sets of roots
+// (the rules parsing starts from) contain EndOfInput.
+func ComputeLookahead(g *ungrammar.Grammar, roots ...string) *Lookahead {
+	la := &Lookahead{
+		g:         g,
+		nullable:  nullableRules(g),
+		first:     make(map[string]TokenSet),
+		follow:    make(map[string]TokenSet),
+		subFirst:  make(map[ungrammar.Rule]TokenSet),
+		subFollow: make(map[ungrammar.Rule]TokenSet),
+	}
+	names := g.OrderedNames()
+	for _, name := range names {
+		la.first[name] = make(TokenSet)
+		la.follow[name] = make(TokenSet)
+	}
+
+	// FIRST sets of named rules, as a fixed point.
+	for changed := true; changed; {
+		changed = false
+		for _, name := range names {
+			if la.first[name].addAll(la.firstOf(g.Rules[name])) {
+				changed = true
+			}
+		}
+	}
+
+	// Now that the FIRST sets of named rules are final, record the FIRST sets
+	// of all the sub-rules.
+	for _, name := range names {
+		la.recordFirst(g.Rules[name])
+	}
+
+	// FOLLOW sets, as a fixed point.
+	for _, root := range roots {
+		if f, ok := la.follow[root]; ok {
+			f[EndOfInput] = true
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, name := range names {
+			if la.propagateFollow(g.Rules[name], la.follow[name]) {
+				changed = true
+			}
+		}
+	}
+	return la
+}
+
+// RuleNullable reports whether the rule with the given name is nullable.
+func (la *Lookahead) RuleNullable(name string) bool {
+	return la.nullable[name]
+}
+
+// RuleFirst returns the FIRST set of the rule with the given name.
+func (la *Lookahead) RuleFirst(name string) TokenSet {
+	return la.first[name]
+}
+
+// RuleFollow returns the FOLLOW set of the rule with the given name.
+func (la *Lookahead) RuleFollow(name string) TokenSet {
+	return la.follow[name]
+}
+
+// Nullable reports whether r, a rule in the grammar's rule trees, is nullable.
+func (la *Lookahead) Nullable(r ungrammar.Rule) bool {
+	return isNullable(r, la.nullable)
+}
+
+// First returns the FIRST set of r, a rule in the grammar's rule trees.
+func (la *Lookahead) First(r ungrammar.Rule) TokenSet {
+	return la.subFirst[r]
+}
+
+// Follow returns the FOLLOW set of r, a rule in the grammar's rule trees.
+// The FOLLOW set of the body of a named rule is the FOLLOW set of the rule.
+func (la *Lookahead) Follow(r ungrammar.Rule) TokenSet {
+	return la.subFollow[r]
+}
+
+// firstOf computes the FIRST set of r from the current FIRST sets of named
+// rules.
+func (la *Lookahead) firstOf(r ungrammar.Rule) TokenSet {
+	set := make(TokenSet)
+	switch rr := r.(type) {
+	case *ungrammar.Token:
+		set[rr.Value] = true
+	case *ungrammar.Node:
+		set.addAll(la.first[rr.Name])
+	case *ungrammar.Labeled:
+		set.addAll(la.firstOf(rr.Rule))
+	case *ungrammar.Opt:
+		set.addAll(la.firstOf(rr.Rule))
+	case *ungrammar.Rep:
+		set.addAll(la.firstOf(rr.Rule))
+	case *ungrammar.Seq:
+		for _, sub := range rr.Rules {
+			set.addAll(la.firstOf(sub))
+			if !la.Nullable(sub) {
+				break
+			}
+		}
+	case *ungrammar.Alt:
+		for _, sub := range rr.Rules {
+			set.addAll(la.firstOf(sub))
+		}
+	}
+	return set
+}
+
+// recordFirst records the FIRST sets of r and all its sub-rules.
+func (la *Lookahead) recordFirst(r ungrammar.Rule) {
+	if r == nil {
+		return
+	}
+	ungrammar.Inspect(r, func(sub ungrammar.Rule) bool {
+		if sub != nil {
+			la.subFirst[sub] = la.firstOf(sub)
+		}
+		return true
+	})
+}
+
+// propagateFollow adds follow to the FOLLOW set of r, and propagates it to
+// the sub-rules of r and to the named rules r refers to. It reports whether
+// any FOLLOW set changed.
+func (la *Lookahead) propagateFollow(r ungrammar.Rule, follow TokenSet) bool {
+	if r == nil {
+		return false
+	}
+	set, ok := la.subFollow[r]
+	if !ok {
+		set = make(TokenSet)
+		la.subFollow[r] = set
+	}
+	changed := set.addAll(follow)
+
+	switch rr := r.(type) {
+	case *ungrammar.Node:
+		if f, ok := la.follow[rr.Name]; ok && f.addAll(follow) {
+			changed = true
+		}
+	case *ungrammar.Labeled:
+		changed = la.propagateFollow(rr.Rule, follow) || changed
+	case *ungrammar.Opt:
+		changed = la.propagateFollow(rr.Rule, follow) || changed
+	case *ungrammar.Rep:
+		// A repeated rule can be followed by another repetition.
+		inner := make(TokenSet)
+		inner.addAll(follow)
+		inner.addAll(la.First(rr.Rule))
+		changed = la.propagateFollow(rr.Rule, inner) || changed
+	case *ungrammar.Seq:
+		// Walk the sequence backwards, accumulating what can follow each element.
+		after := make(TokenSet)
+		after.addAll(follow)
+		for i := len(rr.Rules) - 1; i >= 0; i-- {
+			sub := rr.Rules[i]
+			changed = la.propagateFollow(sub, after) || changed
+			if !la.Nullable(sub) {
+				after = make(TokenSet)
+			}
+			after.addAll(la.First(sub))
+		}
+	case *ungrammar.Alt:
+		for _, sub := range rr.Rules {
+			changed = la.propagateFollow(sub, follow) || changed
+		}
+	}
+	return changed
+}
+
+// Conflict is an LL(1) conflict: a choice in a rule that a parser can't make
+// by looking at the next token alone.
+type Conflict struct {
+	// Rule is the name of the rule the conflict is in.
+	Rule string
+
+	// At is the Alt, Opt or Rep rule where the choice is made.
+	At ungrammar.Rule
+
+	// A and B are the conflicting alternatives of an Alt. For Opt and Rep, A
+	// is the inner rule and B is nil: the conflict is between parsing A and
+	// skipping it.
+	A, B ungrammar.Rule
+
+	// Tokens are the tokens (in sorted order) that can start both A and B. For
+	// a nullable alternative, the tokens that can follow At count as well. It's
+	// empty if A and B are both nullable and nothing can follow At.
+	Tokens []string
+}
+
+// String describes the conflict with the locations of the alternatives, e.g.
+// "Expr: alternatives at 2:5 and 3:5 can both start with 'ident'".
+func (c Conflict) String() string {
+	if c.B == nil {
+		what := "optional"
+		if _, ok := c.At.(*ungrammar.Rep); ok {
+			what = "repeated"
+		}
+		return fmt.Sprintf("%s: %s rule at %s can start with and be followed by %s",
+			c.Rule, what, c.A.Location(), tokenList(c.Tokens))
+	}
+	if len(c.Tokens) == 0 {
+		return fmt.Sprintf("%s: alternatives at %s and %s can both be empty",
+			c.Rule, c.A.Location(), c.B.Location())
+	}
+	return fmt.Sprintf("%s: alternatives at %s and %s can both start with %s",
+		c.Rule, c.A.Location(), c.B.Location(), tokenList(c.Tokens))
+}
+
+// Conflicts returns the LL(1) conflicts in the grammar, in the order of
+// g.OrderedNames and then in source order. Each pair of conflicting
+// alternatives of an Alt is reported separately.
+func (la *Lookahead) Conflicts() []Conflict {
+	var conflicts []Conflict
+	visit := func(name string, r ungrammar.Rule) bool {
+		switch rr := r.(type) {
+		case *ungrammar.Alt:
+			for i, a := range rr.Rules {
+				for _, b := range rr.Rules[i+1:] {
+					common := intersect(la.predict(a, rr), la.predict(b, rr))
+					if len(common) > 0 || la.Nullable(a) && la.Nullable(b) {
+						conflicts = append(conflicts, Conflict{Rule: name, At: rr, A: a, B: b, Tokens: common})
+					}
+				}
+			}
+		case *ungrammar.Opt, *ungrammar.Rep:
+			inner := ungrammar.Children(rr)[0]
+			if common := intersect(la.First(inner), la.Follow(rr)); len(common) > 0 {
+				conflicts = append(conflicts, Conflict{Rule: name, At: rr, A: inner, Tokens: common})
+			}
+		}
+		return true
+	}
+	for _, name := range la.g.OrderedNames() {
+		if r := la.g.Rules[name]; r != nil {
+			ungrammar.Inspect(r, func(r ungrammar.Rule) bool {
+				return visit(name, r)
+			})
+		}
+	}
+	return conflicts
+}
+
+// predict returns the tokens that select alternative r of alt: its FIRST set,
+// and the FOLLOW set of alt if r is nullable.
+func (la *Lookahead) predict(r ungrammar.Rule, alt *ungrammar.Alt) TokenSet {
+	set := make(TokenSet)
+	set.addAll(la.First(r))
+	if la.Nullable(r) {
+		set.addAll(la.Follow(alt))
+	}
+	return set
+}
+
+// intersect returns the tokens in both a and b, in sorted order.
+func intersect(a, b TokenSet) []string {
+	var common []string
+	for tok := range a {
+		if b[tok] {
+			common = append(common, tok)
+		}
+	}
+	sort.Strings(common)
+	return common
+}
@@ -0,0 +1,157 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package analysis
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/eliben/go-ungrammar"
+)
+
+func TestRuleSets(t *testing.T) {
+	g := mustParse(t, `
+Program = Stmt*
+Stmt = Expr ';' | 'let' Name '=' Expr ';'
+Expr = Atom ('+' Atom)*
+Atom = Name | 'int' | '(' Expr ')'
+Name = 'ident' Generic?
+Generic = '<' Name '>'
+Empty = Generic? ('a' | 'b')*`)
+	la := ComputeLookahead(g, "Program")
+
+	var tests = []struct {
+		name       string
+		wantNull   bool
+		wantFirst  string
+		wantFollow string
+	}{
+		{"Program", true, "{'(', 'ident', 'int', 'let'}", "{$}"},
+		{"Stmt", false, "{'(', 'ident', 'int', 'let'}", "{$, '(', 'ident', 'int', 'let'}"},
+		{"Expr", false, "{'(', 'ident', 'int'}", "{')', ';'}"},
+		{"Atom", false, "{'(', 'ident', 'int'}", "{')', '+', ';'}"},
+		{"Name", false, "{'ident'}", "{')', '+', ';', '=', '>'}"},
+		{"Generic", false, "{'<'}", "{')', '+', ';', '=', '>', 'a', 'b'}"},
+		{"Empty", true, "{'<', 'a', 'b'}", "{}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := la.RuleNullable(tt.name); got != tt.wantNull {
+				t.Errorf("got nullable %v, want %v", got, tt.wantNull)
+			}
+			if got := la.RuleFirst(tt.name).String(); got != tt.wantFirst {
+				t.Errorf("got FIRST %v, want %v", got, tt.wantFirst)
+			}
+			if got := la.RuleFollow(tt.name).String(); got != tt.wantFollow {
+				t.Errorf("got FOLLOW %v, want %v", got, tt.wantFollow)
+			}
+		})
+	}
+}
+
+func TestSubRuleSets(t *testing.T) {
+	g := mustParse(t, `X = 'a' (b:'b' | 'c'?) 'd'* 'e'`)
+	la := ComputeLookahead(g, "X")
+
+	seq := g.Rules["X"].(*ungrammar.Seq)
+	alt := seq.Rules[1].(*ungrammar.Alt)
+	opt := alt.Rules[1]
+	rep := seq.Rules[2]
+
+	var tests = []struct {
+		r          ungrammar.Rule
+		wantNull   bool
+		wantFirst  string
+		wantFollow string
+	}{
+		{seq, false, "{'a'}", "{$}"},
+		{alt, true, "{'b', 'c'}", "{'d', 'e'}"},
+		{alt.Rules[0], false, "{'b'}", "{'d', 'e'}"},
+		{opt, true, "{'c'}", "{'d', 'e'}"},
+		{rep, true, "{'d'}", "{'e'}"},
+		{rep.(*ungrammar.Rep).Rule, false, "{'d'}", "{'d', 'e'}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(ungrammar.FormatRule(tt.r), func(t *testing.T) {
+			if got := la.Nullable(tt.r); got != tt.wantNull {
+				t.Errorf("got nullable %v, want %v", got, tt.wantNull)
+			}
+			if got := la.First(tt.r).String(); got != tt.wantFirst {
+				t.Errorf("got FIRST %v, want %v", got, tt.wantFirst)
+			}
+			if got := la.Follow(tt.r).String(); got != tt.wantFollow {
+				t.Errorf("got FOLLOW %v, want %v", got, tt.wantFollow)
+			}
+		})
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  []string
+	}{
+		{`X = 'a' | 'b'`, nil},
+		{`X = 'a' 'b' | 'a' 'c'`, []string{"X: alternatives at 1:5 and 1:15 can both start with 'a'"}},
+		{`X = A | B A = 'a' | 'c' B = 'b' | 'c'`, []string{"X: alternatives at 1:5 and 1:9 can both start with 'c'"}},
+
+		// A nullable alternative conflicts on what follows the Alt.
+		{`X = ('a'? | 'b') 'b'`, []string{"X: alternatives at 1:6 and 1:13 can both start with 'b'"}},
+		{`X = 'a'? | 'b'?`, []string{"X: alternatives at 1:5 and 1:12 can both start with $"}},
+		{`X = 'x' Y = 'a'? | 'b'?`, []string{"Y: alternatives at 1:13 and 1:20 can both be empty"}},
+
+		// First/follow conflicts.
+		{`X = ('a'? | 'b') 'a'`, []string{"X: optional rule at 1:6 can start with and be followed by 'a'"}},
+		{`X = 'a'? 'a'`, []string{"X: optional rule at 1:5 can start with and be followed by 'a'"}},
+		{`X = Y 'b' Y = 'b'*`, []string{"Y: repeated rule at 1:15 can start with and be followed by 'b'"}},
+		{`X = Y 'b' Y = 'b'* Z = Y`, []string{"Y: repeated rule at 1:15 can start with and be followed by 'b'"}},
+		{`X = ('a' 'b')* 'c'`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			g := mustParse(t, tt.input)
+			var got []string
+			for _, c := range ComputeLookahead(g, "X").Conflicts() {
+				got = append(got, c.String())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookaheadTestdata(t *testing.T) {
+	src, err := os.ReadFile(filepath.Join("..", "testdata", "exprlang.ungrammar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := mustParse(t, string(src))
+	la := ComputeLookahead(g, "Program")
+
+	if got, want := la.RuleFirst("Stmt").String(), "{'(', '+', '-', 'ident', 'int_literal', 'set'}"; got != want {
+		t.Errorf("got FIRST(Stmt) %v, want %v", got, want)
+	}
+
+	// The left recursion in BinExpr makes Expr's alternatives conflict.
+	var got []string
+	for _, c := range la.Conflicts() {
+		if c.Rule == "Expr" {
+			got = append(got, c.String())
+		}
+	}
+	want := []string{
+		"Expr: alternatives at 10:5 and 13:5 can both start with 'ident', 'int_literal'",
+		"Expr: alternatives at 11:5 and 13:5 can both start with '+', '-'",
+		"Expr: alternatives at 12:5 and 13:5 can both start with '('",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q\nwant %q", got, want)
+	}
+}
@@ -0,0 +1,36 @@
+// This program is a Language Server Protocol server for Ungrammar files,
+// speaking JSON-RPC over stdin and stdout; see package lsp for the features it
+// supports. Editors run it as a subprocess, e.g. for files with the .ungram
+// extension.
+//
+// Usage:
+//
+//	ungrammar-lsp
+//
+// Clients can configure the entry rules of grammars with the initialization
+// options of the server, e.g. {"roots": ["SourceFile"]}; rules unreachable
+// from them are then reported as warnings.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/eliben/go-ungrammar/lsp"
+)
+
+func main() {
+	// Log to stderr, since stdout carries the protocol.
+	log.SetFlags(0)
+	log.SetPrefix("ungrammar-lsp: ")
+	if len(os.Args) != 1 {
+		log.Fatal("usage: ungrammar-lsp")
+	}
+	if err := lsp.NewServer(os.Stdin, os.Stdout).Run(); err != nil {
+		log.Fatal(err)
+	}
+}
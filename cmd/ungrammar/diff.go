@@ -0,0 +1,144 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around changes.
+const diffContext = 3
+
+// diffOp is a single line of a line-by-line diff: ' ' for a line common to
+// both inputs, '-' for a deleted line and '+' for an inserted one.
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// unifiedDiff returns the hunks of a unified diff between a and b, without the
+// file header. The diff is computed from the longest common subsequence of
+// lines, which is fine for the size of typical grammar files.
+func unifiedDiff(a, b string) []byte {
+	ops := diffLines(splitLines(a), splitLines(b))
+
+	var buf bytes.Buffer
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// Found a change; extend the hunk while changes are separated by at most
+		// 2*diffContext unchanged lines.
+		start := max(i-diffContext, 0)
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				end = j + 1
+			} else if j-end >= 2*diffContext {
+				break
+			}
+		}
+		end = min(end+diffContext, len(ops))
+
+		aStart, bStart := lineNumbers(ops, start)
+		aLen, bLen := 0, 0
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				aLen++
+			}
+			if op.kind != '-' {
+				bLen++
+			}
+		}
+		// Empty ranges start at the line before them, as in diff -u.
+		if aLen == 0 {
+			aStart--
+		}
+		if bLen == 0 {
+			bStart--
+		}
+		fmt.Fprintf(&buf, "@@ -%d,%d +%d,%d @@\n", aStart, aLen, bStart, bLen)
+		for _, op := range ops[start:end] {
+			fmt.Fprintf(&buf, "%c%s\n", op.kind, op.line)
+		}
+		i = end
+	}
+	return buf.Bytes()
+}
+
+// lineNumbers returns the 1-based line numbers in a and b where ops[i] is.
+func lineNumbers(ops []diffOp, i int) (int, int) {
+	aLine, bLine := 1, 1
+	for _, op := range ops[:i] {
+		if op.kind != '+' {
+			aLine++
+		}
+		if op.kind != '-' {
+			bLine++
+		}
+	}
+	return aLine, bLine
+}
+
+// noNewline is appended to the last line of an input that doesn't end with a
+// newline, so that it differs from the same line with a newline, and is
+// followed by the usual marker when it's printed.
+const noNewline = "\n\\ No newline at end of file"
+
+func splitLines(s string) []string {
+	lines := strings.Split(s, "\n")
+	if last := len(lines) - 1; lines[last] != "" {
+		lines[last] += noNewline
+	} else {
+		lines = lines[:last]
+	}
+	return lines
+}
+
+// diffLines computes a line diff of a and b from their longest common
+// subsequence.
+func diffLines(a, b []string) []diffOp {
+	// lcs[i][j] is the length of the LCS of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
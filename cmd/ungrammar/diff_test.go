@@ -0,0 +1,70 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// lines joins its arguments into a text of newline-terminated lines.
+func lines(ls ...string) string {
+	return strings.Join(ls, "\n") + "\n"
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	var tests = []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"equal", lines("a", "b"), lines("a", "b"), ""},
+		{"change", lines("a", "b", "c"), lines("a", "x", "c"), lines(
+			"@@ -1,3 +1,3 @@", " a", "-b", "+x", " c",
+		)},
+		{"insert at start", lines("a", "b", "c", "d", "e"), lines("x", "a", "b", "c", "d", "e"), lines(
+			"@@ -1,3 +1,4 @@", "+x", " a", " b", " c",
+		)},
+		{"delete at start", lines("a", "b", "c", "d", "e"), lines("b", "c", "d", "e"), lines(
+			"@@ -1,4 +1,3 @@", "-a", " b", " c", " d",
+		)},
+		{"insert at end", lines("a", "b", "c", "d", "e"), lines("a", "b", "c", "d", "e", "x"), lines(
+			"@@ -3,3 +3,4 @@", " c", " d", " e", "+x",
+		)},
+		{"delete at end", lines("a", "b", "c", "d", "e"), lines("a", "b", "c", "d"), lines(
+			"@@ -2,4 +2,3 @@", " b", " c", " d", "-e",
+		)},
+		{"from empty", "", lines("a", "b"), lines(
+			"@@ -0,0 +1,2 @@", "+a", "+b",
+		)},
+		{"to empty", lines("a"), "", lines(
+			"@@ -1,1 +0,0 @@", "-a",
+		)},
+
+		// Changes separated by up to 2*diffContext unchanged lines share a hunk.
+		{"merged hunks", lines("1", "2", "3", "4", "5", "6", "7", "8"), lines("x", "2", "3", "4", "5", "6", "7", "y"), lines(
+			"@@ -1,8 +1,8 @@", "-1", "+x", " 2", " 3", " 4", " 5", " 6", " 7", "-8", "+y",
+		)},
+		{"separate hunks", lines("1", "2", "3", "4", "5", "6", "7", "8", "9"), lines("x", "2", "3", "4", "5", "6", "7", "8", "y"), lines(
+			"@@ -1,4 +1,4 @@", "-1", "+x", " 2", " 3", " 4",
+			"@@ -6,4 +6,4 @@", " 6", " 7", " 8", "-9", "+y",
+		)},
+
+		// A missing newline at the end of either input is a difference.
+		{"no newline in a", "a\nb", lines("a", "b"), lines(
+			"@@ -1,2 +1,2 @@", " a", "-b", `\ No newline at end of file`, "+b",
+		)},
+		{"no newline in b", lines("a", "b"), "a\nc", lines(
+			"@@ -1,2 +1,2 @@", " a", "-b", "+c", `\ No newline at end of file`,
+		)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(unifiedDiff(tt.a, tt.b)); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
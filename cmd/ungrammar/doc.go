@@ -0,0 +1,49 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/eliben/go-ungrammar/docgen"
+)
+
+// runDoc implements "ungrammar doc", which writes reference documentation of
+// a grammar (read from a file or stdin) in Markdown or HTML.
+func runDoc(args []string) int {
+	flags := flag.NewFlagSet("doc", flag.ExitOnError)
+	asHTML := flags.Bool("html", false, "write a static HTML page instead of Markdown")
+	diagrams := flags.Bool("diagrams", false, "include railroad diagrams of rules (with -html)")
+	title := flags.String("title", "", "title of the documentation")
+	out := flags.String("o", "", "write output to this file instead of stdout")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ungrammar doc [flags] [path]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	g, ok := readGrammar("doc", flags)
+	if !ok {
+		return 2
+	}
+	opts := docgen.Options{Title: *title, Diagrams: *diagrams}
+	if *asHTML {
+		opts.Format = docgen.HTML
+	}
+	doc, err := docgen.Generate(g, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ungrammar doc: %v\n", err)
+		return 2
+	}
+
+	if *out == "" {
+		os.Stdout.Write(doc)
+	} else if err := os.WriteFile(*out, doc, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "ungrammar doc: %v\n", err)
+		return 2
+	}
+	return 0
+}
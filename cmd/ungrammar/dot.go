@@ -0,0 +1,82 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/eliben/go-ungrammar"
+	"github.com/eliben/go-ungrammar/graph"
+)
+
+// runDot implements "ungrammar dot", which writes the rule dependency graph of
+// a grammar (read from a file or stdin) in the DOT language to stdout.
+func runDot(args []string) int {
+	flags := flag.NewFlagSet("dot", flag.ExitOnError)
+	focus := flags.String("focus", "", "only show the neighbourhood of this rule")
+	depth := flags.Int("depth", 1, "size of the neighbourhood shown with -focus")
+	collapse := flags.Bool("collapse", false, "collapse rules that are alternations of rule names")
+	cycles := flags.Bool("cycles", false, "highlight rules and references on cycles")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ungrammar dot [flags] [path]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	g, ok := readGrammar("dot", flags)
+	if !ok {
+		return 2
+	}
+	out, err := graph.Dot(g, graph.Options{
+		Focus:           *focus,
+		Depth:           *depth,
+		CollapseAlts:    *collapse,
+		HighlightCycles: *cycles,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ungrammar dot: %v\n", err)
+		return 2
+	}
+	os.Stdout.Write(out)
+	return 0
+}
+
+// readGrammar parses the grammar in the file named by the single argument
+// of flags, or in stdin if there are no arguments. It reports errors to
+// stderr, prefixed by the command name.
+func readGrammar(name string, flags *flag.FlagSet) (*ungrammar.Grammar, bool) {
+	var src []byte
+	var err error
+	filename := ""
+	switch flags.NArg() {
+	case 0:
+		src, err = io.ReadAll(os.Stdin)
+	case 1:
+		filename = flags.Arg(0)
+		src, err = os.ReadFile(filename)
+	default:
+		flags.Usage()
+		return nil, false
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ungrammar %s: %v\n", name, err)
+		return nil, false
+	}
+
+	g, err := ungrammar.NewFileParser(filename, string(src)).ParseGrammar()
+	if err != nil {
+		var errs ungrammar.ErrorList
+		if errors.As(err, &errs) {
+			errs.Render(os.Stderr, string(src))
+		} else {
+			fmt.Fprintf(os.Stderr, "ungrammar %s: %v\n", name, err)
+		}
+		return nil, false
+	}
+	return g, true
+}
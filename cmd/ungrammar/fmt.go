@@ -0,0 +1,137 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/eliben/go-ungrammar"
+	"github.com/eliben/go-ungrammar/format"
+)
+
+// runFmt implements "ungrammar fmt", modeled on gofmt: without file arguments
+// it formats stdin to stdout; directories are walked recursively for files
+// with the .ungrammar extension.
+func runFmt(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "write result to (source) file instead of stdout")
+	list := flags.Bool("l", false, "list files whose formatting differs from canonical")
+	diff := flags.Bool("d", false, "display diffs instead of rewriting files")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ungrammar fmt [flags] [path ...]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	f := &fmtRunner{write: *write, list: *list, diff: *diff, out: os.Stdout}
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(os.Stderr, "ungrammar fmt: cannot use -w with standard input")
+			return 2
+		}
+		f.processFile("<standard input>", os.Stdin)
+		return f.exitCode
+	}
+
+	for _, path := range flags.Args() {
+		info, err := os.Stat(path)
+		if err != nil {
+			f.report(err)
+		} else if info.IsDir() {
+			f.walkDir(path)
+		} else {
+			f.processFile(path, nil)
+		}
+	}
+	return f.exitCode
+}
+
+type fmtRunner struct {
+	write, list, diff bool
+
+	out      io.Writer
+	exitCode int
+}
+
+func (f *fmtRunner) report(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	f.exitCode = 2
+}
+
+func (f *fmtRunner) walkDir(dir string) {
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			f.report(err)
+		} else if !d.IsDir() && strings.HasSuffix(path, ".ungrammar") {
+			f.processFile(path, nil)
+		}
+		return nil
+	})
+}
+
+// processFile formats the file at filename. If in is nil, the file's contents
+// are read from filename; otherwise from in.
+func (f *fmtRunner) processFile(filename string, in io.Reader) {
+	var src []byte
+	var err error
+	if in == nil {
+		src, err = os.ReadFile(filename)
+	} else {
+		src, err = io.ReadAll(in)
+	}
+	if err != nil {
+		f.report(err)
+		return
+	}
+
+	res, err := format.SourceFile(filename, src)
+	if err != nil {
+		var errs ungrammar.ErrorList
+		if errors.As(err, &errs) {
+			errs.Render(os.Stderr, string(src))
+			f.exitCode = 2
+		} else {
+			f.report(err)
+		}
+		return
+	}
+
+	if bytes.Equal(src, res) {
+		if !f.list && !f.write && !f.diff {
+			f.out.Write(res)
+		}
+		return
+	}
+
+	if f.list {
+		fmt.Fprintln(f.out, filename)
+	}
+	if f.write {
+		info, err := os.Stat(filename)
+		if err != nil {
+			f.report(err)
+			return
+		}
+		if err := os.WriteFile(filename, res, info.Mode().Perm()); err != nil {
+			f.report(err)
+			return
+		}
+	}
+	if f.diff {
+		fmt.Fprintf(f.out, "diff %s %s.formatted\n", filename, filename)
+		fmt.Fprintf(f.out, "--- %s\n+++ %s.formatted\n", filename, filename)
+		f.out.Write(unifiedDiff(string(src), string(res)))
+	}
+	if !f.list && !f.write && !f.diff {
+		f.out.Write(res)
+	}
+}
@@ -0,0 +1,87 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eliben/go-ungrammar/format"
+)
+
+func TestFmtModes(t *testing.T) {
+	src := []byte("x = a | b  // c\n")
+	formatted, err := format.SourceFile("", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(src, formatted) {
+		t.Fatal("test source is already formatted")
+	}
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var tests = []struct {
+		name    string
+		runner  fmtRunner
+		wantOut string // with BAD standing for the path of the unformatted file
+		wantBad []byte // the contents of the unformatted file afterwards
+	}{
+		{"list", fmtRunner{list: true}, "BAD\n", src},
+		{"write", fmtRunner{write: true}, "", formatted},
+		{"list write", fmtRunner{list: true, write: true}, "BAD\n", formatted},
+		{"diff", fmtRunner{diff: true}, "diff BAD BAD.formatted\n--- BAD\n+++ BAD.formatted\n" +
+			"@@ -1,1 +1,3 @@\n-x = a | b  // c\n+x =\n+  a\n+| b // c\n", src},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			good := filepath.Join(dir, "good.ungrammar")
+			bad := filepath.Join(dir, "bad.ungrammar")
+			for path, data := range map[string][]byte{good: formatted, bad: src} {
+				if err := os.WriteFile(path, data, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(path, old, old); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var out bytes.Buffer
+			f := tt.runner
+			f.out = &out
+			f.walkDir(dir)
+			if f.exitCode != 0 {
+				t.Errorf("got exit code %d", f.exitCode)
+			}
+
+			got := strings.ReplaceAll(out.String(), bad, "BAD")
+			if got != tt.wantOut {
+				t.Errorf("got output %q, want %q", got, tt.wantOut)
+			}
+			if strings.Contains(out.String(), good) {
+				t.Errorf("formatted file in output %q", out.String())
+			}
+
+			// The formatted file is left alone, even by -w.
+			info, err := os.Stat(good)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info.ModTime().Equal(old) {
+				t.Errorf("formatted file was rewritten")
+			}
+			if data, _ := os.ReadFile(good); !bytes.Equal(data, formatted) {
+				t.Errorf("got formatted file changed to %q", data)
+			}
+			if data, _ := os.ReadFile(bad); !bytes.Equal(data, tt.wantBad) {
+				t.Errorf("got unformatted file %q, want %q", data, tt.wantBad)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+// The ungrammar command provides tools for working with Ungrammar files.
+//
+// Usage:
+//
+//	ungrammar <command> [arguments]
+//
+// The commands are:
+//
+//	fmt       reformat Ungrammar files in canonical layout
+//	dot       write the rule dependency graph in Graphviz DOT format
+//	railroad  write railroad diagrams of rules in SVG, with an HTML index
+//	doc       write reference documentation in Markdown or HTML
+//
+// Run "ungrammar <command> -h" for help on a command's flags.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// command is a subcommand of ungrammar. run gets the command-line arguments
+// following the command's name, and returns the process exit code.
+type command struct {
+	name  string
+	short string
+	run   func(args []string) int
+}
+
+var commands = []command{
+	{"fmt", "reformat Ungrammar files in canonical layout", runFmt},
+	{"dot", "write the rule dependency graph in Graphviz DOT format", runDot},
+	{"railroad", "write railroad diagrams of rules in SVG, with an HTML index", runRailroad},
+	{"doc", "write reference documentation in Markdown or HTML", runDoc},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	for _, cmd := range commands {
+		if cmd.name == name {
+			os.Exit(cmd.run(os.Args[2:]))
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "ungrammar: unknown command %q\n", name)
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: ungrammar <command> [arguments]\n\nThe commands are:\n\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "\t%-10s%s\n", cmd.name, cmd.short)
+	}
+}
@@ -0,0 +1,64 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/eliben/go-ungrammar/railroad"
+)
+
+// runRailroad implements "ungrammar railroad", which writes a railroad
+// diagram for each rule of a grammar (read from a file or stdin) to <rule>.svg
+// in the output directory, along with an index.html showing all of them.
+// Boxes for references to rules link to the diagrams of the rules.
+func runRailroad(args []string) int {
+	flags := flag.NewFlagSet("railroad", flag.ExitOnError)
+	outDir := flags.String("o", ".", "output directory")
+	title := flags.String("title", "", "title of index.html (default: the grammar's file name)")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ungrammar railroad [flags] [path]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	g, ok := readGrammar("railroad", flags)
+	if !ok {
+		return 2
+	}
+	if *title == "" {
+		*title = "Grammar"
+		if flags.NArg() == 1 {
+			*title = strings.TrimSuffix(filepath.Base(flags.Arg(0)), ".ungrammar")
+		}
+	}
+
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "ungrammar railroad: %v\n", err)
+		return 2
+	}
+	opts := railroad.Options{Link: func(name string) string {
+		if _, ok := g.Rules[name]; !ok {
+			return ""
+		}
+		return name + ".svg"
+	}}
+	files := map[string][]byte{"index.html": railroad.HTML(g, *title)}
+	for name, r := range g.Rules {
+		if r != nil {
+			files[name+".svg"] = railroad.SVG(r, opts)
+		}
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(*outDir, name), data, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "ungrammar railroad: %v\n", err)
+			return 2
+		}
+	}
+	return 0
+}
@@ -0,0 +1,88 @@
+// This program generates Go types for a typed AST layer from an ungrammar
+// file, in the style of the one rust-analyzer generates from rust.ungrammar;
+// see codegen.GoAST for the mapping of rules to types. With -kinds, it
+// generates a SyntaxKind enumeration of the grammar's tokens and nodes
+// instead (see codegen.SyntaxKinds).
+//
+// Usage:
+//
+//	ungrammar2go [-kinds] [-pkg name] [-o output.go] [input.ungrammar]
+//
+// Without an input file it reads stdin, and without -o it writes to stdout.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/eliben/go-ungrammar"
+	"github.com/eliben/go-ungrammar/codegen"
+)
+
+func main() {
+	pkg := flag.String("pkg", "ast", "package name of the generated code")
+	out := flag.String("o", "", "write output to this file instead of stdout")
+	kinds := flag.Bool("kinds", false, "generate a SyntaxKind enumeration instead of AST types")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ungrammar2go [-kinds] [-pkg name] [-o output.go] [input.ungrammar]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	log.SetFlags(0)
+	log.SetPrefix("ungrammar2go: ")
+
+	var src []byte
+	var err error
+	filename := ""
+	switch flag.NArg() {
+	case 0:
+		src, err = io.ReadAll(os.Stdin)
+	case 1:
+		filename = flag.Arg(0)
+		src, err = os.ReadFile(filename)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	grammar, err := ungrammar.NewFileParser(filename, string(src)).ParseGrammar()
+	if err != nil {
+		var errs ungrammar.ErrorList
+		if errors.As(err, &errs) {
+			errs.Render(os.Stderr, string(src))
+			os.Exit(1)
+		}
+		log.Fatal(err)
+	}
+
+	opts := codegen.Options{Package: *pkg}
+	if filename != "" {
+		opts.Source = filepath.Base(filename)
+	}
+	generate := codegen.GoAST
+	if *kinds {
+		generate = codegen.SyntaxKinds
+	}
+	code, err := generate(grammar, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *out == "" {
+		os.Stdout.Write(code)
+	} else if err := os.WriteFile(*out, code, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -4,7 +4,8 @@
 // It reads stdin and writes to stdout.
 //
 // The emitted JSON is has minimal whitespace and is not formatted; pipe through
-// `jq .` for a pretty/formatted output.
+// `jq .` for a pretty/formatted output. Rules are emitted in the order in which
+// they're defined in the input.
 //
 // Eli Bendersky [https://eli.thegreenplace.net]
 // This code is in the public domain.
@@ -12,6 +13,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"io"
 	"log"
@@ -36,9 +38,9 @@ func main() {
 		log.Fatal("Error parsing ungrammar:", err)
 	}
 
-	grammarObj := make(object)
-	for name, rule := range grammar.Rules {
-		grammarObj[name] = ruleToObj(rule)
+	var grammarObj orderedObject
+	for _, name := range grammar.Names {
+		grammarObj.add(name, ruleToObj(grammar.Rules[name]))
 	}
 
 	enc := json.NewEncoder(os.Stdout)
@@ -50,6 +52,41 @@ func main() {
 // object is a map with arbitrary values suitable for JSON encoding.
 type object map[string]any
 
+// orderedObject is like object, but its keys are encoded in the order in which
+// they were added.
+type orderedObject struct {
+	keys   []string
+	values []any
+}
+
+func (o *orderedObject) add(key string, value any) {
+	o.keys = append(o.keys, key)
+	o.values = append(o.values, value)
+}
+
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		kb, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		vb, err := json.Marshal(o.values[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(kb)
+		buf.WriteByte(':')
+		buf.Write(vb)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
 func ruleToObj(r ungrammar.Rule) object {
 	switch rr := r.(type) {
 	case *ungrammar.Labeled:
@@ -63,18 +100,18 @@ func ruleToObj(r ungrammar.Rule) object {
 	case *ungrammar.Opt:
 		return object{"opt": ruleToObj(rr.Rule)}
 	case *ungrammar.Seq:
-		var subRules []object
-		for _, sr := range rr.Rules {
-			subRules = append(subRules, ruleToObj(sr))
-		}
-		return object{"seq": subRules}
+		return object{"seq": childObjs(rr)}
 	case *ungrammar.Alt:
-		var subRules []object
-		for _, sr := range rr.Rules {
-			subRules = append(subRules, ruleToObj(sr))
-		}
-		return object{"alt": subRules}
+		return object{"alt": childObjs(rr)}
 	default:
 		return nil
 	}
 }
+
+func childObjs(r ungrammar.Rule) []object {
+	var objs []object
+	for _, sr := range ungrammar.Children(r) {
+		objs = append(objs, ruleToObj(sr))
+	}
+	return objs
+}
@@ -0,0 +1,523 @@
+// go-ungrammar: generation of typed AST layers.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"slices"
+	"strings"
+
+	"github.com/eliben/go-ungrammar"
+)
+
+// Options configures the generators of this package.
+type Options struct {
+	// Package is the name of the package of the generated code; "ast" if
+	// empty.
+	Package string
+
+	// Source names the input the code is generated from, like
+	// "rust.ungrammar", for the header of the generated file. It may be empty.
+	Source string
+}
+
+func (opts Options) pkg() string {
+	if opts.Package == "" {
+		return "ast"
+	}
+	return opts.Package
+}
+
+// header returns the "Code generated ... DO NOT EDIT." line identifying
+// generated files.
+func (opts Options) header(tool string) string {
+	if opts.Source != "" {
+		return fmt.Sprintf("// Code generated by %s from %s. DO NOT EDIT.\n", tool, opts.Source)
+	}
+	return fmt.Sprintf("// Code generated by %s. DO NOT EDIT.\n", tool)
+}
+
+// GoAST generates Go source declaring a typed AST layer for g, in the style of
+// the one rust-analyzer generates from rust.ungrammar:
+//
+//   - A rule that is an alternation of rule names, like
+//     "Expr = Literal | BinExpr", becomes an enum: an interface type
+//     implemented by the types of the alternatives (the variants), and an
+//     integer type enumerating the variants, returned by the interface's only
+//     method. For Expr, these are the interface Expr with the method
+//     ExprKind() ExprKind, and the constants ExprLiteral and ExprBinExpr. If
+//     a variant is itself an enum, the types of its own variants implement
+//     the interface too.
+//   - Any other rule becomes a struct with an accessor method for each of the
+//     nodes and tokens it contains. Accessors are named after labels if
+//     present (lhs:Expr gives Lhs), and otherwise after the rule (Expr gives
+//     Expr) or token ('(' gives LParenToken). Tokens are returned as *Token,
+//     a type declared in the generated code.
+//   - Nodes under '*', or appearing more than once in a sequence, give
+//     accessors returning slices, named in plural for unlabeled rules (Exprs,
+//     CommaTokens). Accessors of nodes and tokens that may be absent return
+//     nil in that case.
+//
+// The fields of the structs are unexported; the code populating them (e.g. a
+// parser) is expected to live in the package of the generated code.
+//
+// GoAST returns an error if g has references to undefined rules, or if
+// generated names collide, e.g. because two different rules in a sequence
+// have the same label. The generated code is gofmt-ed.
+func GoAST(g *ungrammar.Grammar, opts Options) ([]byte, error) {
+	if err := checkDefined(g); err != nil {
+		return nil, err
+	}
+
+	gen := &astGen{
+		g:     g,
+		names: newNamer(g),
+		enums: make(map[string][]string),
+		impls: make(map[string][]enumImpl),
+		decls: make(map[string]string),
+	}
+	if err := gen.lower(); err != nil {
+		return nil, err
+	}
+
+	gen.printf("%s\n", opts.header("ungrammar2go"))
+	gen.printf("package %s\n\n", opts.pkg())
+	gen.declare("Token", "the token type")
+	gen.printf("// Token is a token of the syntax tree.\n")
+	gen.printf("type Token struct {\n")
+	gen.printf("// Kind is the token's value in the grammar, e.g. \"+\" or \"ident\".\n")
+	gen.printf("Kind string\n\n")
+	gen.printf("// Text is the text of the token in the source.\n")
+	gen.printf("Text string\n")
+	gen.printf("}\n")
+	for _, name := range g.OrderedNames() {
+		if variants, ok := gen.enums[name]; ok {
+			gen.genEnum(name, variants)
+		} else {
+			gen.genStruct(name)
+		}
+	}
+	if gen.err != nil {
+		return nil, gen.err
+	}
+
+	src, err := format.Source(gen.buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %w", err)
+	}
+	return src, nil
+}
+
+// cardinality is the number of times a field may appear in a node.
+type cardinality int
+
+const (
+	cardOne cardinality = iota
+	cardOptional
+	cardMany
+)
+
+// field is a child of a struct rule: a node or token with an accessor.
+type field struct {
+	// name is the accessor name for a single child; unlabeled fields with
+	// cardMany have their name pluralized.
+	name  string
+	label string
+
+	// node is the referenced rule for node fields; tokens holds the possible
+	// token values for token fields.
+	node   string
+	tokens []string
+
+	card cardinality
+	doc  string
+	pos  ungrammar.Pos
+}
+
+// enumImpl records that a struct type implements the interface of enum as
+// its variant.
+type enumImpl struct {
+	enum, variant string
+}
+
+type astGen struct {
+	g     *ungrammar.Grammar
+	names *namer
+	buf   bytes.Buffer
+
+	// enums maps the names of enum rules to their variants; fields maps the
+	// names of struct rules to their fields.
+	enums  map[string][]string
+	fields map[string][]field
+
+	// impls maps the names of struct rules to the enums they implement.
+	impls map[string][]enumImpl
+
+	// decls maps the top-level names and methods ("Type.Method") declared in
+	// the generated code to what declared them, to detect collisions. err is
+	// the first collision found.
+	decls map[string]string
+	err   error
+}
+
+func (gen *astGen) printf(format string, args ...any) {
+	fmt.Fprintf(&gen.buf, format, args...)
+}
+
+// lower classifies the rules of the grammar into enums and structs.
+func (gen *astGen) lower() error {
+	names := gen.g.OrderedNames()
+	for _, name := range names {
+		if variants := enumVariants(gen.g.Rules[name]); variants != nil {
+			gen.enums[name] = variants
+		}
+	}
+
+	gen.fields = make(map[string][]field)
+	for _, name := range names {
+		if _, ok := gen.enums[name]; ok {
+			continue
+		}
+		fields, err := gen.lowerFields(gen.g.Rules[name], "")
+		if err != nil {
+			return fmt.Errorf("rule %s: %w", name, err)
+		}
+		gen.fields[name] = fields
+	}
+
+	// Every struct reachable from an enum through its variants implements the
+	// enum's interface.
+	for _, enum := range names {
+		seen := make(map[string]bool)
+		var visit func(name, variant string)
+		visit = func(name, variant string) {
+			if seen[name] {
+				return
+			}
+			seen[name] = true
+			if sub, ok := gen.enums[name]; ok {
+				for _, v := range sub {
+					visit(v, variant)
+				}
+			} else {
+				gen.impls[name] = append(gen.impls[name], enumImpl{enum, variant})
+			}
+		}
+		for _, v := range gen.enums[enum] {
+			visit(v, v)
+		}
+	}
+	return nil
+}
+
+// enumVariants returns the names of the rules in r if r is an alternation of
+// rule names, and nil otherwise.
+func enumVariants(r ungrammar.Rule) []string {
+	alt, ok := r.(*ungrammar.Alt)
+	if !ok {
+		return nil
+	}
+	var variants []string
+	for _, sub := range alt.Rules {
+		node, ok := sub.(*ungrammar.Node)
+		if !ok {
+			return nil
+		}
+		if !slices.Contains(variants, node.Name) {
+			variants = append(variants, node.Name)
+		}
+	}
+	return variants
+}
+
+// lowerFields returns the fields of the rule tree r. label is the label
+// applying to r, if any.
+func (gen *astGen) lowerFields(r ungrammar.Rule, label string) ([]field, error) {
+	switch rr := r.(type) {
+	case *ungrammar.Node:
+		f := field{name: gen.names.rule(rr.Name), node: rr.Name, pos: rr.Location()}
+		if label != "" {
+			f.name, f.label = exportedName(label), label
+		}
+		return []field{f}, nil
+	case *ungrammar.Token:
+		f := field{name: gen.names.token(rr.Value) + "Token", tokens: []string{rr.Value}, pos: rr.Location()}
+		if label != "" {
+			f.name, f.label = exportedName(label), label
+		}
+		return []field{f}, nil
+	case *ungrammar.Labeled:
+		fields, err := gen.lowerFields(rr.Rule, rr.Label)
+		if len(fields) == 1 {
+			fields[0].doc, fields[0].pos = rr.Doc, rr.Location()
+		}
+		return fields, err
+	case *ungrammar.Opt:
+		fields, err := gen.lowerFields(rr.Rule, label)
+		for i := range fields {
+			fields[i].card = max(fields[i].card, cardOptional)
+		}
+		return fields, err
+	case *ungrammar.Rep:
+		fields, err := gen.lowerFields(rr.Rule, label)
+		for i := range fields {
+			fields[i].card = cardMany
+		}
+		return fields, err
+	case *ungrammar.Seq:
+		var fields []field
+		for _, sub := range rr.Rules {
+			subFields, err := gen.lowerFields(sub, "")
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range subFields {
+				if fields, err = mergeField(fields, f, true); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return fields, nil
+	case *ungrammar.Alt:
+		if tokens := altTokens(rr); label != "" && tokens != nil {
+			return []field{{name: exportedName(label), label: label, tokens: tokens, pos: rr.Location()}}, nil
+		}
+
+		// Each field is optional unless it's present in all the alternatives.
+		var fields []field
+		count := make(map[string]int)
+		for _, sub := range rr.Rules {
+			subFields, err := gen.lowerFields(sub, "")
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range subFields {
+				if fields, err = mergeField(fields, f, false); err != nil {
+					return nil, err
+				}
+				count[f.name]++
+			}
+		}
+		for i := range fields {
+			if count[fields[i].name] < len(rr.Rules) {
+				fields[i].card = max(fields[i].card, cardOptional)
+			}
+		}
+		return fields, nil
+	}
+	return nil, nil
+}
+
+// altTokens returns the values of the tokens in alt if all its alternatives
+// are tokens, and nil otherwise.
+func altTokens(alt *ungrammar.Alt) []string {
+	var tokens []string
+	for _, sub := range alt.Rules {
+		tok, ok := sub.(*ungrammar.Token)
+		if !ok {
+			return nil
+		}
+		tokens = append(tokens, tok.Value)
+	}
+	return tokens
+}
+
+// mergeField adds f to fields, merging it with a field of the same name if
+// there is one. If inSeq is true, f follows the fields in a sequence, so a
+// node appearing again makes its field a slice.
+func mergeField(fields []field, f field, inSeq bool) ([]field, error) {
+	i := slices.IndexFunc(fields, func(other field) bool { return other.name == f.name })
+	if i < 0 {
+		return append(fields, f), nil
+	}
+
+	prev := &fields[i]
+	if prev.node != f.node || (prev.node == "" && !slices.Equal(prev.tokens, f.tokens)) {
+		return nil, fmt.Errorf("%s: %s conflicts with %s at %s", f.pos, f.describe(), prev.describe(), prev.pos)
+	}
+	prev.card = max(prev.card, f.card)
+	if inSeq && f.node != "" {
+		prev.card = cardMany
+	}
+	if prev.doc == "" {
+		prev.doc = f.doc
+	}
+	return fields, nil
+}
+
+// describe describes the field in Ungrammar syntax, like "lhs:Expr".
+func (f *field) describe() string {
+	var what string
+	if f.node != "" {
+		what = f.node
+	} else {
+		quoted := make([]string, len(f.tokens))
+		for i, tok := range f.tokens {
+			quoted[i] = fmt.Sprintf("'%s'", tok)
+		}
+		what = strings.Join(quoted, " | ")
+		if len(quoted) > 1 {
+			what = "(" + what + ")"
+		}
+	}
+	if f.label != "" {
+		return fmt.Sprintf("%s:%s", f.label, what)
+	}
+	return what
+}
+
+// accessor returns the name of the accessor method of f.
+func (f *field) accessor() string {
+	if f.card == cardMany && f.label == "" {
+		return plural(f.name)
+	}
+	return f.name
+}
+
+// plural returns the English plural of the noun at the end of name.
+func plural(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, "s"), strings.HasSuffix(lower, "x"),
+		strings.HasSuffix(lower, "ch"), strings.HasSuffix(lower, "sh"):
+		return name + "es"
+	case strings.HasSuffix(lower, "y") && len(lower) > 1 && !strings.ContainsRune("aeiou", rune(lower[len(lower)-2])):
+		return name[:len(name)-1] + "ies"
+	}
+	return name + "s"
+}
+
+// goType returns the Go type of f's accessor.
+func (gen *astGen) goType(f *field) string {
+	typ := "*Token"
+	if f.node != "" {
+		typ = gen.names.rule(f.node)
+		if _, isEnum := gen.enums[f.node]; !isEnum {
+			typ = "*" + typ
+		}
+	}
+	if f.card == cardMany {
+		return "[]" + typ
+	}
+	return typ
+}
+
+// declare records the declaration of a top-level name or method (as
+// "Type.Method"), reporting a collision with an existing one.
+func (gen *astGen) declare(name, by string) {
+	if prev, ok := gen.decls[name]; ok && gen.err == nil {
+		gen.err = fmt.Errorf("generated name %s for %s collides with the one for %s", name, by, prev)
+	}
+	gen.decls[name] = by
+}
+
+// docComment writes doc as a Go comment.
+func (gen *astGen) docComment(doc string) {
+	for _, line := range strings.Split(doc, "\n") {
+		if line == "" {
+			gen.printf("//\n")
+		} else {
+			gen.printf("// %s\n", line)
+		}
+	}
+}
+
+// ruleComment writes the doc comment of the type generated for the rule name:
+// its doc comment in the grammar, if any, and its definition.
+func (gen *astGen) ruleComment(name string) {
+	gen.printf("\n")
+	if doc := gen.g.Docs[name]; doc != "" {
+		gen.docComment(doc)
+		gen.printf("//\n")
+	}
+	gen.printf("// %s is generated from:\n//\n", gen.names.rule(name))
+	gen.printf("//\t%s = %s\n", name, ungrammar.FormatRule(gen.g.Rules[name]))
+}
+
+func (gen *astGen) genEnum(name string, variants []string) {
+	typ := gen.names.rule(name)
+	kind := typ + "Kind"
+	gen.declare(typ, "rule "+name)
+	gen.declare(kind, "the variants of rule "+name)
+
+	gen.ruleComment(name)
+	gen.printf("type %s interface {\n", typ)
+	gen.printf("// %s returns the variant of %s implemented by the value.\n", kind, typ)
+	gen.printf("%s() %s\n", kind, kind)
+	gen.printf("}\n\n")
+
+	gen.printf("// %s enumerates the variants of %s.\n", kind, typ)
+	gen.printf("type %s int\n\n", kind)
+	gen.printf("const (\n")
+	alt := gen.g.Rules[name].(*ungrammar.Alt)
+	for i, v := range variants {
+		constName := typ + gen.names.rule(v)
+		gen.declare(constName, fmt.Sprintf("variant %s of rule %s", v, name))
+		if i < len(alt.Docs) && alt.Docs[i] != "" && len(variants) == len(alt.Rules) {
+			gen.docComment(alt.Docs[i])
+		}
+		if i == 0 {
+			gen.printf("%s %s = iota\n", constName, kind)
+		} else {
+			gen.printf("%s\n", constName)
+		}
+	}
+	gen.printf(")\n")
+}
+
+func (gen *astGen) genStruct(name string) {
+	typ := gen.names.rule(name)
+	gen.declare(typ, "rule "+name)
+	fields := gen.fields[name]
+
+	gen.ruleComment(name)
+	gen.printf("type %s struct {\n", typ)
+	for i := range fields {
+		f := &fields[i]
+		gen.printf("%s %s\n", unexportedName(f.accessor()), gen.goType(f))
+	}
+	gen.printf("}\n")
+
+	for i := range fields {
+		f := &fields[i]
+		acc := f.accessor()
+		gen.declare(typ+"."+acc, fmt.Sprintf("%s in rule %s", f.describe(), name))
+
+		gen.printf("\n")
+		if f.doc != "" {
+			gen.docComment(f.doc)
+			gen.printf("//\n")
+		}
+		what := "child"
+		if f.node == "" {
+			what = "token"
+		}
+		switch f.card {
+		case cardOne:
+			gen.printf("// %s returns the %s %s of %s.\n", acc, f.describe(), what, typ)
+		case cardOptional:
+			gen.printf("// %s returns the %s %s of %s, or nil if it's absent.\n", acc, f.describe(), what, typ)
+		case cardMany:
+			what = map[string]string{"child": "children", "token": "tokens"}[what]
+			gen.printf("// %s returns the %s %s of %s.\n", acc, f.describe(), what, typ)
+		}
+		gen.printf("func (n *%s) %s() %s {\n", typ, acc, gen.goType(f))
+		gen.printf("return n.%s\n", unexportedName(acc))
+		gen.printf("}\n")
+	}
+
+	for _, impl := range gen.impls[name] {
+		enum := gen.names.rule(impl.enum)
+		kind := enum + "Kind"
+		gen.declare(typ+"."+kind, "the implementation of "+enum)
+		gen.printf("\n// %s implements %s.\n", kind, enum)
+		gen.printf("func (*%s) %s() %s {\n", typ, kind, kind)
+		gen.printf("return %s%s\n", enum, gen.names.rule(impl.variant))
+		gen.printf("}\n")
+	}
+}
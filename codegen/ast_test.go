@@ -0,0 +1,185 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package codegen
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eliben/go-ungrammar"
+)
+
+func mustParse(t *testing.T, input string) *ungrammar.Grammar {
+	t.Helper()
+	g, err := ungrammar.NewParser(input).ParseGrammar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+// typeCheck parses and type-checks the Go source src, returning its package.
+func typeCheck(t *testing.T, src []byte) *types.Package {
+	t.Helper()
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "gen.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := types.Config{Importer: importer.Default()}
+	pkg, err := conf.Check(f.Name.Name, fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatalf("type-checking generated code: %v\n%s", err, src)
+	}
+	return pkg
+}
+
+func TestTokenNames(t *testing.T) {
+	g := mustParse(t, `x = 'set' '(' '::' '->' '..=' 'int_number' '_' 'self' 'Self' 'r#' '€'`)
+	n := newNamer(g)
+
+	var tests = []struct {
+		value string
+		want  string
+	}{
+		{"set", "Set"},
+		{"(", "LParen"},
+		{"::", "ColonColon"},
+		{"->", "ThinArrow"},
+		{"..=", "DotDotEq"},
+		{"int_number", "IntNumber"},
+		{"_", "Underscore"},
+		{"self", "Self"},
+		{"Self", "SelfUpper"},
+		{"r#", "RPound"},
+		{"€", "U20AC"},
+	}
+	for _, tt := range tests {
+		if got := n.token(tt.value); got != tt.want {
+			t.Errorf("token(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestGoAST(t *testing.T) {
+	g := mustParse(t, `
+// A whole program.
+Program = Stmt*
+Stmt = AssignStmt | Expr
+AssignStmt = 'set' name:'ident' '=' Expr
+Expr = Literal | BinExpr | Call
+BinExpr = lhs:Expr op:('+' | '-') rhs:Expr
+Call = Expr '(' (Expr (',' Expr)* ','?)? ')'
+Literal = 'int_literal' | 'ident'
+`)
+	src, err := GoAST(g, Options{Package: "exprlang", Source: "exprlang.ungrammar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := typeCheck(t, src)
+	if pkg.Name() != "exprlang" {
+		t.Errorf("got package %s, want exprlang", pkg.Name())
+	}
+	if !strings.HasPrefix(string(src), "// Code generated by ungrammar2go from exprlang.ungrammar. DO NOT EDIT.\n") {
+		t.Errorf("missing header in:\n%s", src)
+	}
+
+	// Method sets of the generated types.
+	var tests = []struct {
+		typ     string
+		methods []string
+	}{
+		{"Program", []string{"Stmts() []Stmt"}},
+		{"AssignStmt", []string{
+			"SetToken() *Token", "Name() *Token", "EqToken() *Token", "Expr() Expr",
+			"StmtKind() StmtKind",
+		}},
+		{"BinExpr", []string{
+			"Lhs() Expr", "Op() *Token", "Rhs() Expr",
+			"StmtKind() StmtKind", "ExprKind() ExprKind",
+		}},
+		{"Call", []string{
+			"Exprs() []Expr", "LParenToken() *Token", "CommaTokens() []*Token", "RParenToken() *Token",
+			"StmtKind() StmtKind", "ExprKind() ExprKind",
+		}},
+		{"Literal", []string{"IntLiteralToken() *Token", "IdentToken() *Token"}},
+	}
+	for _, tt := range tests {
+		obj := pkg.Scope().Lookup(tt.typ)
+		if obj == nil {
+			t.Errorf("type %s not generated", tt.typ)
+			continue
+		}
+		mset := types.NewMethodSet(types.NewPointer(obj.Type()))
+		for _, want := range tt.methods {
+			name, sig, _ := strings.Cut(want, "(")
+			sel := mset.Lookup(pkg, name)
+			if sel == nil {
+				t.Errorf("%s has no method %s", tt.typ, name)
+				continue
+			}
+			got := types.TypeString(sel.Type(), types.RelativeTo(pkg))
+			if got != "func("+sig {
+				t.Errorf("%s.%s has type %s, want func(%s", tt.typ, name, got, sig)
+			}
+		}
+	}
+
+	// Variants of enums, in the order of the grammar.
+	for _, want := range []string{"ExprLiteral", "ExprBinExpr", "ExprCall", "StmtAssignStmt", "StmtExpr"} {
+		if pkg.Scope().Lookup(want) == nil {
+			t.Errorf("constant %s not generated", want)
+		}
+	}
+	if !strings.Contains(string(src), "// A whole program.\n//\n// Program is generated from:") {
+		t.Errorf("missing doc comment of Program in:\n%s", src)
+	}
+}
+
+func TestGoASTErrors(t *testing.T) {
+	var tests = []struct {
+		input   string
+		wantErr string
+	}{
+		{`x = y`, "1:5: undefined rule y"},
+		{`x = a:y a:z  y = 'y'  z = 'z'`, "rule x: 1:9: a:z conflicts with a:y at 1:5"},
+		{`x = 'x'  x_kind = 'y'  X = y  y = x | x_kind`, "generated name X for rule X collides with the one for rule x"},
+		{`Token = 'x'`, "generated name Token for rule Token collides with the one for the token type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := GoAST(mustParse(t, tt.input), Options{})
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGoASTTestdata(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("..", "testdata", "*.ungrammar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			src, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := GoAST(mustParse(t, string(src)), Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			typeCheck(t, out)
+		})
+	}
+}
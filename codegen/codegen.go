@@ -0,0 +1,221 @@
+// go-ungrammar: code generation from grammars.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+// Package codegen generates Go source code from Ungrammar grammars, such as
+// typed AST layers and enumerations of syntax kinds in the style of the ones
+// rust-analyzer generates from rust.ungrammar.
+//
+// Rule names become Go names by capitalizing them and dropping underscores
+// ("int_literal" becomes IntLiteral). Tokens are named by their value:
+// identifier-like tokens the same way as rules ('set' becomes Set), and
+// punctuation by the names of its characters ('::' becomes ColonColon, '('
+// becomes LParen). If two tokens differ only in case, like 'self' and 'Self',
+// the name of the one starting with an uppercase letter gets the suffix Upper.
+package codegen
+
+import (
+	"fmt"
+	"go/token"
+	"strings"
+	"unicode"
+
+	"github.com/eliben/go-ungrammar"
+)
+
+// punctNames maps punctuation characters to the words naming them in tokens.
+var punctNames = map[rune]string{
+	'(':  "LParen",
+	')':  "RParen",
+	'[':  "LBrack",
+	']':  "RBrack",
+	'{':  "LCurly",
+	'}':  "RCurly",
+	'<':  "LAngle",
+	'>':  "RAngle",
+	',':  "Comma",
+	'.':  "Dot",
+	';':  "Semicolon",
+	':':  "Colon",
+	'=':  "Eq",
+	'!':  "Bang",
+	'+':  "Plus",
+	'-':  "Minus",
+	'*':  "Star",
+	'/':  "Slash",
+	'%':  "Percent",
+	'^':  "Caret",
+	'&':  "Amp",
+	'|':  "Pipe",
+	'~':  "Tilde",
+	'?':  "Question",
+	'#':  "Pound",
+	'$':  "Dollar",
+	'@':  "At",
+	'\'': "Quote",
+	'"':  "DoubleQuote",
+	'\\': "Backslash",
+	'`':  "Backtick",
+}
+
+// operatorNames names multi-character tokens that read better as a whole
+// than by their characters.
+var operatorNames = map[string]string{
+	"->": "ThinArrow",
+	"=>": "FatArrow",
+}
+
+// exportedName converts a rule name or label to an exported Go name:
+// "int_literal" becomes "IntLiteral".
+func exportedName(s string) string {
+	var sb strings.Builder
+	for _, part := range strings.Split(s, "_") {
+		if part == "" {
+			continue
+		}
+		r := []rune(part)
+		r[0] = unicode.ToUpper(r[0])
+		sb.WriteString(string(r))
+	}
+	name := sb.String()
+	switch {
+	case name == "":
+		return "Underscore"
+	case unicode.IsDigit([]rune(name)[0]):
+		return "N" + name
+	}
+	return name
+}
+
+// unexportedName returns name with its first letter in lowercase, avoiding Go
+// keywords.
+func unexportedName(name string) string {
+	r := []rune(name)
+	r[0] = unicode.ToLower(r[0])
+	s := string(r)
+	if token.IsKeyword(s) {
+		s += "_"
+	}
+	return s
+}
+
+// tokenWord returns the name of the token with the given value, before
+// disambiguation (see namer).
+func tokenWord(value string) string {
+	if name, ok := operatorNames[value]; ok {
+		return name
+	}
+
+	var sb strings.Builder
+	word := 0
+	flush := func(i int) {
+		if i > word {
+			sb.WriteString(exportedName(value[word:i]))
+		}
+	}
+	for i, r := range value {
+		if r == '_' && len(value) == 1 {
+			return "Underscore"
+		}
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			continue
+		}
+		flush(i)
+		word = i + len(string(r))
+		if name, ok := punctNames[r]; ok {
+			sb.WriteString(name)
+		} else {
+			fmt.Fprintf(&sb, "U%04X", r)
+		}
+	}
+	flush(len(value))
+	name := sb.String()
+	if name == "" {
+		return "Empty"
+	}
+	return name
+}
+
+// namer assigns Go names to the rules and tokens of a grammar.
+type namer struct {
+	// tokens lists the values of all the tokens in the grammar, in order of
+	// first appearance.
+	tokens []string
+
+	tokenNames map[string]string
+}
+
+func newNamer(g *ungrammar.Grammar) *namer {
+	n := &namer{tokenNames: make(map[string]string)}
+	for _, name := range g.OrderedNames() {
+		if g.Rules[name] == nil {
+			continue
+		}
+		ungrammar.Inspect(g.Rules[name], func(r ungrammar.Rule) bool {
+			if tok, ok := r.(*ungrammar.Token); ok {
+				if _, seen := n.tokenNames[tok.Value]; !seen {
+					n.tokenNames[tok.Value] = ""
+					n.tokens = append(n.tokens, tok.Value)
+				}
+			}
+			return true
+		})
+	}
+
+	byWord := make(map[string][]string)
+	for _, value := range n.tokens {
+		word := tokenWord(value)
+		byWord[word] = append(byWord[word], value)
+	}
+	taken := make(map[string]bool)
+	for _, value := range n.tokens {
+		name := tokenWord(value)
+		if len(byWord[name]) > 1 && unicode.IsUpper([]rune(value)[0]) {
+			name += "Upper"
+		}
+		base := name
+		for i := 2; taken[name]; i++ {
+			name = fmt.Sprintf("%s%d", base, i)
+		}
+		taken[name] = true
+		n.tokenNames[value] = name
+	}
+	return n
+}
+
+// rule returns the Go name of the rule name.
+func (n *namer) rule(name string) string {
+	return exportedName(name)
+}
+
+// token returns the Go name of the token with the given value.
+func (n *namer) token(value string) string {
+	if name := n.tokenNames[value]; name != "" {
+		return name
+	}
+	return tokenWord(value)
+}
+
+// checkDefined returns an error if g has nil rules or references to undefined
+// rules, which the generators can't handle.
+func checkDefined(g *ungrammar.Grammar) error {
+	for _, name := range g.OrderedNames() {
+		if g.Rules[name] == nil {
+			return fmt.Errorf("rule %s has no definition", name)
+		}
+		var err error
+		ungrammar.Inspect(g.Rules[name], func(r ungrammar.Rule) bool {
+			if node, ok := r.(*ungrammar.Node); ok && err == nil {
+				if _, ok := g.Rules[node.Name]; !ok {
+					err = fmt.Errorf("%s: undefined rule %s", node.Location(), node.Name)
+				}
+			}
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
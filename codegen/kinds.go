@@ -0,0 +1,327 @@
+// go-ungrammar: generation of syntax kind enumerations.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/eliben/go-ungrammar"
+)
+
+// TokenClass classifies the tokens of a grammar.
+type TokenClass int
+
+const (
+	// Punct is punctuation, like '::' or '('.
+	Punct TokenClass = iota
+
+	// Keyword is an identifier-like token standing for itself, like 'fn'.
+	Keyword
+
+	// Literal is a class of tokens, like 'ident' or 'int_number', whose text
+	// varies.
+	Literal
+)
+
+func (c TokenClass) String() string {
+	switch c {
+	case Punct:
+		return "punctuation"
+	case Keyword:
+		return "keyword"
+	case Literal:
+		return "literal"
+	}
+	return fmt.Sprintf("TokenClass(%d)", int(c))
+}
+
+// literalSuffixes are the suffixes of identifier-like tokens that name
+// classes of tokens rather than keywords, following the conventions of
+// rust.ungrammar ('lifetime_ident', 'int_number', 'raw_string').
+var literalSuffixes = []string{"_ident", "_number", "_string", "_literal"}
+
+// ClassifyToken returns the class of the token with the given value. Tokens
+// that aren't identifiers, like '::' or '_', are punctuation. Identifiers are
+// literal classes if they're 'ident' or end with "_ident", "_number",
+// "_string" or "_literal", and keywords otherwise.
+func ClassifyToken(value string) TokenClass {
+	r := []rune(value)
+	if len(r) == 0 || !unicode.IsLetter(r[0]) {
+		return Punct
+	}
+	for _, c := range r {
+		if c != '_' && !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+			return Punct
+		}
+	}
+	if value == "ident" {
+		return Literal
+	}
+	for _, suffix := range literalSuffixes {
+		if strings.HasSuffix(value, suffix) && len(value) > len(suffix) {
+			return Literal
+		}
+	}
+	return Keyword
+}
+
+// kindPunctNames names punctuation tokens in syntax kinds, when their names
+// aren't derived from their characters (see punctKindName).
+var kindPunctNames = map[string]string{
+	"->":  "THIN_ARROW",
+	"=>":  "FAT_ARROW",
+	"!=":  "NEQ",
+	"<=":  "LTEQ",
+	">=":  "GTEQ",
+	"<<":  "SHL",
+	">>":  "SHR",
+	"<<=": "SHLEQ",
+	">>=": "SHREQ",
+}
+
+// screamingSnake converts a CamelCase name to SCREAMING_SNAKE_CASE:
+// "GenericArgList" becomes "GENERIC_ARG_LIST".
+func screamingSnake(name string) string {
+	r := []rune(name)
+	var sb strings.Builder
+	for i, c := range r {
+		if i > 0 && unicode.IsUpper(c) && r[i-1] != '_' {
+			prevLower := unicode.IsLower(r[i-1]) || unicode.IsDigit(r[i-1])
+			nextLower := i+1 < len(r) && unicode.IsLower(r[i+1])
+			if prevLower || (unicode.IsUpper(r[i-1]) && nextLower) {
+				sb.WriteByte('_')
+			}
+		}
+		sb.WriteRune(unicode.ToUpper(c))
+	}
+	return sb.String()
+}
+
+// punctKindName returns the syntax kind name of a punctuation token, in the
+// style of rust-analyzer: runs of the same character are named by the
+// character's name followed by the length of the run, so '::' becomes COLON2
+// and '..=' becomes DOT2EQ.
+func punctKindName(value string) string {
+	if name, ok := kindPunctNames[value]; ok {
+		return name
+	}
+
+	var sb strings.Builder
+	r := []rune(value)
+	for i := 0; i < len(r); {
+		j := i
+		for j < len(r) && r[j] == r[i] {
+			j++
+		}
+		switch name, ok := punctNames[r[i]]; {
+		case ok:
+			sb.WriteString(screamingSnake(name))
+		case r[i] == '_':
+			sb.WriteString("UNDERSCORE")
+		case unicode.IsLetter(r[i]) || unicode.IsDigit(r[i]):
+			sb.WriteString(string(unicode.ToUpper(r[i])))
+		default:
+			fmt.Fprintf(&sb, "U%04X", r[i])
+		}
+		if j-i > 1 {
+			fmt.Fprintf(&sb, "%d", j-i)
+		}
+		i = j
+	}
+	return sb.String()
+}
+
+// syntaxKind is a member of the generated SyntaxKind enumeration.
+type syntaxKind struct {
+	name string
+
+	// value is the token's value for tokens, and the rule name for nodes.
+	value  string
+	isNode bool
+	class  TokenClass
+}
+
+// SyntaxKinds generates Go source declaring a SyntaxKind enumeration of all
+// the kinds of tokens and nodes in g, as needed by parsers producing syntax
+// trees for the grammar. The kinds are named in the style of rust-analyzer:
+//
+//   - Punctuation is named by its characters: '(' is L_PAREN, '::' is COLON2.
+//   - Keywords are named by their value with the suffix _KW: 'fn' is FN_KW.
+//     If two keywords differ only in case, like 'self' and 'Self', the one
+//     starting with an uppercase letter gets the suffix _UPPER_KW.
+//   - Literal classes are named by their value: 'int_number' is INT_NUMBER.
+//   - Nodes are named by the rule names: BinExpr is BIN_EXPR.
+//
+// See ClassifyToken for how tokens are classified. The kinds are ordered by
+// class in the order above; tokens are sorted by their value within their
+// class, and nodes are ordered like the rules of g. The generated code
+// declares a String method for SyntaxKind, methods testing the class of a
+// kind, and a Text method returning the text of punctuation and keywords.
+//
+// SyntaxKinds returns an error if two kinds get the same name.
+func SyntaxKinds(g *ungrammar.Grammar, opts Options) ([]byte, error) {
+	var tokens []string
+	for _, name := range g.OrderedNames() {
+		if g.Rules[name] == nil {
+			continue
+		}
+		ungrammar.Inspect(g.Rules[name], func(r ungrammar.Rule) bool {
+			if tok, ok := r.(*ungrammar.Token); ok && !slices.Contains(tokens, tok.Value) {
+				tokens = append(tokens, tok.Value)
+			}
+			return true
+		})
+	}
+	slices.Sort(tokens)
+
+	var kinds []syntaxKind
+	for _, class := range []TokenClass{Punct, Keyword, Literal} {
+		for _, value := range tokens {
+			if ClassifyToken(value) != class {
+				continue
+			}
+			var name string
+			switch class {
+			case Punct:
+				name = punctKindName(value)
+			case Keyword:
+				name = strings.ToUpper(value)
+				if unicode.IsUpper([]rune(value)[0]) && slices.ContainsFunc(tokens, func(other string) bool {
+					return other != value && strings.EqualFold(other, value)
+				}) {
+					name += "_UPPER"
+				}
+				name += "_KW"
+			case Literal:
+				name = strings.ToUpper(value)
+			}
+			kinds = append(kinds, syntaxKind{name: name, value: value, class: class})
+		}
+	}
+	for _, name := range g.OrderedNames() {
+		kinds = append(kinds, syntaxKind{name: screamingSnake(exportedName(name)), value: name, isNode: true})
+	}
+
+	seen := make(map[string]syntaxKind)
+	for _, k := range kinds {
+		if prev, ok := seen[k.name]; ok {
+			return nil, fmt.Errorf("syntax kind %s of %s collides with the one of %s", k.name, k.describe(), prev.describe())
+		}
+		seen[k.name] = k
+	}
+
+	var buf bytes.Buffer
+	printf := func(format string, args ...any) {
+		fmt.Fprintf(&buf, format, args...)
+	}
+	printf("%s\n", opts.header("ungrammar2go"))
+	printf("package %s\n\n", opts.pkg())
+	printf("import \"fmt\"\n\n")
+	printf("// SyntaxKind is the kind of a token or node of the syntax tree.\n")
+	printf("type SyntaxKind uint16\n\n")
+	printf("const (\n")
+	for i, k := range kinds {
+		if i == 0 || k.isNode != kinds[i-1].isNode || k.class != kinds[i-1].class {
+			if i > 0 {
+				printf("\n")
+			}
+			printf("// %s\n", k.section())
+		}
+		if i == 0 {
+			printf("%s SyntaxKind = iota // %s\n", k.name, k.describe())
+		} else {
+			printf("%s // %s\n", k.name, k.describe())
+		}
+	}
+	printf(")\n\n")
+
+	printf("var syntaxKindNames = [...]string{\n")
+	for _, k := range kinds {
+		printf("%s: %q,\n", k.name, k.name)
+	}
+	printf("}\n\n")
+
+	printf("func (k SyntaxKind) String() string {\n")
+	printf("if int(k) < len(syntaxKindNames) {\n")
+	printf("return syntaxKindNames[k]\n")
+	printf("}\n")
+	printf("return fmt.Sprintf(\"SyntaxKind(%%d)\", int(k))\n")
+	printf("}\n")
+
+	// Kinds of each class are contiguous, so the class tests are range checks.
+	ranges := []struct {
+		method, doc string
+		match       func(k syntaxKind) bool
+	}{
+		{"IsPunct", "punctuation", func(k syntaxKind) bool { return !k.isNode && k.class == Punct }},
+		{"IsKeyword", "a keyword", func(k syntaxKind) bool { return !k.isNode && k.class == Keyword }},
+		{"IsLiteral", "a literal class of tokens", func(k syntaxKind) bool { return !k.isNode && k.class == Literal }},
+		{"IsToken", "a token", func(k syntaxKind) bool { return !k.isNode }},
+		{"IsNode", "a node", func(k syntaxKind) bool { return k.isNode }},
+	}
+	for _, rg := range ranges {
+		printf("\n// %s reports whether k is %s.\n", rg.method, rg.doc)
+		printf("func (k SyntaxKind) %s() bool {\n", rg.method)
+		first := slices.IndexFunc(kinds, rg.match)
+		if first < 0 {
+			printf("return false\n")
+		} else {
+			last := first
+			for last+1 < len(kinds) && rg.match(kinds[last+1]) {
+				last++
+			}
+			printf("return k >= %s && k <= %s\n", kinds[first].name, kinds[last].name)
+		}
+		printf("}\n")
+	}
+
+	printf("\n// Text returns the text of punctuation and keywords, and \"\" for other\n")
+	printf("// kinds.\n")
+	printf("func (k SyntaxKind) Text() string {\n")
+	printf("switch k {\n")
+	for _, k := range kinds {
+		if !k.isNode && k.class != Literal {
+			printf("case %s:\n", k.name)
+			printf("return %q\n", k.value)
+		}
+	}
+	printf("}\n")
+	printf("return \"\"\n")
+	printf("}\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %w", err)
+	}
+	return src, nil
+}
+
+// describe describes k in Ungrammar syntax, like "'::'" or "BinExpr".
+func (k syntaxKind) describe() string {
+	if k.isNode {
+		return k.value
+	}
+	return fmt.Sprintf("'%s'", k.value)
+}
+
+// section returns the heading of the section of kinds k belongs to.
+func (k syntaxKind) section() string {
+	if k.isNode {
+		return "Nodes"
+	}
+	switch k.class {
+	case Punct:
+		return "Punctuation"
+	case Keyword:
+		return "Keywords"
+	}
+	return "Literals"
+}
@@ -0,0 +1,140 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package codegen
+
+import (
+	"go/constant"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestClassifyToken(t *testing.T) {
+	var tests = []struct {
+		value string
+		want  TokenClass
+	}{
+		{"::", Punct},
+		{"_", Punct},
+		{"r#", Punct},
+		{"fn", Keyword},
+		{"Self", Keyword},
+		{"macro_rules", Keyword},
+		{"ident", Literal},
+		{"lifetime_ident", Literal},
+		{"int_number", Literal},
+		{"raw_string", Literal},
+		{"int_literal", Literal},
+	}
+	for _, tt := range tests {
+		if got := ClassifyToken(tt.value); got != tt.want {
+			t.Errorf("ClassifyToken(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestKindNames(t *testing.T) {
+	var tests = []struct {
+		value string
+		want  string
+	}{
+		{"::", "COLON2"},
+		{"(", "L_PAREN"},
+		{"...", "DOT3"},
+		{"..=", "DOT2EQ"},
+		{"+=", "PLUSEQ"},
+		{"->", "THIN_ARROW"},
+		{"<=", "LTEQ"},
+		{"_", "UNDERSCORE"},
+	}
+	for _, tt := range tests {
+		if got := punctKindName(tt.value); got != tt.want {
+			t.Errorf("punctKindName(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct{ name, want string }{
+		{"BinExpr", "BIN_EXPR"},
+		{"GenericArgList", "GENERIC_ARG_LIST"},
+		{"ABCExpr", "ABC_EXPR"},
+		{"Name", "NAME"},
+	} {
+		if got := screamingSnake(tt.name); got != tt.want {
+			t.Errorf("screamingSnake(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSyntaxKinds(t *testing.T) {
+	g := mustParse(t, `
+Path = (qualifier:Path '::')? segment:PathSegment
+PathSegment = 'ident' | 'self' | 'Self' | '(' 'int_number' ')'
+`)
+	src, err := SyntaxKinds(g, Options{Package: "syntax"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := typeCheck(t, src)
+
+	wantKinds := []string{
+		"L_PAREN", "R_PAREN", "COLON2",
+		"SELF_UPPER_KW", "SELF_KW",
+		"IDENT", "INT_NUMBER",
+		"PATH", "PATH_SEGMENT",
+	}
+	for i, name := range wantKinds {
+		obj, ok := pkg.Scope().Lookup(name).(*types.Const)
+		if !ok {
+			t.Errorf("constant %s not generated", name)
+			continue
+		}
+		if v, _ := constant.Int64Val(obj.Val()); v != int64(i) {
+			t.Errorf("%s = %d, want %d", name, v, i)
+		}
+	}
+
+	for _, want := range []string{
+		"func (k SyntaxKind) IsPunct() bool {\n\treturn k >= L_PAREN && k <= COLON2\n}",
+		"func (k SyntaxKind) IsKeyword() bool {\n\treturn k >= SELF_UPPER_KW && k <= SELF_KW\n}",
+		"func (k SyntaxKind) IsLiteral() bool {\n\treturn k >= IDENT && k <= INT_NUMBER\n}",
+		"func (k SyntaxKind) IsNode() bool {\n\treturn k >= PATH && k <= PATH_SEGMENT\n}",
+		"\tcase SELF_UPPER_KW:\n\t\treturn \"Self\"\n",
+		"\tPATH_SEGMENT:  \"PATH_SEGMENT\",\n",
+	} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("generated code doesn't contain %q:\n%s", want, src)
+		}
+	}
+}
+
+func TestSyntaxKindsCollision(t *testing.T) {
+	g := mustParse(t, `Ident = 'ident'`)
+	_, err := SyntaxKinds(g, Options{})
+	want := "syntax kind IDENT of Ident collides with the one of 'ident'"
+	if err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %q", err, want)
+	}
+}
+
+func TestSyntaxKindsTestdata(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("..", "testdata", "*.ungrammar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			src, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := SyntaxKinds(mustParse(t, string(src)), Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			typeCheck(t, out)
+		})
+	}
+}
@@ -0,0 +1,265 @@
+// go-ungrammar: checking concrete syntax trees against grammars.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package ungrammar
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Tree is a node of a concrete syntax tree, as checked by Grammar.CheckTree.
+// Trees produced by any parser can be checked by wrapping their nodes in an
+// implementation of Tree.
+type Tree interface {
+	// Kind returns the kind of the node: the name of its rule for interior
+	// nodes, and the token's value in the grammar (like "ident" or "+",
+	// without quotes) for tokens.
+	Kind() string
+
+	// IsToken reports whether the node is a token (a leaf).
+	IsToken() bool
+
+	// Children returns the children of an interior node, in order.
+	Children() []Tree
+}
+
+// CheckTree checks that the concrete syntax tree rooted at root conforms to
+// g: that the children of each interior node of kind K match the rule K of g,
+// in the same way the rule matches a sequence of tokens when parsing:
+//
+//   - A Token rule matches a token child with the token's value as its kind.
+//   - A Node rule matches a child node of the rule's kind. If the rule is an
+//     alternation of rule names (like "Expr = Literal | BinExpr"), it also
+//     matches nodes of the kinds of the alternatives: syntax trees typically
+//     don't have a node for Expr above a BinExpr.
+//   - Seq, Alt, Opt and Rep match their sub-rules in order, one of them, at
+//     most once and any number of times, respectively; labels are ignored.
+//
+// Tokens whose kind is one of trivia (like whitespace or comments) are
+// skipped everywhere.
+//
+// CheckTree returns nil if the tree conforms to g, and an ErrorList with a
+// diagnostic for each node that doesn't otherwise. Diagnostics have
+// CodeTreeMismatch or CodeUnknownKind; their messages start with the path of
+// the node in the tree (like "SourceFile > Fn[2]", where 2 is the index of
+// the Fn node among the children of its parent) and state the rule fragments
+// expected at the first mismatching child. Their span is the span of the
+// first expected fragment in the grammar, or of the rule's name if the node
+// has extra children.
+func (g *Grammar) CheckTree(root Tree, trivia ...string) error {
+	tc := &treeChecker{g: g, trivia: trivia}
+	tc.check(root, root.Kind())
+	if len(tc.errs) > 0 {
+		return tc.errs
+	}
+	return nil
+}
+
+type treeChecker struct {
+	g      *Grammar
+	trivia []string
+	errs   ErrorList
+}
+
+func (tc *treeChecker) errorf(code Code, span Span, format string, args ...any) {
+	tc.errs.Add(&Diagnostic{
+		Severity: SeverityError,
+		Code:     code,
+		Span:     span,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// check checks the subtree rooted at t, whose path from the root is path.
+func (tc *treeChecker) check(t Tree, path string) {
+	if t.IsToken() {
+		return
+	}
+	rule, ok := tc.g.Rules[t.Kind()]
+	if !ok || rule == nil {
+		tc.errorf(CodeUnknownKind, Span{}, "%s: no rule for node kind %s", path, t.Kind())
+		return
+	}
+
+	var children []Tree
+	var indices []int
+	for i, c := range t.Children() {
+		if c.IsToken() && slices.Contains(tc.trivia, c.Kind()) {
+			continue
+		}
+		children = append(children, c)
+		indices = append(indices, i)
+	}
+
+	m := &treeMatcher{g: tc.g, children: children, farthest: -1}
+	ends := m.match(rule, 0)
+	if !slices.Contains(ends, len(children)) {
+		end := slices.Max(append(ends, -1))
+		switch {
+		case len(m.expected) == 0 && end < 0:
+			tc.errorf(CodeTreeMismatch, nameSpan(t.Kind(), tc.g.NameLoc[t.Kind()]), "%s: children don't match rule %s",
+				path, t.Kind())
+		case m.farthest >= end && m.farthest < len(children):
+			tc.errorf(CodeTreeMismatch, m.expected[0].Span(), "%s: unexpected %s at child %d, expected %s",
+				path, describeTree(children[m.farthest]), indices[m.farthest], describeExpected(m.expected))
+		case m.farthest >= end:
+			tc.errorf(CodeTreeMismatch, m.expected[0].Span(), "%s: missing %s after the last child",
+				path, describeExpected(m.expected))
+		default:
+			tc.errorf(CodeTreeMismatch, nameSpan(t.Kind(), tc.g.NameLoc[t.Kind()]), "%s: unexpected %s at child %d after the end of rule %s",
+				path, describeTree(children[end]), indices[end], t.Kind())
+		}
+	}
+
+	for i, c := range t.Children() {
+		tc.check(c, fmt.Sprintf("%s > %s[%d]", path, c.Kind(), i))
+	}
+}
+
+// describeTree describes a node in messages, like "node BinExpr" or "'+'".
+func describeTree(t Tree) string {
+	if t.IsToken() {
+		return fmt.Sprintf("'%s'", t.Kind())
+	}
+	return "node " + t.Kind()
+}
+
+func describeExpected(rules []Rule) string {
+	parts := make([]string, len(rules))
+	for i, r := range rules {
+		parts[i] = FormatRule(r)
+	}
+	return strings.Join(parts, " or ")
+}
+
+// treeMatcher matches the children of a node against rules. Since rules may
+// be ambiguous, match computes all the positions where a match can end.
+type treeMatcher struct {
+	g        *Grammar
+	children []Tree
+
+	// farthest is the highest child position at which a Node or Token rule
+	// was tried and didn't match, and expected lists the rules tried there.
+	farthest int
+	expected []Rule
+}
+
+// match returns the sorted positions in the children at which a match of r
+// starting at pos can end.
+func (m *treeMatcher) match(r Rule, pos int) []int {
+	switch rr := r.(type) {
+	case *Node, *Token:
+		if pos < len(m.children) && m.matchLeaf(rr, m.children[pos]) {
+			return []int{pos + 1}
+		}
+		m.fail(rr, pos)
+		return nil
+	case *Labeled:
+		switch rr.Rule.(type) {
+		case *Node, *Token:
+			// Report the label along with the rule if it doesn't match.
+			if pos < len(m.children) && m.matchLeaf(rr.Rule, m.children[pos]) {
+				return []int{pos + 1}
+			}
+			m.fail(rr, pos)
+			return nil
+		}
+		return m.match(rr.Rule, pos)
+	case *Seq:
+		ends := []int{pos}
+		for _, sub := range rr.Rules {
+			var next []int
+			for _, p := range ends {
+				next = append(next, m.match(sub, p)...)
+			}
+			ends = sortedSet(next)
+		}
+		return ends
+	case *Alt:
+		var ends []int
+		for _, sub := range rr.Rules {
+			ends = append(ends, m.match(sub, pos)...)
+		}
+		return sortedSet(ends)
+	case *Opt:
+		return sortedSet(append(m.match(rr.Rule, pos), pos))
+	case *Rep:
+		ends := []int{pos}
+		frontier := []int{pos}
+		for len(frontier) > 0 {
+			var next []int
+			for _, p := range frontier {
+				for _, e := range m.match(rr.Rule, p) {
+					if !slices.Contains(ends, e) && !slices.Contains(next, e) {
+						next = append(next, e)
+					}
+				}
+			}
+			ends = append(ends, next...)
+			frontier = next
+		}
+		return sortedSet(ends)
+	}
+	return nil
+}
+
+// matchLeaf reports whether the Node or Token rule r matches the child t.
+func (m *treeMatcher) matchLeaf(r Rule, t Tree) bool {
+	switch rr := r.(type) {
+	case *Token:
+		return t.IsToken() && t.Kind() == rr.Value
+	case *Node:
+		return !t.IsToken() && m.derives(rr.Name, t.Kind(), nil)
+	}
+	return false
+}
+
+// derives reports whether a reference to the rule name matches a node of the
+// given kind: if it's the same rule, or name is an alternation of rule names
+// one of which derives kind.
+func (m *treeMatcher) derives(name, kind string, seen []string) bool {
+	if name == kind {
+		return true
+	}
+	if slices.Contains(seen, name) {
+		return false
+	}
+	alt, ok := m.g.Rules[name].(*Alt)
+	if !ok {
+		return false
+	}
+	for _, sub := range alt.Rules {
+		if _, ok := sub.(*Node); !ok {
+			return false
+		}
+	}
+	for _, sub := range alt.Rules {
+		if m.derives(sub.(*Node).Name, kind, append(seen, name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// fail records that the rule r was expected at position pos.
+func (m *treeMatcher) fail(r Rule, pos int) {
+	switch {
+	case pos > m.farthest:
+		m.farthest = pos
+		m.expected = []Rule{r}
+	case pos == m.farthest:
+		if !slices.ContainsFunc(m.expected, func(e Rule) bool { return FormatRule(e) == FormatRule(r) }) {
+			m.expected = append(m.expected, r)
+		}
+	}
+}
+
+// sortedSet sorts positions and removes duplicates.
+func sortedSet(positions []int) []int {
+	slices.Sort(positions)
+	return slices.Compact(positions)
+}
@@ -0,0 +1,126 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package ungrammar
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testTree is a Tree written as an S-expression: tokens are quoted, and
+// nodes are written as "(Kind child...)".
+type testTree struct {
+	kind     string
+	isToken  bool
+	children []Tree
+}
+
+func (t *testTree) Kind() string     { return t.kind }
+func (t *testTree) IsToken() bool    { return t.isToken }
+func (t *testTree) Children() []Tree { return t.children }
+
+// parseTestTree parses an S-expression like "(Call 'f' '(' (Arg 'x') ')')".
+func parseTestTree(s string) Tree {
+	fields := strings.Fields(strings.NewReplacer("(", " ( ", ")", " ) ").Replace(s))
+	// Quoted parens are split by the replacer; rejoin them.
+	var toks []string
+	for i := 0; i < len(fields); i++ {
+		if fields[i] == "'" && i+2 < len(fields) && fields[i+2] == "'" {
+			toks = append(toks, "'"+fields[i+1]+"'")
+			i += 2
+		} else {
+			toks = append(toks, fields[i])
+		}
+	}
+
+	var parse func() Tree
+	parse = func() Tree {
+		tok := toks[0]
+		toks = toks[1:]
+		if tok != "(" {
+			return &testTree{kind: strings.Trim(tok, "'"), isToken: true}
+		}
+		node := &testTree{kind: toks[0]}
+		toks = toks[1:]
+		for toks[0] != ")" {
+			node.children = append(node.children, parse())
+		}
+		toks = toks[1:]
+		return node
+	}
+	return parse()
+}
+
+func TestCheckTree(t *testing.T) {
+	g, err := NewParser(`
+Program = Stmt*
+Stmt = Let | ExprStmt
+Let = 'let' name:'ident' ('=' Expr)? ';'
+ExprStmt = Expr ';'
+Expr = Literal | Call
+Call = Expr '(' (Expr (',' Expr)*)? ')'
+Literal = 'int' | 'ident'
+`).ParseGrammar()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		tree       string
+		wantErrors []string
+	}{
+		{`(Program)`, nil},
+		{`(Program (Let 'let' 'ident' ';') (Let 'let' 'ident' '=' (Literal 'int') ';'))`, nil},
+		{`(Program (ExprStmt (Call (Literal 'ident') '(' (Literal 'int') ',' (Call (Literal 'ident') '(' ')') ')') ';'))`, nil},
+
+		// Trivia is skipped.
+		{`(Program 'ws' (Let 'let' 'ws' 'ident' ';' 'comment'))`, nil},
+
+		{
+			`(Program (Let 'let' 'int' ';'))`,
+			[]string{"4:13: Program > Let[0]: unexpected 'int' at child 1, expected name:'ident'"},
+		},
+		{
+			`(Program (Let 'let' 'ident' '=' ';'))`,
+			[]string{"4:31: Program > Let[0]: unexpected ';' at child 3, expected Expr"},
+		},
+		{
+			`(Program (Let 'let' 'ident'))`,
+			[]string{"4:27: Program > Let[0]: missing '=' or ';' after the last child"},
+		},
+		{
+			`(Program (ExprStmt (Call (Literal 'ident') '(' (Literal 'int') (Literal 'int') ')') ';'))`,
+			[]string{"7:24: Program > ExprStmt[0] > Call[0]: unexpected node Literal at child 3, expected ',' or ')'"},
+		},
+		{
+			`(Program (ExprStmt (Literal 'int' 'int') ';') (Let 'let' 'ident'))`,
+			[]string{
+				"8:1: Program > ExprStmt[0] > Literal[0]: unexpected 'int' at child 1 after the end of rule Literal",
+				"4:27: Program > Let[1]: missing '=' or ';' after the last child",
+			},
+		},
+		{
+			`(Program (Nope 'x'))`,
+			[]string{
+				"2:11: Program: unexpected node Nope at child 0, expected Stmt",
+				"Program > Nope[0]: no rule for node kind Nope",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tree, func(t *testing.T) {
+			var gotErrors []string
+			if err := g.CheckTree(parseTestTree(tt.tree), "ws", "comment"); err != nil {
+				for _, d := range err.(ErrorList) {
+					gotErrors = append(gotErrors, d.Error())
+				}
+			}
+			if !slices.Equal(gotErrors, tt.wantErrors) {
+				t.Errorf("got errors:\n%s\nwant:\n%s", strings.Join(gotErrors, "\n"), strings.Join(tt.wantErrors, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+// go-ungrammar: green trees.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+// Package cst implements a generic representation of the concrete syntax
+// trees that Ungrammar grammars describe, modeled on the rowan library used by
+// rust-analyzer.
+//
+// Trees have two layers. The green tree is immutable and position-independent:
+// a GreenNode has a kind and children, and a GreenToken has a kind and text;
+// each knows only the length of its text. Green nodes can be shared freely
+// (even within a single tree), so copying a tree is just copying a pointer,
+// and "modifying" one creates a new tree sharing all the unchanged subtrees
+// with the old one.
+//
+// The red tree is a cursor layer on top of a green tree: a Node or Token is a
+// green element along with its parent and its absolute offset in the text, so
+// it supports navigation to parents and siblings, and has a text range. Red
+// nodes are created on demand while navigating, and are cheap to discard;
+// typed AST wrappers (like the ones generated by the codegen package) can be
+// built on top of them.
+//
+// Kinds are plain integers; their meaning is up to the user, for example a
+// SyntaxKind enumeration generated by codegen.SyntaxKinds.
+package cst
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kind is the kind of a node or token.
+type Kind uint16
+
+// GreenElement is either a *GreenNode or a *GreenToken.
+type GreenElement interface {
+	Kind() Kind
+
+	// TextLen returns the length of the element's text in bytes.
+	TextLen() int
+
+	// Text returns the text of the element.
+	Text() string
+
+	writeText(sb *strings.Builder)
+}
+
+// GreenToken is a leaf of a green tree. GreenTokens are immutable.
+type GreenToken struct {
+	kind Kind
+	text string
+}
+
+// NewGreenToken returns a new token with the given kind and text.
+func NewGreenToken(kind Kind, text string) *GreenToken {
+	return &GreenToken{kind: kind, text: text}
+}
+
+func (t *GreenToken) Kind() Kind {
+	return t.kind
+}
+
+func (t *GreenToken) TextLen() int {
+	return len(t.text)
+}
+
+func (t *GreenToken) Text() string {
+	return t.text
+}
+
+func (t *GreenToken) writeText(sb *strings.Builder) {
+	sb.WriteString(t.text)
+}
+
+func (t *GreenToken) String() string {
+	return fmt.Sprintf("%d%q", t.kind, t.text)
+}
+
+// GreenNode is an interior node of a green tree. GreenNodes are immutable;
+// the methods that modify them return new nodes instead.
+type GreenNode struct {
+	kind     Kind
+	children []GreenElement
+
+	// offsets[i] is the offset of children[i] relative to the start of the
+	// node.
+	offsets []int
+	textLen int
+}
+
+// NewGreenNode returns a new node with the given kind and children. The node
+// takes ownership of the children slice, which must not be modified
+// afterwards.
+func NewGreenNode(kind Kind, children []GreenElement) *GreenNode {
+	n := &GreenNode{kind: kind, children: children, offsets: make([]int, len(children))}
+	for i, c := range children {
+		n.offsets[i] = n.textLen
+		n.textLen += c.TextLen()
+	}
+	return n
+}
+
+func (n *GreenNode) Kind() Kind {
+	return n.kind
+}
+
+func (n *GreenNode) TextLen() int {
+	return n.textLen
+}
+
+// Children returns the child nodes and tokens of n, in order. The returned
+// slice must not be modified.
+func (n *GreenNode) Children() []GreenElement {
+	return n.children
+}
+
+func (n *GreenNode) Text() string {
+	var sb strings.Builder
+	n.writeText(&sb)
+	return sb.String()
+}
+
+func (n *GreenNode) writeText(sb *strings.Builder) {
+	for _, c := range n.children {
+		c.writeText(sb)
+	}
+}
+
+// String returns a debug representation of the subtree rooted at n, with
+// kinds written as numbers, e.g. `1(2"x" 3(2"y"))`.
+func (n *GreenNode) String() string {
+	parts := make([]string, len(n.children))
+	for i, c := range n.children {
+		parts[i] = fmt.Sprint(c)
+	}
+	return fmt.Sprintf("%d(%s)", n.kind, strings.Join(parts, " "))
+}
+
+// SpliceChildren returns a copy of n with its children in the range
+// [start, end) replaced by elems.
+func (n *GreenNode) SpliceChildren(start, end int, elems ...GreenElement) *GreenNode {
+	children := make([]GreenElement, 0, len(n.children)-(end-start)+len(elems))
+	children = append(children, n.children[:start]...)
+	children = append(children, elems...)
+	children = append(children, n.children[end:]...)
+	return NewGreenNode(n.kind, children)
+}
+
+// ReplaceChild returns a copy of n with its i-th child replaced by elem.
+func (n *GreenNode) ReplaceChild(i int, elem GreenElement) *GreenNode {
+	return n.SpliceChildren(i, i+1, elem)
+}
+
+// InsertChild returns a copy of n with elem inserted before its i-th child;
+// i may be the number of children, to append elem.
+func (n *GreenNode) InsertChild(i int, elem GreenElement) *GreenNode {
+	return n.SpliceChildren(i, i, elem)
+}
+
+// RemoveChild returns a copy of n without its i-th child.
+func (n *GreenNode) RemoveChild(i int) *GreenNode {
+	return n.SpliceChildren(i, i+1)
+}
+
+// Builder builds a green tree bottom-up, in the order of its text. Nodes are
+// opened with StartNode (or StartNodeAt, to wrap previously added children)
+// and closed with FinishNode, which creates the node from the children added
+// since it was opened; tokens are added to the innermost open node.
+//
+// A Builder interns tokens: tokens with the same kind and text share a single
+// GreenToken.
+type Builder struct {
+	// children holds the children of all the open nodes, outermost first;
+	// parents records the kind of each open node and the index in children
+	// where its own children start.
+	children []GreenElement
+	parents  []builderParent
+
+	tokens map[GreenToken]*GreenToken
+}
+
+type builderParent struct {
+	kind  Kind
+	first int
+}
+
+// Checkpoint is a position in a Builder, which can be passed to StartNodeAt.
+type Checkpoint int
+
+// NewBuilder returns a new, empty Builder.
+func NewBuilder() *Builder {
+	return &Builder{tokens: make(map[GreenToken]*GreenToken)}
+}
+
+// StartNode opens a new node with the given kind as a child of the current
+// node.
+func (b *Builder) StartNode(kind Kind) {
+	b.parents = append(b.parents, builderParent{kind, len(b.children)})
+}
+
+// Token adds a token to the current node.
+func (b *Builder) Token(kind Kind, text string) {
+	key := GreenToken{kind, text}
+	tok, ok := b.tokens[key]
+	if !ok {
+		tok = NewGreenToken(kind, text)
+		b.tokens[key] = tok
+	}
+	b.children = append(b.children, tok)
+}
+
+// Node adds a previously built node to the current node.
+func (b *Builder) Node(node *GreenNode) {
+	b.children = append(b.children, node)
+}
+
+// FinishNode closes the current node. It panics if there is no open node.
+func (b *Builder) FinishNode() {
+	if len(b.parents) == 0 {
+		panic("cst: FinishNode without a matching StartNode")
+	}
+	parent := b.parents[len(b.parents)-1]
+	b.parents = b.parents[:len(b.parents)-1]
+
+	children := make([]GreenElement, len(b.children)-parent.first)
+	copy(children, b.children[parent.first:])
+	b.children = append(b.children[:parent.first], NewGreenNode(parent.kind, children))
+}
+
+// Checkpoint returns the current position of the builder, to wrap the
+// children added after it in a node started later by StartNodeAt. This is
+// useful for left-recursive constructs, like binary expressions, whose kind
+// isn't known when their first child is built.
+func (b *Builder) Checkpoint() Checkpoint {
+	return Checkpoint(len(b.children))
+}
+
+// StartNodeAt opens a new node with the given kind, wrapping all the children
+// added to the current node since cp was taken; cp must have been taken while
+// the current node was open. It panics if cp precedes the start of the
+// current node.
+func (b *Builder) StartNodeAt(cp Checkpoint, kind Kind) {
+	if int(cp) > len(b.children) || (len(b.parents) > 0 && int(cp) < b.parents[len(b.parents)-1].first) {
+		panic("cst: checkpoint is no longer valid")
+	}
+	b.parents = append(b.parents, builderParent{kind, int(cp)})
+}
+
+// Finish returns the root of the tree built. It panics unless all nodes were
+// finished and exactly one node was built at the top level.
+func (b *Builder) Finish() *GreenNode {
+	if len(b.parents) != 0 {
+		panic("cst: Finish with unfinished nodes")
+	}
+	if len(b.children) != 1 {
+		panic(fmt.Sprintf("cst: Finish with %d top-level elements, want a single node", len(b.children)))
+	}
+	root, ok := b.children[0].(*GreenNode)
+	if !ok {
+		panic("cst: Finish with a top-level token, want a single node")
+	}
+	b.children = nil
+	return root
+}
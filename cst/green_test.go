@@ -0,0 +1,150 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package cst
+
+import (
+	"testing"
+)
+
+// Kinds used in tests.
+const (
+	kRoot Kind = iota
+	kBin
+	kParen
+	kNum
+	kPlus
+	kStar
+	kWS
+	kLParen
+	kRParen
+)
+
+var testKindNames = map[Kind]string{
+	kRoot:   "ROOT",
+	kBin:    "BIN",
+	kParen:  "PAREN",
+	kNum:    "NUM",
+	kPlus:   "PLUS",
+	kStar:   "STAR",
+	kWS:     "WS",
+	kLParen: "L_PAREN",
+	kRParen: "R_PAREN",
+}
+
+func kindName(k Kind) string {
+	return testKindNames[k]
+}
+
+// buildExpr builds the tree of "1 + (2*3)", with the binary expression
+// started at a checkpoint after its first operand.
+func buildExpr() *GreenNode {
+	b := NewBuilder()
+	b.StartNode(kRoot)
+	cp := b.Checkpoint()
+	b.Token(kNum, "1")
+	b.StartNodeAt(cp, kBin)
+	b.Token(kWS, " ")
+	b.Token(kPlus, "+")
+	b.Token(kWS, " ")
+	b.StartNode(kParen)
+	b.Token(kLParen, "(")
+	cp = b.Checkpoint()
+	b.Token(kNum, "2")
+	b.StartNodeAt(cp, kBin)
+	b.Token(kStar, "*")
+	b.Token(kNum, "3")
+	b.FinishNode()
+	b.Token(kRParen, ")")
+	b.FinishNode()
+	b.FinishNode()
+	b.FinishNode()
+	return b.Finish()
+}
+
+func TestBuilder(t *testing.T) {
+	root := buildExpr()
+	if got, want := root.Text(), "1 + (2*3)"; got != want {
+		t.Errorf("got text %q, want %q", got, want)
+	}
+	if got, want := root.TextLen(), 9; got != want {
+		t.Errorf("got length %d, want %d", got, want)
+	}
+	want := `0(1(3"1" 6" " 4"+" 6" " 2(7"(" 1(3"2" 5"*" 3"3") 8")")))`
+	if got := root.String(); got != want {
+		t.Errorf("got tree %s, want %s", got, want)
+	}
+
+	// Tokens are interned.
+	bin := root.Children()[0].(*GreenNode)
+	if bin.Children()[1] != bin.Children()[3] {
+		t.Errorf("identical whitespace tokens aren't shared")
+	}
+}
+
+func TestBuilderPanics(t *testing.T) {
+	var tests = []struct {
+		name  string
+		build func(b *Builder)
+	}{
+		{"FinishNode without StartNode", func(b *Builder) { b.FinishNode() }},
+		{"unfinished node", func(b *Builder) { b.StartNode(kRoot); b.Finish() }},
+		{"two roots", func(b *Builder) {
+			b.StartNode(kRoot)
+			b.FinishNode()
+			b.StartNode(kRoot)
+			b.FinishNode()
+			b.Finish()
+		}},
+		{"token root", func(b *Builder) { b.Token(kNum, "1"); b.Finish() }},
+		{"checkpoint outside current node", func(b *Builder) {
+			b.StartNode(kRoot)
+			cp := b.Checkpoint()
+			b.Token(kNum, "1")
+			b.StartNode(kBin)
+			b.StartNodeAt(cp, kBin)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("no panic")
+				}
+			}()
+			tt.build(NewBuilder())
+		})
+	}
+}
+
+func TestGreenEdits(t *testing.T) {
+	root := buildExpr()
+	bin := root.Children()[0].(*GreenNode)
+	paren := bin.Children()[4]
+
+	var tests = []struct {
+		node *GreenNode
+		want string
+	}{
+		{bin.ReplaceChild(0, NewGreenToken(kNum, "42")), "42 + (2*3)"},
+		{bin.InsertChild(5, NewGreenToken(kWS, " ")), "1 + (2*3) "},
+		{bin.RemoveChild(1), "1+ (2*3)"},
+		{bin.SpliceChildren(1, 5), "1"},
+	}
+	for _, tt := range tests {
+		if got := tt.node.Text(); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+		if got := tt.node.TextLen(); got != len(tt.want) {
+			t.Errorf("got length %d, want %d", got, len(tt.want))
+		}
+	}
+
+	// Edits don't modify the original, and share unchanged subtrees.
+	if got, want := root.Text(), "1 + (2*3)"; got != want {
+		t.Errorf("original changed to %q", got)
+	}
+	if tests[0].node.Children()[4] != paren {
+		t.Errorf("unchanged child isn't shared")
+	}
+}
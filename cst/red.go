@@ -0,0 +1,487 @@
+// go-ungrammar: red trees.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package cst
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TextRange is a range of byte offsets in the text of a tree, from Start
+// (inclusive) to End (exclusive).
+type TextRange struct {
+	Start int
+	End   int
+}
+
+// Len returns the length of the range.
+func (r TextRange) Len() int {
+	return r.End - r.Start
+}
+
+// Contains reports whether the offset off is inside the range.
+func (r TextRange) Contains(off int) bool {
+	return r.Start <= off && off < r.End
+}
+
+// ContainsRange reports whether other is inside the range.
+func (r TextRange) ContainsRange(other TextRange) bool {
+	return r.Start <= other.Start && other.End <= r.End
+}
+
+// String returns the range in the form "start..end".
+func (r TextRange) String() string {
+	return fmt.Sprintf("%d..%d", r.Start, r.End)
+}
+
+// Element is either a *Node or a *Token.
+type Element interface {
+	Kind() Kind
+	TextRange() TextRange
+	Text() string
+
+	// Parent returns the parent node of the element, or nil for the root.
+	Parent() *Node
+
+	// Index returns the index of the element among its parent's children.
+	Index() int
+}
+
+// Node is a node of a red tree: a GreenNode along with its position in the
+// tree. Nodes are created on demand while navigating the tree, so different
+// *Node values may refer to the same node; use Equal to compare them.
+type Node struct {
+	green  *GreenNode
+	parent *Node
+	index  int
+	offset int
+}
+
+// Token is a token of a red tree: a GreenToken along with its position in the
+// tree.
+type Token struct {
+	green  *GreenToken
+	parent *Node
+	index  int
+	offset int
+}
+
+// NewRoot returns the root of the red tree for green.
+func NewRoot(green *GreenNode) *Node {
+	return &Node{green: green}
+}
+
+func (n *Node) Kind() Kind {
+	return n.green.kind
+}
+
+// Green returns the green node underlying n.
+func (n *Node) Green() *GreenNode {
+	return n.green
+}
+
+func (n *Node) Parent() *Node {
+	return n.parent
+}
+
+func (n *Node) Index() int {
+	return n.index
+}
+
+func (n *Node) TextRange() TextRange {
+	return TextRange{n.offset, n.offset + n.green.textLen}
+}
+
+func (n *Node) Text() string {
+	return n.green.Text()
+}
+
+// Equal reports whether n and other refer to the same node of the same tree.
+func (n *Node) Equal(other *Node) bool {
+	if n == nil || other == nil {
+		return n == other
+	}
+	if n.parent == nil || other.parent == nil {
+		return n.parent == other.parent && n.green == other.green
+	}
+	return n.index == other.index && n.parent.Equal(other.parent)
+}
+
+// Root returns the root of the tree containing n.
+func (n *Node) Root() *Node {
+	for n.parent != nil {
+		n = n.parent
+	}
+	return n
+}
+
+// child returns the red element for the i-th child of n.
+func (n *Node) child(i int) Element {
+	offset := n.offset + n.green.offsets[i]
+	switch c := n.green.children[i].(type) {
+	case *GreenNode:
+		return &Node{green: c, parent: n, index: i, offset: offset}
+	case *GreenToken:
+		return &Token{green: c, parent: n, index: i, offset: offset}
+	}
+	return nil
+}
+
+// ChildrenWithTokens returns the child nodes and tokens of n, in order.
+func (n *Node) ChildrenWithTokens() []Element {
+	elems := make([]Element, len(n.green.children))
+	for i := range elems {
+		elems[i] = n.child(i)
+	}
+	return elems
+}
+
+// Children returns the child nodes of n, in order, skipping tokens.
+func (n *Node) Children() []*Node {
+	var nodes []*Node
+	for i, c := range n.green.children {
+		if _, ok := c.(*GreenNode); ok {
+			nodes = append(nodes, n.child(i).(*Node))
+		}
+	}
+	return nodes
+}
+
+// FirstChild returns the first child node of n, or nil if it has none.
+func (n *Node) FirstChild() *Node {
+	return n.nextChildNode(0, 1)
+}
+
+// LastChild returns the last child node of n, or nil if it has none.
+func (n *Node) LastChild() *Node {
+	return n.nextChildNode(len(n.green.children)-1, -1)
+}
+
+// FirstChildOrToken returns the first child of n, or nil if it has none.
+func (n *Node) FirstChildOrToken() Element {
+	if len(n.green.children) == 0 {
+		return nil
+	}
+	return n.child(0)
+}
+
+// LastChildOrToken returns the last child of n, or nil if it has none.
+func (n *Node) LastChildOrToken() Element {
+	if len(n.green.children) == 0 {
+		return nil
+	}
+	return n.child(len(n.green.children) - 1)
+}
+
+// nextChildNode returns the first child node of n at index i or after it in
+// direction dir (1 or -1), or nil if there is none.
+func (n *Node) nextChildNode(i, dir int) *Node {
+	for ; i >= 0 && i < len(n.green.children); i += dir {
+		if _, ok := n.green.children[i].(*GreenNode); ok {
+			return n.child(i).(*Node)
+		}
+	}
+	return nil
+}
+
+// NextSibling returns the next sibling node of n, or nil if there is none.
+func (n *Node) NextSibling() *Node {
+	if n.parent == nil {
+		return nil
+	}
+	return n.parent.nextChildNode(n.index+1, 1)
+}
+
+// PrevSibling returns the previous sibling node of n, or nil if there is none.
+func (n *Node) PrevSibling() *Node {
+	if n.parent == nil {
+		return nil
+	}
+	return n.parent.nextChildNode(n.index-1, -1)
+}
+
+// NextSiblingOrToken returns the next sibling of n, or nil if there is none.
+func (n *Node) NextSiblingOrToken() Element {
+	return siblingOrToken(n.parent, n.index+1)
+}
+
+// PrevSiblingOrToken returns the previous sibling of n, or nil if there is
+// none.
+func (n *Node) PrevSiblingOrToken() Element {
+	return siblingOrToken(n.parent, n.index-1)
+}
+
+func siblingOrToken(parent *Node, i int) Element {
+	if parent == nil || i < 0 || i >= len(parent.green.children) {
+		return nil
+	}
+	return parent.child(i)
+}
+
+// Ancestors returns n and its ancestors, innermost first.
+func (n *Node) Ancestors() []*Node {
+	var nodes []*Node
+	for ; n != nil; n = n.parent {
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+// Preorder calls f for n and each of its descendants (nodes and tokens) in
+// preorder. If f returns false for a node, its descendants are skipped.
+func (n *Node) Preorder(f func(Element) bool) {
+	if !f(n) {
+		return
+	}
+	for i := range n.green.children {
+		switch c := n.child(i).(type) {
+		case *Node:
+			c.Preorder(f)
+		case *Token:
+			f(c)
+		}
+	}
+}
+
+// Descendants returns n and all the nodes in its subtree, in preorder.
+func (n *Node) Descendants() []*Node {
+	var nodes []*Node
+	n.Preorder(func(e Element) bool {
+		if node, ok := e.(*Node); ok {
+			nodes = append(nodes, node)
+		}
+		return true
+	})
+	return nodes
+}
+
+// Tokens returns all the tokens in the subtree rooted at n, in order.
+func (n *Node) Tokens() []*Token {
+	var toks []*Token
+	n.Preorder(func(e Element) bool {
+		if tok, ok := e.(*Token); ok {
+			toks = append(toks, tok)
+		}
+		return true
+	})
+	return toks
+}
+
+// FirstToken returns the first token in the subtree rooted at n, or nil if
+// there is none.
+func (n *Node) FirstToken() *Token {
+	for i := range n.green.children {
+		switch c := n.child(i).(type) {
+		case *Token:
+			return c
+		case *Node:
+			if tok := c.FirstToken(); tok != nil {
+				return tok
+			}
+		}
+	}
+	return nil
+}
+
+// LastToken returns the last token in the subtree rooted at n, or nil if there
+// is none.
+func (n *Node) LastToken() *Token {
+	for i := len(n.green.children) - 1; i >= 0; i-- {
+		switch c := n.child(i).(type) {
+		case *Token:
+			return c
+		case *Node:
+			if tok := c.LastToken(); tok != nil {
+				return tok
+			}
+		}
+	}
+	return nil
+}
+
+// TokenAtOffset returns the token whose text range contains off, or nil if
+// off is outside n. At the end of n's range, it returns n's last token.
+func (n *Node) TokenAtOffset(off int) *Token {
+	if off == n.TextRange().End {
+		return n.LastToken()
+	}
+	tok, _ := n.CoveringElement(TextRange{off, off + 1}).(*Token)
+	return tok
+}
+
+// CoveringElement returns the innermost element whose text range contains r,
+// or nil if r is outside n. Empty elements are never returned for non-empty
+// ranges.
+func (n *Node) CoveringElement(r TextRange) Element {
+	if !n.TextRange().ContainsRange(r) {
+		return nil
+	}
+	var elem Element = n
+	for {
+		node, ok := elem.(*Node)
+		if !ok {
+			return elem
+		}
+		next := node.childCovering(r)
+		if next == nil {
+			return elem
+		}
+		elem = next
+	}
+}
+
+// childCovering returns the child of n whose range contains r, or nil.
+func (n *Node) childCovering(r TextRange) Element {
+	for i, c := range n.green.children {
+		start := n.offset + n.green.offsets[i]
+		cr := TextRange{start, start + c.TextLen()}
+		if cr.ContainsRange(r) && (cr.Len() > 0 || r.Len() == 0) {
+			return n.child(i)
+		}
+	}
+	return nil
+}
+
+// ReplaceWith returns the green root of a new tree, which is the tree
+// containing n with n replaced by green. The new tree shares all the
+// subtrees not on the path from n to the root with the old one.
+func (n *Node) ReplaceWith(green *GreenNode) *GreenNode {
+	for n.parent != nil {
+		green = n.parent.green.ReplaceChild(n.index, green)
+		n = n.parent
+	}
+	return green
+}
+
+// Dump returns a multi-line debug representation of the subtree rooted at n,
+// with each element on its own line, indented by depth, and followed by its
+// text range; tokens are followed by their text as well. kindName converts
+// kinds to strings; if it's nil, kinds are written as numbers. For example:
+//
+//	BIN_EXPR@0..5
+//	  INT_NUMBER@0..1 "1"
+//	  WHITESPACE@1..2 " "
+//	  PLUS@2..3 "+"
+//	  WHITESPACE@3..4 " "
+//	  INT_NUMBER@4..5 "2"
+func (n *Node) Dump(kindName func(Kind) string) string {
+	if kindName == nil {
+		kindName = func(k Kind) string { return fmt.Sprint(int(k)) }
+	}
+
+	var sb strings.Builder
+	depth := 0
+	var dump func(n *Node)
+	dump = func(n *Node) {
+		fmt.Fprintf(&sb, "%s%s@%s\n", strings.Repeat("  ", depth), kindName(n.Kind()), n.TextRange())
+		depth++
+		for _, c := range n.ChildrenWithTokens() {
+			switch cc := c.(type) {
+			case *Node:
+				dump(cc)
+			case *Token:
+				fmt.Fprintf(&sb, "%s%s@%s %q\n", strings.Repeat("  ", depth), kindName(cc.Kind()), cc.TextRange(), cc.Text())
+			}
+		}
+		depth--
+	}
+	dump(n)
+	return sb.String()
+}
+
+func (n *Node) String() string {
+	return n.Text()
+}
+
+func (t *Token) Kind() Kind {
+	return t.green.kind
+}
+
+// Green returns the green token underlying t.
+func (t *Token) Green() *GreenToken {
+	return t.green
+}
+
+func (t *Token) Parent() *Node {
+	return t.parent
+}
+
+func (t *Token) Index() int {
+	return t.index
+}
+
+func (t *Token) TextRange() TextRange {
+	return TextRange{t.offset, t.offset + len(t.green.text)}
+}
+
+func (t *Token) Text() string {
+	return t.green.text
+}
+
+func (t *Token) String() string {
+	return t.green.text
+}
+
+// Equal reports whether t and other refer to the same token of the same tree.
+func (t *Token) Equal(other *Token) bool {
+	if t == nil || other == nil {
+		return t == other
+	}
+	return t.index == other.index && t.offset == other.offset && t.parent.Equal(other.parent)
+}
+
+// NextSiblingOrToken returns the next sibling of t, or nil if there is none.
+func (t *Token) NextSiblingOrToken() Element {
+	return siblingOrToken(t.parent, t.index+1)
+}
+
+// PrevSiblingOrToken returns the previous sibling of t, or nil if there is
+// none.
+func (t *Token) PrevSiblingOrToken() Element {
+	return siblingOrToken(t.parent, t.index-1)
+}
+
+// Ancestors returns the ancestors of t, innermost first.
+func (t *Token) Ancestors() []*Node {
+	return t.parent.Ancestors()
+}
+
+// NextToken returns the token following t in the tree, or nil if t is the
+// last token.
+func (t *Token) NextToken() *Token {
+	return t.adjacentToken(1)
+}
+
+// PrevToken returns the token preceding t in the tree, or nil if t is the
+// first token.
+func (t *Token) PrevToken() *Token {
+	return t.adjacentToken(-1)
+}
+
+// adjacentToken returns the token following t in direction dir (1 or -1): the
+// first (or last) token of the nearest sibling of t or one of its ancestors
+// that has tokens.
+func (t *Token) adjacentToken(dir int) *Token {
+	parent, index := t.parent, t.index
+	for parent != nil {
+		for i := index + dir; i >= 0 && i < len(parent.green.children); i += dir {
+			switch c := parent.child(i).(type) {
+			case *Token:
+				return c
+			case *Node:
+				tok := c.FirstToken()
+				if dir < 0 {
+					tok = c.LastToken()
+				}
+				if tok != nil {
+					return tok
+				}
+			}
+		}
+		parent, index = parent.parent, parent.index
+	}
+	return nil
+}
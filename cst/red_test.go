@@ -0,0 +1,149 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package cst
+
+import (
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	root := NewRoot(buildExpr())
+	want := `ROOT@0..9
+  BIN@0..9
+    NUM@0..1 "1"
+    WS@1..2 " "
+    PLUS@2..3 "+"
+    WS@3..4 " "
+    PAREN@4..9
+      L_PAREN@4..5 "("
+      BIN@5..8
+        NUM@5..6 "2"
+        STAR@6..7 "*"
+        NUM@7..8 "3"
+      R_PAREN@8..9 ")"
+`
+	if got := root.Dump(kindName); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestNavigation(t *testing.T) {
+	root := NewRoot(buildExpr())
+	bin := root.FirstChild()
+	paren := bin.FirstChild()
+	inner := paren.FirstChild()
+
+	if paren.Kind() != kParen || inner.Kind() != kBin {
+		t.Fatalf("got kinds %s, %s", kindName(paren.Kind()), kindName(inner.Kind()))
+	}
+	if got, want := inner.TextRange(), (TextRange{5, 8}); got != want {
+		t.Errorf("got range %v, want %v", got, want)
+	}
+	if got := inner.Text(); got != "2*3" {
+		t.Errorf("got text %q", got)
+	}
+	if !inner.Parent().Parent().Equal(bin) || !inner.Root().Equal(root) {
+		t.Errorf("wrong parents")
+	}
+	if got := len(inner.Ancestors()); got != 4 {
+		t.Errorf("got %d ancestors, want 4", got)
+	}
+	if paren.NextSibling() != nil || paren.PrevSibling() != nil || bin.LastChild() == nil {
+		t.Errorf("wrong siblings of %v", paren)
+	}
+	if sib := paren.PrevSiblingOrToken(); sib.Kind() != kWS || sib.TextRange() != (TextRange{3, 4}) {
+		t.Errorf("got previous sibling %v", sib)
+	}
+	if got := len(root.Descendants()); got != 4 {
+		t.Errorf("got %d descendants, want 4", got)
+	}
+	if got := len(bin.ChildrenWithTokens()); got != 5 {
+		t.Errorf("got %d children, want 5", got)
+	}
+
+	var text string
+	for tok := root.FirstToken(); tok != nil; tok = tok.NextToken() {
+		text += tok.Text()
+	}
+	if text != root.Text() {
+		t.Errorf("got tokens %q forward", text)
+	}
+	text = ""
+	for tok := root.LastToken(); tok != nil; tok = tok.PrevToken() {
+		text = tok.Text() + text
+	}
+	if text != root.Text() {
+		t.Errorf("got tokens %q backward", text)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	// Two positions sharing an empty green node at the same offset.
+	empty := NewGreenNode(kParen, nil)
+	root := NewRoot(NewGreenNode(kRoot, []GreenElement{empty, empty}))
+	first, second := root.FirstChild(), root.LastChild()
+	if first.Equal(second) {
+		t.Errorf("got equal distinct nodes %v and %v", first, second)
+	}
+	if !first.Equal(second.PrevSibling()) || !root.Equal(first.Parent()) {
+		t.Errorf("got unequal references to the same node")
+	}
+}
+
+func TestOffsets(t *testing.T) {
+	root := NewRoot(buildExpr())
+
+	for off, want := range "1 + (2*3)" {
+		tok := root.TokenAtOffset(off)
+		if tok == nil || tok.Text() != string(want) || !tok.TextRange().Contains(off) {
+			t.Errorf("TokenAtOffset(%d) = %v, want %q", off, tok, want)
+		}
+	}
+	if tok := root.TokenAtOffset(9); tok == nil || tok.Text() != ")" {
+		t.Errorf("TokenAtOffset(9) = %v, want )", tok)
+	}
+	if tok := root.TokenAtOffset(10); tok != nil {
+		t.Errorf("TokenAtOffset(10) = %v, want nil", tok)
+	}
+
+	var tests = []struct {
+		r        TextRange
+		wantKind Kind
+		wantText string
+	}{
+		{TextRange{5, 8}, kBin, "2*3"},
+		{TextRange{5, 7}, kBin, "2*3"},
+		{TextRange{4, 6}, kParen, "(2*3)"},
+		{TextRange{2, 3}, kPlus, "+"},
+		{TextRange{0, 9}, kBin, "1 + (2*3)"},
+	}
+	for _, tt := range tests {
+		elem := root.CoveringElement(tt.r)
+		if elem == nil || elem.Kind() != tt.wantKind || elem.Text() != tt.wantText {
+			t.Errorf("CoveringElement(%v) = %v, want %s %q", tt.r, elem, kindName(tt.wantKind), tt.wantText)
+		}
+	}
+}
+
+func TestReplaceWith(t *testing.T) {
+	green := buildExpr()
+	root := NewRoot(green)
+	inner := root.FirstChild().FirstChild().FirstChild()
+
+	b := NewBuilder()
+	b.StartNode(kNum)
+	b.Token(kNum, "6")
+	b.FinishNode()
+	newRoot := NewRoot(inner.ReplaceWith(b.Finish()))
+
+	if got, want := newRoot.Text(), "1 + (6)"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := root.Text(), "1 + (2*3)"; got != want {
+		t.Errorf("original changed to %q", got)
+	}
+	if tok := newRoot.TokenAtOffset(6); tok == nil || tok.Text() != ")" || tok.TextRange() != (TextRange{6, 7}) {
+		t.Errorf("got token %v after replacement", tok)
+	}
+}
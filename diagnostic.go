@@ -0,0 +1,193 @@
+// go-ungrammar: structured diagnostics.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package ungrammar
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Severity is the severity of a Diagnostic.
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// Code identifies the kind of problem a Diagnostic reports, so that callers
+// can act on diagnostics without matching their messages.
+type Code string
+
+const (
+	// Lexical errors
+	CodeUnknownToken      Code = "unknown-token"
+	CodeUnterminatedToken Code = "unterminated-token"
+
+	// Syntax errors
+	CodeExpectedNamedRule Code = "expected-named-rule"
+	CodeExpectedRule      Code = "expected-rule"
+	CodeExpectedRParen    Code = "expected-rparen"
+	CodeDuplicateRule     Code = "duplicate-rule"
+
+	// Semantic errors and warnings, reported by Grammar.Validate
+	CodeUndefinedRule   Code = "undefined-rule"
+	CodeUndefinedRoot   Code = "undefined-root"
+	CodeUnusedRule      Code = "unused-rule"
+	CodeUnreachableRule Code = "unreachable-rule"
+
+	// Errors in syntax trees, reported by Grammar.CheckTree
+	CodeTreeMismatch Code = "tree-mismatch"
+	CodeUnknownKind  Code = "unknown-kind"
+)
+
+// Diagnostic is a problem found in Ungrammar source. Diagnostic implements
+// the error interface.
+type Diagnostic struct {
+	Severity Severity
+	Code     Code
+
+	// Span is the range of source the diagnostic applies to. It may be invalid
+	// for diagnostics not tied to a location in the source.
+	Span    Span
+	Message string
+
+	// Related lists other locations relevant to the diagnostic, e.g. the
+	// previous definition of a rule that's defined twice.
+	Related []Related
+
+	// Fixes lists suggested fixes for the problem.
+	Fixes []Fix
+}
+
+// Related is a source location related to a Diagnostic, with a message
+// explaining the relation.
+type Related struct {
+	Span    Span
+	Message string
+}
+
+// Fix is a suggested fix for a Diagnostic: a description and the edits
+// implementing it.
+type Fix struct {
+	Message string
+	Edits   []TextEdit
+}
+
+// TextEdit replaces the source in Span with NewText. Insertions have an empty
+// span (Start == End).
+type TextEdit struct {
+	Span    Span
+	NewText string
+}
+
+// Error returns the diagnostic in the form "position: message", or just the
+// message if the diagnostic has no position.
+func (d *Diagnostic) Error() string {
+	if !d.Span.Start.IsValid() && d.Span.Start.Filename == "" {
+		return d.Message
+	}
+	return fmt.Sprintf("%s: %s", d.Span.Start, d.Message)
+}
+
+// Render writes d to w in a compiler-style format, with snippets of the
+// source src showing the diagnostic's span (and related spans) underlined.
+// src should be the source the diagnostic was reported on. For example:
+//
+//	error[undefined-rule]: undefined rule Exp
+//	 --> grammar.ungrammar:3:5
+//	  |
+//	3 | x = Exp '+' Expr
+//	  |     ^^^
+//	  = help: replace with Expr
+func (d *Diagnostic) Render(w io.Writer, src string) {
+	fmt.Fprintf(w, "%s[%s]: %s\n", d.Severity, d.Code, d.Message)
+	renderSnippet(w, src, d.Span, '^')
+	for _, rel := range d.Related {
+		fmt.Fprintf(w, "note: %s\n", rel.Message)
+		renderSnippet(w, src, rel.Span, '-')
+	}
+	for _, fix := range d.Fixes {
+		fmt.Fprintf(w, "  = help: %s\n", fix.Message)
+	}
+}
+
+// Render writes all the diagnostics in el to w, as Diagnostic.Render does,
+// separated by empty lines.
+func (el ErrorList) Render(w io.Writer, src string) {
+	for i, d := range el {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		d.Render(w, src)
+	}
+}
+
+// renderSnippet writes the position of span and the source line it starts on
+// to w, underlining the span with the marker rune. Spans that continue past
+// their first line are underlined to the end of the line.
+func renderSnippet(w io.Writer, src string, span Span, marker rune) {
+	start := span.Start
+	if !start.IsValid() {
+		return
+	}
+	lineNum := fmt.Sprint(start.Line)
+	gutter := strings.Repeat(" ", len(lineNum))
+	fmt.Fprintf(w, "%s--> %s\n", gutter, start)
+	if start.Offset > len(src) {
+		return
+	}
+
+	lineStart := strings.LastIndexByte(src[:start.Offset], '\n') + 1
+	lineEnd := strings.IndexByte(src[start.Offset:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(src)
+	} else {
+		lineEnd += start.Offset
+	}
+	line := strings.TrimRight(src[lineStart:lineEnd], "\r")
+
+	// Spans starting in a trailing "\r" (like errors at the end of the input)
+	// start past the trimmed line.
+	end := min(max(span.End.Offset, start.Offset), lineStart+len(line))
+	end = max(end, start.Offset)
+	width := max(utf8.RuneCountInString(src[start.Offset:end]), 1)
+
+	// Reproduce tabs in the underline's indentation so it aligns with the line.
+	var indent strings.Builder
+	for _, r := range src[lineStart:start.Offset] {
+		if r == '\t' {
+			indent.WriteRune('\t')
+		} else {
+			indent.WriteRune(' ')
+		}
+	}
+
+	fmt.Fprintf(w, "%s |\n", gutter)
+	fmt.Fprintf(w, "%s | %s\n", lineNum, line)
+	fmt.Fprintf(w, "%s | %s%s\n", gutter, indent.String(), strings.Repeat(string(marker), width))
+}
+
+// nameSpan returns the span of a rule name starting at pos.
+func nameSpan(name string, pos Pos) Span {
+	end := pos
+	end.Offset += len(name)
+	end.Column += utf8.RuneCountInString(name)
+	return Span{pos, end}
+}
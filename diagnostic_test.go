@@ -0,0 +1,178 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package ungrammar
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseDiagnosticCodes(t *testing.T) {
+	var tests = []struct {
+		input    string
+		wantCode Code
+		wantSpan string
+	}{
+		{`x = a b = c #`, CodeUnknownToken, "1:13-1:14"},
+		{`x = 'abc`, CodeUnterminatedToken, "1:5-1:9"},
+		{`x = | b`, CodeExpectedRule, "1:5-1:6"},
+		{`x = l: = a`, CodeExpectedRule, "1:8-1:9"},
+		{`x = (a b = c`, CodeExpectedRParen, "1:8-1:9"},
+		{`'t' x = a`, CodeExpectedNamedRule, "1:1-1:4"},
+		{`x = a x = b`, CodeDuplicateRule, "1:7-1:8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := NewParser(tt.input).ParseGrammar()
+			var d *Diagnostic
+			if !errors.As(err, &d) {
+				t.Fatalf("got error %v, want a *Diagnostic", err)
+			}
+			if d.Code != tt.wantCode {
+				t.Errorf("got code %v, want %v", d.Code, tt.wantCode)
+			}
+			if d.Severity != SeverityError {
+				t.Errorf("got severity %v, want error", d.Severity)
+			}
+			if got := d.Span.String(); got != tt.wantSpan {
+				t.Errorf("got span %v, want %v", got, tt.wantSpan)
+			}
+		})
+	}
+}
+
+func TestDuplicateRuleRelated(t *testing.T) {
+	_, err := NewParser("x = a\nx = b").ParseGrammar()
+	errs := err.(ErrorList)
+	if len(errs) != 1 || len(errs[0].Related) != 1 {
+		t.Fatalf("got %#v, want one diagnostic with a related location", errs)
+	}
+	rel := errs[0].Related[0]
+	if rel.Span.String() != "1:1-1:2" || rel.Message != "x previously defined here" {
+		t.Errorf("got related %v %q", rel.Span, rel.Message)
+	}
+}
+
+func TestValidateDiagnostics(t *testing.T) {
+	g, err := NewParser(`Expr = Atom '+' Exp Atom = 'a' Unused = Atom`).ParseGrammar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := g.Validate("Expr").(ErrorList)
+	if len(errs) != 2 {
+		t.Fatalf("got %d diagnostics, want 2: %v", len(errs), errs)
+	}
+	if !errs.HasErrors() {
+		t.Errorf("got HasErrors false, want true")
+	}
+
+	undef := errs[0]
+	if undef.Code != CodeUndefinedRule || undef.Severity != SeverityError {
+		t.Errorf("got %v %v, want undefined rule error", undef.Code, undef.Severity)
+	}
+	if len(undef.Fixes) != 1 || undef.Fixes[0].Message != "replace with Expr" {
+		t.Fatalf("got fixes %v, want replace with Expr", undef.Fixes)
+	}
+	edit := undef.Fixes[0].Edits[0]
+	if edit.NewText != "Expr" || edit.Span != undef.Span {
+		t.Errorf("got edit %v, want replacement of %v", edit, undef.Span)
+	}
+
+	unused := errs[1]
+	if unused.Code != CodeUnusedRule || unused.Severity != SeverityWarning {
+		t.Errorf("got %v %v, want unused rule warning", unused.Code, unused.Severity)
+	}
+	if got := unused.Span.String(); got != "1:32-1:38" {
+		t.Errorf("got span %v, want 1:32-1:38", got)
+	}
+
+	// Only warnings.
+	warnings := ErrorList{unused}
+	if warnings.HasErrors() {
+		t.Errorf("got HasErrors true for warnings only")
+	}
+}
+
+func TestClosestName(t *testing.T) {
+	names := []string{"Expr", "Statement", "Item", "x"}
+	var tests = []struct {
+		name string
+		want string
+	}{
+		{"Exp", "Expr"},
+		{"Stmt", ""},
+		{"Statment", "Statement"},
+		{"item", "Item"},
+		{"y", ""},
+		{"Foo", ""},
+	}
+
+	for _, tt := range tests {
+		if got := closestName(tt.name, names); got != tt.want {
+			t.Errorf("closestName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestErrorListSort(t *testing.T) {
+	at := func(offset int, msg string) *Diagnostic {
+		pos := Pos{Offset: offset, Line: 1, Column: offset + 1}
+		return &Diagnostic{Span: Span{pos, pos}, Message: msg}
+	}
+	el := ErrorList{at(5, "b"), at(1, "a"), at(5, "a"), at(5, "b"), at(1, "a")}
+	el.RemoveDuplicates()
+
+	var got []string
+	for _, d := range el {
+		got = append(got, d.Error())
+	}
+	want := "1:2: a|1:6: a|1:6: b"
+	if strings.Join(got, "|") != want {
+		t.Errorf("got %v, want %v", strings.Join(got, "|"), want)
+	}
+}
+
+func TestRender(t *testing.T) {
+	src := "Expr =\n  Atom '+'\tExp\nAtom = 'a'\n"
+	g, err := NewFileParser("g.ungrammar", src).ParseGrammar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	g.Validate("Expr").(ErrorList).Render(&sb, src)
+
+	want := `error[undefined-rule]: undefined rule Exp
+ --> g.ungrammar:2:12
+  |
+2 |   Atom '+'	Exp
+  |           	^^^
+  = help: replace with Expr
+`
+	if got := sb.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// An error at the end of input following a "\r" starts past the line
+// without its line terminator.
+func TestRenderEOFAfterCR(t *testing.T) {
+	src := "A = (B\r"
+	_, err := NewParser(src).ParseGrammar()
+	if err == nil {
+		t.Fatal("got no error")
+	}
+	var sb strings.Builder
+	err.(ErrorList).Render(&sb, src)
+
+	want := "error[expected-rparen]: expected ')', got <end of input>\n" +
+		" --> 1:7\n" +
+		"  |\n" +
+		"1 | A = (B\n" +
+		"  |        ^\n"
+	if got := sb.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,322 @@
+// go-ungrammar: grammar reference documentation.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+// Package docgen generates reference documentation for grammars, in Markdown
+// or as a static HTML page, e.g. for checking into a documentation site.
+//
+// The documentation starts with the grammar's file doc comment and a table of
+// contents, followed by a section per rule in the order of the grammar's
+// OrderedNames: the rule's doc comment, its definition in Ungrammar syntax
+// (with the doc comments of its alternatives and labels) in which references
+// to rules link to their sections, and the list of the rules that use it. It
+// ends with an inventory of the tokens of the grammar, with the rules using
+// each token.
+//
+// The section of rule R has the anchor "R", and the token inventory has the
+// anchor "tokens".
+package docgen
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"slices"
+	"strings"
+
+	"github.com/eliben/go-ungrammar"
+	"github.com/eliben/go-ungrammar/codegen"
+	"github.com/eliben/go-ungrammar/graph"
+	"github.com/eliben/go-ungrammar/railroad"
+)
+
+// Format is the output format of Generate.
+type Format int
+
+const (
+	Markdown Format = iota
+	HTML
+)
+
+// Options configures Generate.
+type Options struct {
+	Format Format
+
+	// Title is the title of the documentation; the default is "Grammar
+	// reference".
+	Title string
+
+	// Diagrams adds a railroad diagram of each rule to its section (see
+	// package railroad); only for HTML.
+	Diagrams bool
+}
+
+// Generate returns the reference documentation of g. It returns an error if
+// g contains nil rules, which happens for grammars parsed with errors.
+func Generate(g *ungrammar.Grammar, opts Options) ([]byte, error) {
+	if opts.Title == "" {
+		opts.Title = "Grammar reference"
+	}
+	d := &docs{g: g, opts: opts, usedBy: make(map[string][]string)}
+	for _, e := range graph.Edges(g) {
+		if !slices.Contains(d.usedBy[e.To], e.From) {
+			d.usedBy[e.To] = append(d.usedBy[e.To], e.From)
+		}
+	}
+	d.collectTokens()
+
+	var sections []section
+	for _, name := range g.OrderedNames() {
+		s, err := d.ruleSection(name)
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, s)
+	}
+
+	if opts.Format == HTML {
+		return d.html(sections), nil
+	}
+	return d.markdown(sections), nil
+}
+
+type docs struct {
+	g    *ungrammar.Grammar
+	opts Options
+
+	// usedBy maps rule names to the names of the rules referencing them.
+	usedBy map[string][]string
+
+	// tokens lists the token values of the grammar in order of first
+	// appearance, and tokenUsers maps them to the rules using them.
+	tokens     []string
+	tokenUsers map[string][]string
+}
+
+// section is the documentation of a rule; definition is its definition in
+// Ungrammar syntax, as HTML with links to referenced rules.
+type section struct {
+	name       string
+	doc        string
+	definition string
+}
+
+func (d *docs) collectTokens() {
+	d.tokenUsers = make(map[string][]string)
+	for _, name := range d.g.OrderedNames() {
+		r := d.g.Rules[name]
+		if r == nil {
+			continue
+		}
+		ungrammar.Inspect(r, func(r ungrammar.Rule) bool {
+			if tok, ok := r.(*ungrammar.Token); ok {
+				if _, ok := d.tokenUsers[tok.Value]; !ok {
+					d.tokens = append(d.tokens, tok.Value)
+				}
+				if !slices.Contains(d.tokenUsers[tok.Value], name) {
+					d.tokenUsers[tok.Value] = append(d.tokenUsers[tok.Value], name)
+				}
+			}
+			return true
+		})
+	}
+}
+
+func (d *docs) ruleSection(name string) (section, error) {
+	// Format the rule on its own, without its doc comment.
+	single := &ungrammar.Grammar{
+		Rules: map[string]ungrammar.Rule{name: d.g.Rules[name]},
+		Names: []string{name},
+	}
+	var buf bytes.Buffer
+	if err := single.Format(&buf); err != nil {
+		return section{}, err
+	}
+	return section{
+		name:       name,
+		doc:        d.g.Docs[name],
+		definition: linkify(strings.TrimSuffix(buf.String(), "\n"), d.link),
+	}, nil
+}
+
+// link returns the link to the section of the rule name, or "" if there's no
+// such rule.
+func (d *docs) link(name string) string {
+	if _, ok := d.g.Rules[name]; !ok {
+		return ""
+	}
+	return "#" + name
+}
+
+// linkify returns the Ungrammar text src as HTML, with the names of rules
+// referenced in it linked to link(name); names for which link returns "" are
+// left alone.
+func linkify(src string, link func(name string) string) string {
+	var sb strings.Builder
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\'':
+			j := i + 1
+			for j < len(src) && src[j] != '\'' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			j = min(j+1, len(src))
+			sb.WriteString(escapeText(src[i:j]))
+			i = j
+		case strings.HasPrefix(src[i:], "//"):
+			j := strings.IndexByte(src[i:], '\n')
+			if j < 0 {
+				j = len(src) - i
+			}
+			sb.WriteString(escapeText(src[i : i+j]))
+			i += j
+		case isNameChar(c):
+			j := i
+			for j < len(src) && isNameChar(src[j]) {
+				j++
+			}
+			name := src[i:j]
+			// Names followed by ':' are labels, and by '=' the rule's own name.
+			k := j
+			for k < len(src) && src[k] == ' ' {
+				k++
+			}
+			if target := link(name); target != "" && (k == len(src) || (src[k] != ':' && src[k] != '=')) {
+				fmt.Fprintf(&sb, `<a href="%s">%s</a>`, html.EscapeString(target), name)
+			} else {
+				sb.WriteString(name)
+			}
+			i = j
+		default:
+			sb.WriteString(escapeText(string(c)))
+			i++
+		}
+	}
+	return sb.String()
+}
+
+// textEscaper escapes text content in HTML; unlike html.EscapeString it
+// leaves quotes alone, which keeps tokens readable in the Markdown source.
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// markdownLinks returns links to the sections of the given rules, separated
+// by commas.
+func markdownLinks(names []string, link func(string) string) string {
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("[%s](%s)", name, link(name))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (d *docs) markdown(sections []section) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# %s\n\n", d.opts.Title)
+	if d.g.Doc != "" {
+		fmt.Fprintf(&buf, "%s\n\n", d.g.Doc)
+	}
+	for _, s := range sections {
+		fmt.Fprintf(&buf, "* [%s](#%s)\n", s.name, s.name)
+	}
+	buf.WriteString("* [Tokens](#tokens)\n")
+
+	for _, s := range sections {
+		fmt.Fprintf(&buf, "\n<a id=\"%s\"></a>\n\n## %s\n\n", s.name, s.name)
+		if s.doc != "" {
+			fmt.Fprintf(&buf, "%s\n\n", s.doc)
+		}
+		fmt.Fprintf(&buf, "<pre>\n%s\n</pre>\n", s.definition)
+		if users := d.usedBy[s.name]; len(users) > 0 {
+			fmt.Fprintf(&buf, "\nUsed by: %s\n", markdownLinks(users, d.link))
+		}
+	}
+
+	buf.WriteString("\n<a id=\"tokens\"></a>\n\n## Tokens\n\n")
+	buf.WriteString("| Token | Class | Used by |\n| --- | --- | --- |\n")
+	for _, tok := range d.tokens {
+		// Escape pipes, which would split table cells.
+		value := strings.ReplaceAll(tok, "|", `\|`)
+		fmt.Fprintf(&buf, "| `%s` | %s | %s |\n", value, codegen.ClassifyToken(tok), markdownLinks(d.tokenUsers[tok], d.link))
+	}
+	return buf.Bytes()
+}
+
+// htmlStyle is the stylesheet of HTML documentation.
+const htmlStyle = `
+body { font-family: sans-serif; max-width: 60em; margin: auto; }
+pre { background: #f4f4f4; padding: 0.5em; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 0.2em 0.5em; text-align: left; }
+`
+
+// htmlLinks returns HTML links to the sections of the given rules, separated
+// by commas.
+func htmlLinks(names []string, link func(string) string) string {
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf(`<a href="%s">%s</a>`, link(name), name)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// htmlParagraphs returns doc as HTML paragraphs, separated by empty lines in
+// doc.
+func htmlParagraphs(doc string) string {
+	var sb strings.Builder
+	for _, para := range strings.Split(doc, "\n\n") {
+		fmt.Fprintf(&sb, "<p>%s</p>\n", escapeText(para))
+	}
+	return sb.String()
+}
+
+func (d *docs) html(sections []section) []byte {
+	var buf bytes.Buffer
+	title := html.EscapeString(d.opts.Title)
+	fmt.Fprintf(&buf, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>%s</style>\n</head>\n<body>\n",
+		title, htmlStyle)
+	fmt.Fprintf(&buf, "<h1>%s</h1>\n", title)
+	if d.g.Doc != "" {
+		buf.WriteString(htmlParagraphs(d.g.Doc))
+	}
+	buf.WriteString("<ul>\n")
+	for _, s := range sections {
+		fmt.Fprintf(&buf, "<li><a href=\"#%[1]s\">%[1]s</a></li>\n", s.name)
+	}
+	buf.WriteString("<li><a href=\"#tokens\">Tokens</a></li>\n</ul>\n")
+
+	for _, s := range sections {
+		fmt.Fprintf(&buf, "<section id=\"%[1]s\">\n<h2>%[1]s</h2>\n", s.name)
+		if s.doc != "" {
+			buf.WriteString(htmlParagraphs(s.doc))
+		}
+		if d.opts.Diagrams {
+			buf.Write(railroad.SVG(d.g.Rules[s.name], railroad.Options{Link: d.link}))
+		}
+		fmt.Fprintf(&buf, "<pre>\n%s\n</pre>\n", s.definition)
+		if users := d.usedBy[s.name]; len(users) > 0 {
+			fmt.Fprintf(&buf, "<p>Used by: %s</p>\n", htmlLinks(users, d.link))
+		}
+		buf.WriteString("</section>\n")
+	}
+
+	buf.WriteString("<section id=\"tokens\">\n<h2>Tokens</h2>\n<table>\n<tr><th>Token</th><th>Class</th><th>Used by</th></tr>\n")
+	for _, tok := range d.tokens {
+		fmt.Fprintf(&buf, "<tr><td><code>%s</code></td><td>%s</td><td>%s</td></tr>\n",
+			escapeText(tok), codegen.ClassifyToken(tok), htmlLinks(d.tokenUsers[tok], d.link))
+	}
+	buf.WriteString("</table>\n</section>\n</body>\n</html>\n")
+	return buf.Bytes()
+}
@@ -0,0 +1,163 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package docgen
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/eliben/go-ungrammar"
+)
+
+func mustParse(t *testing.T, input string) *ungrammar.Grammar {
+	t.Helper()
+	g, err := ungrammar.NewParser(input).ParseGrammar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+const testGrammar = `// A tiny language.
+
+// An expression.
+Expr =
+  // A literal.
+  Literal
+| BinExpr
+
+BinExpr = lhs:Expr op:('<' | '||') rhs:Expr
+
+Literal = 'number' Suffix?
+`
+
+func TestMarkdown(t *testing.T) {
+	got, err := Generate(mustParse(t, testGrammar), Options{Title: "Tiny"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# Tiny
+
+A tiny language.
+
+* [Expr](#Expr)
+* [BinExpr](#BinExpr)
+* [Literal](#Literal)
+* [Tokens](#tokens)
+
+<a id="Expr"></a>
+
+## Expr
+
+An expression.
+
+<pre>
+Expr =
+  // A literal.
+  <a href="#Literal">Literal</a>
+| <a href="#BinExpr">BinExpr</a>
+</pre>
+
+Used by: [BinExpr](#BinExpr)
+
+<a id="BinExpr"></a>
+
+## BinExpr
+
+<pre>
+BinExpr =
+  lhs:<a href="#Expr">Expr</a> op:('&lt;' | '||') rhs:<a href="#Expr">Expr</a>
+</pre>
+
+Used by: [Expr](#Expr)
+
+<a id="Literal"></a>
+
+## Literal
+
+<pre>
+Literal =
+  'number' Suffix?
+</pre>
+
+Used by: [Expr](#Expr)
+
+<a id="tokens"></a>
+
+## Tokens
+
+| Token | Class | Used by |
+| --- | --- | --- |
+| ` + "`<`" + ` | punctuation | [BinExpr](#BinExpr) |
+| ` + "`\\|\\|`" + ` | punctuation | [BinExpr](#BinExpr) |
+| ` + "`number`" + ` | keyword | [Literal](#Literal) |
+`
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestHTML(t *testing.T) {
+	g := mustParse(t, testGrammar)
+	got, err := Generate(g, Options{Format: HTML, Diagrams: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(got)
+	for _, want := range []string{
+		"<title>Grammar reference</title>",
+		"<p>A tiny language.</p>",
+		"<section id=\"Expr\">\n<h2>Expr</h2>\n<p>An expression.</p>\n<svg",
+		`lhs:<a href="#Expr">Expr</a> op:('&lt;' | '||')`,
+		`<p>Used by: <a href="#BinExpr">BinExpr</a></p>`,
+		`<tr><td><code>&lt;</code></td><td>punctuation</td><td><a href="#BinExpr">BinExpr</a></td></tr>`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page doesn't contain %q", want)
+		}
+	}
+	if n := strings.Count(page, "<svg"); n != 3 {
+		t.Errorf("got %d diagrams, want 3", n)
+	}
+
+	got, err = Generate(g, Options{Format: HTML})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(got), "<svg") {
+		t.Errorf("got diagrams without Options.Diagrams")
+	}
+}
+
+func TestLinkify(t *testing.T) {
+	link := func(name string) string {
+		if name == "Name" || name == "label" {
+			return "#" + name
+		}
+		return ""
+	}
+	var tests = []struct {
+		input string
+		want  string
+	}{
+		{"Name", `<a href="#Name">Name</a>`},
+		{"Name =", "Name ="},
+		{"label:Name", `label:<a href="#Name">Name</a>`},
+		{"label : Other", "label : Other"},
+		{`'Name' '\'' Name`, `'Name' '\'' <a href="#Name">Name</a>`},
+		{"// Name <b>\nName", "// Name &lt;b&gt;\n<a href=\"#Name\">Name</a>"},
+	}
+	for _, tt := range tests {
+		if got := linkify(tt.input, link); got != tt.want {
+			t.Errorf("linkify(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateError(t *testing.T) {
+	g, _ := ungrammar.NewParser(`x = a | | b`).ParseGrammar()
+	if _, err := Generate(g, Options{}); err == nil {
+		t.Errorf("got no error for grammar with nil rules")
+	}
+}
@@ -5,15 +5,20 @@
 
 package ungrammar
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+)
 
-// ErrorList represents multiple parse errors reported by the parser on a given
-// source. It's loosely modeled on scanner.ErrorList in the Go standard library.
-// ErrorList implements the error interface.
-type ErrorList []error
+// ErrorList represents multiple diagnostics reported by the parser or by
+// Grammar.Validate on a given source. It's loosely modeled on
+// scanner.ErrorList in the Go standard library.
+// ErrorList implements the error interface; errors.As can be used to extract
+// the first *Diagnostic from it.
+type ErrorList []*Diagnostic
 
-func (el *ErrorList) Add(err error) {
-	*el = append(*el, err)
+func (el *ErrorList) Add(d *Diagnostic) {
+	*el = append(*el, d)
 }
 
 func (el ErrorList) Error() string {
@@ -25,3 +30,75 @@ func (el ErrorList) Error() string {
 		return fmt.Sprintf("%s (and %d more errors)", el[0], len(el)-1)
 	}
 }
+
+// Unwrap returns the diagnostics in the list as errors.
+func (el ErrorList) Unwrap() []error {
+	errs := make([]error, len(el))
+	for i, d := range el {
+		errs[i] = d
+	}
+	return errs
+}
+
+// ErrorList implements sort.Interface, ordering diagnostics by their start
+// position (file name first, then offset), then by code and message.
+func (el ErrorList) Len() int      { return len(el) }
+func (el ErrorList) Swap(i, j int) { el[i], el[j] = el[j], el[i] }
+
+func (el ErrorList) Less(i, j int) bool {
+	e := el[i].Span.Start
+	f := el[j].Span.Start
+	if e.Filename != f.Filename {
+		return e.Filename < f.Filename
+	}
+	if e.Offset != f.Offset {
+		return e.Offset < f.Offset
+	}
+	if el[i].Code != el[j].Code {
+		return el[i].Code < el[j].Code
+	}
+	return el[i].Message < el[j].Message
+}
+
+// Sort sorts an ErrorList in place (see Less for the order). Sorting is
+// stable, so diagnostics with the same position, code and message keep their
+// order.
+func (el ErrorList) Sort() {
+	sort.Stable(el)
+}
+
+// RemoveDuplicates sorts an ErrorList and removes all but the first of any
+// diagnostics that have the same span, code and message.
+func (el *ErrorList) RemoveDuplicates() {
+	el.Sort()
+	var last *Diagnostic
+	i := 0
+	for _, d := range *el {
+		if last == nil || d.Span != last.Span || d.Code != last.Code || d.Message != last.Message {
+			last = d
+			(*el)[i] = d
+			i++
+		}
+	}
+	*el = (*el)[:i]
+}
+
+// Err returns an error equivalent to this error list. If the list is empty,
+// Err returns nil.
+func (el ErrorList) Err() error {
+	if len(el) == 0 {
+		return nil
+	}
+	return el
+}
+
+// HasErrors reports whether the list contains diagnostics with
+// SeverityError.
+func (el ErrorList) HasErrors() bool {
+	for _, d := range el {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
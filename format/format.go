@@ -0,0 +1,269 @@
+// go-ungrammar: canonical formatting of Ungrammar source.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+// Package format implements canonical formatting of Ungrammar source, in the
+// spirit of go/format.
+//
+// The canonical layout puts each rule definition's name and '=' on their own
+// line, followed by the rule's body indented by two spaces. The alternatives
+// of a top-level alternation start on separate lines, with '|' in the first
+// column so that the alternatives align:
+//
+//	Expr =
+//	  Literal
+//	| BinExpr
+//
+// Within rule bodies, tokens are separated by single spaces, except that
+// quantifiers, labels and parentheses are attached to their operands (as in
+// "l:(a b)*"). Line breaks of the input inside rule bodies are preserved, lines
+// longer than 80 columns are wrapped, and the indentation of lines inside
+// parentheses reflects their nesting depth.
+//
+// All comments are preserved. Comments between rule definitions stay at the
+// top level, separated by at most one empty line; comments inside rule bodies
+// are indented with the surrounding rule, and comments trailing a line stay on
+// that line.
+package format
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/eliben/go-ungrammar"
+)
+
+// lineWidth is the column beyond which lines in rule bodies are wrapped.
+const lineWidth = 80
+
+// Source formats Ungrammar source in canonical layout and returns the result.
+// If src can't be parsed without errors, Source returns the parser's error and
+// no output.
+func Source(src []byte) ([]byte, error) {
+	return SourceFile("", src)
+}
+
+// SourceFile is like Source, but uses filename in the positions of errors.
+func SourceFile(filename string, src []byte) ([]byte, error) {
+	tree, err := ungrammar.NewFileParser(filename, string(src)).ParseSyntaxTree()
+	if err != nil {
+		return nil, err
+	}
+
+	f := &formatter{}
+	f.format(tree)
+	return []byte(f.sb.String()), nil
+}
+
+// tokenInfo is a token of the input along with the context the formatter
+// needs about it.
+type tokenInfo struct {
+	tok *ungrammar.SyntaxToken
+
+	// isName and isDefEq are set for the name and '=' of rule definitions.
+	isName  bool
+	isDefEq bool
+}
+
+type formatter struct {
+	sb  strings.Builder
+	col int
+
+	// Kind of the last significant (non-trivia) token written, and whether
+	// a comment was written after it.
+	prev         ungrammar.SyntaxKind
+	afterComment bool
+
+	// inBody is true between a definition's '=' and the next definition.
+	inBody bool
+
+	// depth is the current nesting depth of parentheses.
+	depth int
+}
+
+func (f *formatter) format(tree *ungrammar.SyntaxNode) {
+	toks := collectTokens(tree)
+
+	// newlines counts the line breaks in the whitespace preceding the current
+	// token, since the previous token or comment.
+	newlines := 0
+	for i, ti := range toks {
+		switch kind := ti.tok.Kind(); kind {
+		case ungrammar.KindWhitespace:
+			newlines += strings.Count(ti.tok.Text(), "\n")
+			continue
+		case ungrammar.KindComment:
+			f.comment(ti.tok.Text(), newlines, f.inBody && !nextIsTopLevel(toks, i))
+		default:
+			f.token(ti, newlines)
+		}
+		newlines = 0
+	}
+
+	if f.sb.Len() > 0 {
+		f.sb.WriteString("\n")
+	}
+}
+
+// collectTokens returns all the tokens of tree, marking the names and '='
+// tokens of definitions.
+func collectTokens(tree *ungrammar.SyntaxNode) []tokenInfo {
+	var toks []tokenInfo
+	for _, child := range tree.Children() {
+		switch c := child.(type) {
+		case *ungrammar.SyntaxToken:
+			toks = append(toks, tokenInfo{tok: c})
+		case *ungrammar.SyntaxNode:
+			seenName, seenEq := false, false
+			for _, tok := range c.Tokens() {
+				ti := tokenInfo{tok: tok}
+				if c.Kind() == ungrammar.KindDefinition && !tok.Kind().IsTrivia() {
+					if !seenName {
+						ti.isName, seenName = true, true
+					} else if !seenEq {
+						ti.isDefEq, seenEq = true, true
+					}
+				}
+				toks = append(toks, ti)
+			}
+		}
+	}
+	return toks
+}
+
+// nextIsTopLevel reports whether the first significant token after toks[i] is
+// the name of a definition, or there are no more significant tokens.
+func nextIsTopLevel(toks []tokenInfo, i int) bool {
+	for _, ti := range toks[i+1:] {
+		if !ti.tok.Kind().IsTrivia() {
+			return ti.isName
+		}
+	}
+	return true
+}
+
+// comment writes a comment; newlines is the number of line breaks preceding
+// it in the input. inBody is true if the comment belongs to a rule body.
+func (f *formatter) comment(text string, newlines int, inBody bool) {
+	text = strings.TrimRight(text, " \t\r")
+	switch {
+	case f.sb.Len() == 0:
+		// First line of the output.
+	case newlines == 0 && !f.afterComment:
+		// Trailing comment: stays on the line of the preceding token.
+		f.write(" " + text)
+		f.afterComment = true
+		return
+	case inBody:
+		f.newline(1)
+		f.indent(2 + 2*f.depth)
+	default:
+		f.newline(min(max(newlines, 1), 2))
+		f.inBody = false
+	}
+	f.write(text)
+	f.afterComment = true
+}
+
+// token writes a significant token; newlines is the number of line breaks
+// preceding it in the input.
+func (f *formatter) token(ti tokenInfo, newlines int) {
+	kind := ti.tok.Kind()
+	text := ti.tok.Text()
+
+	switch {
+	case ti.isName:
+		if f.sb.Len() > 0 {
+			if f.afterComment && !f.inBody && newlines < 2 {
+				// The name directly follows a top-level comment.
+				f.newline(1)
+			} else {
+				f.newline(2)
+			}
+		}
+		f.inBody = false
+		f.depth = 0
+		f.write(text)
+	case ti.isDefEq:
+		f.write(" " + text)
+		f.inBody = true
+	default:
+		f.bodyToken(kind, text, newlines)
+	}
+
+	f.prev = kind
+	f.afterComment = false
+}
+
+// bodyToken writes a token of a rule body.
+func (f *formatter) bodyToken(kind ungrammar.SyntaxKind, text string, newlines int) {
+	if kind == ungrammar.KindRParen {
+		f.depth--
+	}
+
+	// Line breaks are never inserted before quantifiers and label colons, or
+	// after label colons.
+	breakable := kind != ungrammar.KindQmark && kind != ungrammar.KindStar &&
+		kind != ungrammar.KindColon && f.prev != ungrammar.KindColon
+
+	var lineBreak bool
+	switch {
+	case f.prev == ungrammar.KindEq && !f.afterComment:
+		// First token of the body.
+		lineBreak = true
+	case f.afterComment:
+		lineBreak = true
+	case kind == ungrammar.KindPipe && f.depth == 0:
+		lineBreak = true
+	case breakable && newlines > 0:
+		lineBreak = true
+	case breakable && kind != ungrammar.KindRParen && f.prev != ungrammar.KindLParen:
+		lineBreak = f.col+1+utf8.RuneCountInString(text) > lineWidth
+	}
+
+	if lineBreak {
+		f.newline(1)
+		if kind == ungrammar.KindPipe {
+			f.indent(2 * f.depth)
+		} else {
+			f.indent(2 + 2*f.depth)
+		}
+	} else if needsSpace(f.prev, kind) {
+		f.write(" ")
+	}
+	f.write(text)
+
+	if kind == ungrammar.KindLParen {
+		f.depth++
+	}
+}
+
+// needsSpace reports whether a space separates tokens of kinds prev and next
+// on the same line.
+func needsSpace(prev, next ungrammar.SyntaxKind) bool {
+	switch next {
+	case ungrammar.KindQmark, ungrammar.KindStar, ungrammar.KindColon, ungrammar.KindRParen:
+		return false
+	}
+	switch prev {
+	case ungrammar.KindLParen, ungrammar.KindColon:
+		return false
+	}
+	return true
+}
+
+// newline ends the current line and writes n-1 empty lines.
+func (f *formatter) newline(n int) {
+	f.sb.WriteString(strings.Repeat("\n", n))
+	f.col = 0
+}
+
+func (f *formatter) indent(n int) {
+	f.write(strings.Repeat(" ", n))
+}
+
+func (f *formatter) write(s string) {
+	f.sb.WriteString(s)
+	f.col += utf8.RuneCountInString(s)
+}
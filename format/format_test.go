@@ -0,0 +1,94 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package format
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eliben/go-ungrammar"
+)
+
+func TestSource(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  string
+	}{
+		{`x=a`, "x =\n  a\n"},
+		{`x = a  b | c   y = 'd'`, "x =\n  a b\n| c\n\ny =\n  'd'\n"},
+		{`x = l : ( a b ) * c ?`, "x =\n  l:(a b)* c?\n"},
+		{"x =\n    a\n  | b", "x =\n  a\n| b\n"},
+
+		// Line breaks in bodies are preserved, with indentation by depth.
+		{"x = a\n    b ( c\n d | e\n)", "x =\n  a\n  b (c\n    d | e\n  )\n"},
+
+		{"x = a (\nb\n| c) d", "x =\n  a (\n    b\n  | c) d\n"},
+
+		// Comments
+		{"// top\n\n\n\n// doc\nx = a // trailing\ny = b", "// top\n\n// doc\nx =\n  a // trailing\n\ny =\n  b\n"},
+		{"x =\n// first\n  a\n    // second\n  | b\n\n// end\n", "x =\n  // first\n  a\n  // second\n| b\n\n// end\n"},
+		{"x = a ( // in parens\n b)", "x =\n  a ( // in parens\n    b)\n"},
+
+		// Long lines are wrapped.
+		{
+			"x = aaaaaaaaaa bbbbbbbbbb cccccccccc dddddddddd eeeeeeeeee ffffffffff gggggggggg hhhhhhhhhh",
+			"x =\n  aaaaaaaaaa bbbbbbbbbb cccccccccc dddddddddd eeeeeeeeee ffffffffff gggggggggg\n  hhhhhhhhhh\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := Source([]byte(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	_, err := SourceFile("x.ungrammar", []byte("x = a | | b"))
+	want := "x.ungrammar:1:9: expected rule, got |"
+	if err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %v", err, want)
+	}
+}
+
+// Check that formatting the test grammars preserves their meaning, and that
+// formatting is idempotent.
+func TestSourceTestdata(t *testing.T) {
+	for _, name := range []string{"exprlang.ungrammar", "rust.ungrammar", "ungrammar.ungrammar"} {
+		t.Run(name, func(t *testing.T) {
+			src, err := os.ReadFile(filepath.Join("..", "testdata", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := Source(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			g1, _ := ungrammar.NewParser(string(src)).ParseGrammar()
+			g2, err := ungrammar.NewParser(string(out)).ParseGrammar()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if g1.String() != g2.String() {
+				t.Errorf("formatted grammar differs from original")
+			}
+
+			out2, err := Source(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != string(out2) {
+				t.Errorf("formatting is not idempotent")
+			}
+		})
+	}
+}
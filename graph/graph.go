@@ -0,0 +1,351 @@
+// go-ungrammar: rule dependency graphs.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+// Package graph computes the dependency graph of the rules of a grammar, and
+// renders it in the DOT language of Graphviz, to help understanding large
+// grammars.
+//
+// Each rule is a vertex of the graph, and each reference to a rule (a Node)
+// is an edge from the referencing rule to the referenced one.
+package graph
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/eliben/go-ungrammar"
+)
+
+// Edge is a reference from the rule From to the rule To.
+type Edge struct {
+	From, To string
+
+	// Label is the label of the reference, if any.
+	Label string
+
+	// Optional is set if the reference is nested in an Opt, and Repeated if
+	// it's nested in a Rep.
+	Optional, Repeated bool
+
+	// Via lists the alternation rules collapsed into this edge (see
+	// Options.CollapseAlts), outermost first.
+	Via []string
+}
+
+// mark returns the suffix for the edge's label: "*" for repeated references
+// and "?" for optional ones, like in the grammar.
+func (e Edge) mark() string {
+	switch {
+	case e.Repeated:
+		return "*"
+	case e.Optional:
+		return "?"
+	}
+	return ""
+}
+
+// Edges returns the edges of g's dependency graph: the references of each
+// rule in order, with rules in the order of g.OrderedNames. Repeated
+// references with the same label and marks yield a single edge.
+func Edges(g *ungrammar.Grammar) []Edge {
+	var edges []Edge
+	for _, name := range g.OrderedNames() {
+		if r := g.Rules[name]; r != nil {
+			collectEdges(r, Edge{From: name}, &edges)
+		}
+	}
+	return edges
+}
+
+// collectEdges appends the edges for the references in r to edges; e has the
+// attributes of r's context.
+func collectEdges(r ungrammar.Rule, e Edge, edges *[]Edge) {
+	switch rr := r.(type) {
+	case *ungrammar.Node:
+		e.To = rr.Name
+		addEdge(edges, e)
+	case *ungrammar.Labeled:
+		e.Label = rr.Label
+		collectEdges(rr.Rule, e, edges)
+	case *ungrammar.Seq:
+		for _, sub := range rr.Rules {
+			collectEdges(sub, e, edges)
+		}
+	case *ungrammar.Alt:
+		for _, sub := range rr.Rules {
+			collectEdges(sub, e, edges)
+		}
+	case *ungrammar.Opt:
+		e.Optional = true
+		collectEdges(rr.Rule, e, edges)
+	case *ungrammar.Rep:
+		e.Repeated = true
+		collectEdges(rr.Rule, e, edges)
+	}
+}
+
+func addEdge(edges *[]Edge, e Edge) {
+	if !slices.ContainsFunc(*edges, func(other Edge) bool {
+		return other.From == e.From && other.To == e.To && other.Label == e.Label &&
+			other.mark() == e.mark() && slices.Equal(other.Via, e.Via)
+	}) {
+		*edges = append(*edges, e)
+	}
+}
+
+// Options configures Dot. The zero value renders the whole graph.
+type Options struct {
+	// Focus is the name of a rule to focus on: if set, only the rules within
+	// Depth references of it (following references in either direction) are
+	// rendered, and Focus is highlighted.
+	Focus string
+
+	// Depth is the size of the neighbourhood of Focus; the default is 1.
+	Depth int
+
+	// CollapseAlts collapses rules that are alternations of rule names (like
+	// "Expr = Literal | BinExpr"): references to such a rule are replaced by
+	// references to each of its alternatives, drawn dashed. Focus is never
+	// collapsed.
+	CollapseAlts bool
+
+	// HighlightCycles draws the rules and references on cycles (recursive
+	// rules) in red.
+	HighlightCycles bool
+}
+
+// Dot returns the dependency graph of g in the DOT language. Edges are
+// labeled with the labels of references, followed by "?" or "*" for optional
+// or repeated references. References to undefined rules lead to dashed
+// vertices. Dot returns an error if opts.Focus isn't a rule of g.
+func Dot(g *ungrammar.Grammar, opts Options) ([]byte, error) {
+	if opts.Focus != "" {
+		if _, ok := g.Rules[opts.Focus]; !ok {
+			return nil, fmt.Errorf("undefined rule %s", opts.Focus)
+		}
+	}
+	if opts.Depth == 0 {
+		opts.Depth = 1
+	}
+
+	names := g.OrderedNames()
+	edges := Edges(g)
+	if opts.CollapseAlts {
+		names, edges = collapseAlts(g, names, edges, opts.Focus)
+	}
+	for _, e := range edges {
+		if !slices.Contains(names, e.To) {
+			names = append(names, e.To)
+		}
+	}
+
+	var cyclic map[string]int
+	if opts.HighlightCycles {
+		cyclic = components(names, edges)
+	}
+	if opts.Focus != "" {
+		names, edges = neighbourhood(opts.Focus, opts.Depth, names, edges)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("digraph grammar {\n")
+	buf.WriteString("\tnode [shape=box];\n")
+	for _, name := range names {
+		var attrs []string
+		if _, ok := g.Rules[name]; !ok {
+			attrs = append(attrs, "style=dashed")
+		}
+		if name == opts.Focus {
+			attrs = append(attrs, "style=bold", "penwidth=2")
+		}
+		if _, ok := cyclic[name]; ok {
+			attrs = append(attrs, "color=red")
+		}
+		fmt.Fprintf(&buf, "\t%s%s;\n", quote(name), attrList(attrs))
+	}
+	for _, e := range edges {
+		var attrs []string
+		if label := e.Label + e.mark(); label != "" {
+			attrs = append(attrs, "label="+quote(label))
+		}
+		if len(e.Via) > 0 {
+			attrs = append(attrs, "style=dashed")
+		}
+		cFrom, okFrom := cyclic[e.From]
+		cTo, okTo := cyclic[e.To]
+		if okFrom && okTo && cFrom == cTo {
+			attrs = append(attrs, "color=red")
+		}
+		fmt.Fprintf(&buf, "\t%s -> %s%s;\n", quote(e.From), quote(e.To), attrList(attrs))
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes(), nil
+}
+
+func quote(s string) string {
+	return fmt.Sprintf("%q", s)
+}
+
+func attrList(attrs []string) string {
+	if len(attrs) == 0 {
+		return ""
+	}
+	return " [" + strings.Join(attrs, ", ") + "]"
+}
+
+// isEnum reports whether r is an alternation of rule names.
+func isEnum(r ungrammar.Rule) bool {
+	alt, ok := r.(*ungrammar.Alt)
+	if !ok {
+		return false
+	}
+	for _, sub := range alt.Rules {
+		if _, ok := sub.(*ungrammar.Node); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// collapseAlts removes the rules that are alternations of rule names, except
+// for keep, from names and edges, redirecting the edges to them to their
+// alternatives.
+func collapseAlts(g *ungrammar.Grammar, names []string, edges []Edge, keep string) ([]string, []Edge) {
+	collapsed := func(name string) bool {
+		return name != keep && isEnum(g.Rules[name])
+	}
+
+	var out []Edge
+	var redirect func(e Edge)
+	redirect = func(e Edge) {
+		if !collapsed(e.To) {
+			addEdge(&out, e)
+			return
+		}
+		if slices.Contains(e.Via, e.To) {
+			return
+		}
+		for _, sub := range g.Rules[e.To].(*ungrammar.Alt).Rules {
+			next := e
+			next.Via = append(slices.Clone(e.Via), e.To)
+			next.To = sub.(*ungrammar.Node).Name
+			redirect(next)
+		}
+	}
+	for _, e := range edges {
+		if !collapsed(e.From) {
+			redirect(e)
+		}
+	}
+
+	var kept []string
+	for _, name := range names {
+		if !collapsed(name) {
+			kept = append(kept, name)
+		}
+	}
+	return kept, out
+}
+
+// components returns the vertices on cycles, mapped to the index of their
+// strongly connected component; computed with Tarjan's algorithm.
+func components(names []string, edges []Edge) map[string]int {
+	succ := make(map[string][]string)
+	selfLoop := make(map[string]bool)
+	for _, e := range edges {
+		succ[e.From] = append(succ[e.From], e.To)
+		if e.From == e.To {
+			selfLoop[e.From] = true
+		}
+	}
+
+	index := make(map[string]int)
+	lowlink := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	cyclic := make(map[string]int)
+	ncomp := 0
+
+	var connect func(v string)
+	connect = func(v string) {
+		index[v] = len(index)
+		lowlink[v] = index[v]
+		stack = append(stack, v)
+		onStack[v] = true
+		for _, w := range succ[v] {
+			if _, ok := index[w]; !ok {
+				connect(w)
+				lowlink[v] = min(lowlink[v], lowlink[w])
+			} else if onStack[w] {
+				lowlink[v] = min(lowlink[v], index[w])
+			}
+		}
+		if lowlink[v] != index[v] {
+			return
+		}
+		i := len(stack) - 1
+		for stack[i] != v {
+			i--
+		}
+		comp := stack[i:]
+		stack = stack[:i]
+		for _, w := range comp {
+			onStack[w] = false
+		}
+		if len(comp) > 1 || selfLoop[v] {
+			for _, w := range comp {
+				cyclic[w] = ncomp
+			}
+			ncomp++
+		}
+	}
+	for _, name := range names {
+		if _, ok := index[name]; !ok {
+			connect(name)
+		}
+	}
+	return cyclic
+}
+
+// neighbourhood returns the vertices within depth edges of focus (in either
+// direction) and the edges between them.
+func neighbourhood(focus string, depth int, names []string, edges []Edge) ([]string, []Edge) {
+	dist := map[string]int{focus: 0}
+	frontier := []string{focus}
+	for d := 1; d <= depth; d++ {
+		var next []string
+		for _, v := range frontier {
+			for _, e := range edges {
+				for _, w := range []string{e.To, e.From} {
+					if (e.From == v || e.To == v) && w != v {
+						if _, ok := dist[w]; !ok {
+							dist[w] = d
+							next = append(next, w)
+						}
+					}
+				}
+			}
+		}
+		frontier = next
+	}
+
+	var keptNames []string
+	for _, name := range names {
+		if _, ok := dist[name]; ok {
+			keptNames = append(keptNames, name)
+		}
+	}
+	var keptEdges []Edge
+	for _, e := range edges {
+		_, okFrom := dist[e.From]
+		_, okTo := dist[e.To]
+		if okFrom && okTo {
+			keptEdges = append(keptEdges, e)
+		}
+	}
+	return keptNames, keptEdges
+}
@@ -0,0 +1,157 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package graph
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/eliben/go-ungrammar"
+)
+
+func mustParse(t *testing.T, input string) *ungrammar.Grammar {
+	t.Helper()
+	g, err := ungrammar.NewParser(input).ParseGrammar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestEdges(t *testing.T) {
+	g := mustParse(t, `
+Call = callee:Expr '(' args:Arg* ')' Block?
+Arg = Expr (',' Expr)*
+Expr = Call | Name
+Name = 'ident'
+`)
+	var got []string
+	for _, e := range Edges(g) {
+		got = append(got, fmt.Sprintf("%s->%s %q%s", e.From, e.To, e.Label, e.mark()))
+	}
+	want := []string{
+		`Call->Expr "callee"`,
+		`Call->Arg "args"*`,
+		`Call->Block ""?`,
+		`Arg->Expr ""`,
+		`Arg->Expr ""*`,
+		`Expr->Call ""`,
+		`Expr->Name ""`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got edges:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestDot(t *testing.T) {
+	g := mustParse(t, `
+Stmt = 'let' name:Name '=' Expr ';'
+Expr = Literal | ParenExpr
+ParenExpr = '(' Expr ')'
+Literal = 'number' Suffix?
+Name = 'ident'
+`)
+	var tests = []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{"all", Options{}, `digraph grammar {
+	node [shape=box];
+	"Stmt";
+	"Expr";
+	"ParenExpr";
+	"Literal";
+	"Name";
+	"Suffix" [style=dashed];
+	"Stmt" -> "Name" [label="name"];
+	"Stmt" -> "Expr";
+	"Expr" -> "Literal";
+	"Expr" -> "ParenExpr";
+	"ParenExpr" -> "Expr";
+	"Literal" -> "Suffix" [label="?"];
+}
+`},
+		{"cycles", Options{HighlightCycles: true}, `digraph grammar {
+	node [shape=box];
+	"Stmt";
+	"Expr" [color=red];
+	"ParenExpr" [color=red];
+	"Literal";
+	"Name";
+	"Suffix" [style=dashed];
+	"Stmt" -> "Name" [label="name"];
+	"Stmt" -> "Expr";
+	"Expr" -> "Literal";
+	"Expr" -> "ParenExpr" [color=red];
+	"ParenExpr" -> "Expr" [color=red];
+	"Literal" -> "Suffix" [label="?"];
+}
+`},
+		{"collapse", Options{CollapseAlts: true, HighlightCycles: true}, `digraph grammar {
+	node [shape=box];
+	"Stmt";
+	"ParenExpr" [color=red];
+	"Literal";
+	"Name";
+	"Suffix" [style=dashed];
+	"Stmt" -> "Name" [label="name"];
+	"Stmt" -> "Literal" [style=dashed];
+	"Stmt" -> "ParenExpr" [style=dashed];
+	"ParenExpr" -> "Literal" [style=dashed];
+	"ParenExpr" -> "ParenExpr" [style=dashed, color=red];
+	"Literal" -> "Suffix" [label="?"];
+}
+`},
+		{"focus", Options{Focus: "Expr"}, `digraph grammar {
+	node [shape=box];
+	"Stmt";
+	"Expr" [style=bold, penwidth=2];
+	"ParenExpr";
+	"Literal";
+	"Stmt" -> "Expr";
+	"Expr" -> "Literal";
+	"Expr" -> "ParenExpr";
+	"ParenExpr" -> "Expr";
+}
+`},
+		{"focus collapsed", Options{Focus: "Expr", CollapseAlts: true}, `digraph grammar {
+	node [shape=box];
+	"Stmt";
+	"Expr" [style=bold, penwidth=2];
+	"ParenExpr";
+	"Literal";
+	"Stmt" -> "Expr";
+	"Expr" -> "Literal";
+	"Expr" -> "ParenExpr";
+	"ParenExpr" -> "Expr";
+}
+`},
+		{"focus depth", Options{Focus: "Name", Depth: 2}, `digraph grammar {
+	node [shape=box];
+	"Stmt";
+	"Expr";
+	"Name" [style=bold, penwidth=2];
+	"Stmt" -> "Name" [label="name"];
+	"Stmt" -> "Expr";
+}
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Dot(g, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Dot(g, Options{Focus: "Nope"}); err == nil || err.Error() != "undefined rule Nope" {
+		t.Errorf("got error %v for undefined focus", err)
+	}
+}
@@ -0,0 +1,312 @@
+// go-ungrammar: incremental parsing.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package ungrammar
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+)
+
+// IncrementalParser parses Ungrammar source that's edited over time, e.g. in
+// an editor, reparsing only the parts of the source affected by each edit.
+// Create one with NewIncrementalParser, call its Edit method for every
+// change of the source, and its Grammar method when the grammar is needed.
+//
+// Top-level rule definitions start at a Node '=' (which is where the parser
+// resumes after syntax errors, too), so the source is kept split into
+// segments, each starting at a definition and extending up to the next one.
+// An edit reparses the segments it touches and the one before them (whose
+// end depends on the tokens at the start of the next one), until reparsing
+// arrives at the start of a segment following the edit; the segments after
+// it are reused. Only the starts of reused segments are updated by Edit; the
+// positions in their rules are shifted by Grammar, once for all the edits
+// since the previous call.
+//
+// The grammars and errors returned by an IncrementalParser are the same as
+// ParseGrammar would return for its source. Their rules are shared between
+// the grammars it returns, and must not be modified.
+type IncrementalParser struct {
+	filename string
+	text     string
+	fileDoc  string
+	segments []segment
+
+	// grammar and err are the result of Grammar, if it was called since the
+	// last edit.
+	grammar *Grammar
+	err     error
+
+	// reparsed is the number of segments parsed by the last call to Edit.
+	reparsed int
+}
+
+// segment is a part of the source starting at a top-level definition (or at
+// the start of the source), with its leading whitespace and comments, up to
+// the next definition. Besides the definition, it may contain input skipped
+// due to errors.
+type segment struct {
+	start Pos
+	defs  []definition
+
+	// defsStart is the start of the segment when the positions in defs were
+	// computed; if it's not start, they have to be shifted.
+	defsStart Pos
+}
+
+// NewIncrementalParser creates an incremental parser for buf and parses it.
+// filename is recorded in positions, as in NewFileParser.
+func NewIncrementalParser(filename string, buf string) *IncrementalParser {
+	ip := &IncrementalParser{filename: filename, text: buf}
+	ip.segments, _ = ip.parseFrom(Pos{Filename: filename, Offset: 0, Line: 1, Column: 1}, nil)
+	ip.reparsed = len(ip.segments)
+	return ip
+}
+
+// Text returns the current source.
+func (ip *IncrementalParser) Text() string {
+	return ip.text
+}
+
+// Grammar returns the grammar parsed from the current source, with the errors
+// found in it, as ParseGrammar would return them. Until the next edit, it
+// returns the same grammar again.
+func (ip *IncrementalParser) Grammar() (*Grammar, error) {
+	if ip.grammar != nil {
+		return ip.grammar, ip.err
+	}
+	var defs []definition
+	for i := range ip.segments {
+		seg := &ip.segments[i]
+		if seg.defsStart != seg.start {
+			seg.defs = shift{oldEnd: seg.defsStart, newEnd: seg.start}.defs(seg.defs)
+			seg.defsStart = seg.start
+		}
+		defs = append(defs, seg.defs...)
+	}
+	grammar, errs := buildGrammar(defs, ip.fileDoc)
+	ip.grammar, ip.err = grammar, nil
+	if len(errs) > 0 {
+		ip.err = errs
+	}
+	return ip.grammar, ip.err
+}
+
+// Edit applies edit to the source, replacing the bytes in its span (only the
+// offsets of the span are used) by its NewText. It panics if the span of edit
+// is out of the bounds of the source.
+//
+// Offsets may fall inside multi-byte UTF-8 sequences; the bytes of the
+// source are replaced all the same, and positions are computed from the
+// runes of the new source, as ParseGrammar computes them.
+func (ip *IncrementalParser) Edit(edit TextEdit) {
+	start, end := edit.Span.Start.Offset, edit.Span.End.Offset
+	if start < 0 || start > end || end > len(ip.text) {
+		panic(fmt.Sprintf("ungrammar: edit of %d:%d out of bounds of source of length %d", start, end, len(ip.text)))
+	}
+	ip.grammar, ip.err = nil, nil
+
+	// Reparse from the segment before the one containing the start of the
+	// edit.
+	first := sort.Search(len(ip.segments), func(i int) bool {
+		return ip.segments[i].start.Offset > start
+	}) - 2
+	first = max(first, 0)
+	from := Pos{Filename: ip.filename, Offset: 0, Line: 1, Column: 1}
+	if first < len(ip.segments) {
+		from = ip.segments[first].start
+	}
+
+	newText := ip.text[:start] + edit.NewText + ip.text[end:]
+	newEnd := start + len(edit.NewText)
+	// The text following an edit ending inside a rune may decode differently
+	// after it; extend the edit to the next rune start, after which it decodes
+	// the same.
+	for end < len(ip.text) && !utf8.RuneStart(ip.text[end]) {
+		end++
+		newEnd++
+	}
+	sh := shift{
+		oldEnd: advancePos(from, ip.text[from.Offset:end]),
+		newEnd: advancePos(from, newText[from.Offset:newEnd]),
+	}
+	delta := sh.newEnd.Offset - sh.oldEnd.Offset
+	ip.text = newText
+
+	// Stop reparsing at the start of an old segment following the edit.
+	old := ip.segments
+	next := first + 1
+	segs, resynced := ip.parseFrom(from, func(off int) bool {
+		for next < len(old) && (old[next].start.Offset < end || old[next].start.Offset+delta < off) {
+			next++
+		}
+		return next < len(old) && old[next].start.Offset+delta == off
+	})
+	ip.reparsed = len(segs)
+
+	ip.segments = append(old[:first:first], segs...)
+	if resynced {
+		for _, seg := range old[next:] {
+			seg.start = sh.pos(seg.start)
+			ip.segments = append(ip.segments, seg)
+		}
+	}
+}
+
+// parseFrom parses the source from the start of a segment at pos, and returns
+// the segments parsed. If resync isn't nil, it's called with the offset of
+// the start of every following segment; when it returns true, parsing stops
+// and parseFrom reports that it resynced.
+func (ip *IncrementalParser) parseFrom(pos Pos, resync func(off int) bool) ([]segment, bool) {
+	p := newParser(newLexerAt(ip.text, pos))
+	if pos.Offset == 0 {
+		ip.fileDoc = p.lex.fileDoc
+	}
+
+	var segs []segment
+	for !p.eof() {
+		seg := segment{start: pos, defsStart: pos}
+		seg.defs = append(seg.defs, p.parseDefinition())
+		for !p.eof() && !p.atNamedRule() {
+			seg.defs = append(seg.defs, p.parseDefinition())
+		}
+		segs = append(segs, seg)
+
+		pos = p.prevEnd
+		if resync != nil && resync(pos.Offset) {
+			return segs, true
+		}
+	}
+	return segs, false
+}
+
+// advancePos returns the position following text, which starts at pos.
+func advancePos(pos Pos, text string) Pos {
+	for _, r := range text {
+		if r == '\n' {
+			pos.Line++
+			pos.Column = 1
+		} else {
+			pos.Column++
+		}
+	}
+	pos.Offset += len(text)
+	return pos
+}
+
+// shift maps positions following an edit in the source before the edit to
+// the source after it; oldEnd and newEnd are the ends of the edit before and
+// after it was applied. The positions in a segment following edits are mapped
+// by the shift from its old start to its new one.
+type shift struct {
+	oldEnd, newEnd Pos
+}
+
+func (sh shift) pos(pos Pos) Pos {
+	if !pos.IsValid() {
+		return pos
+	}
+	if pos.Line == sh.oldEnd.Line {
+		pos.Column += sh.newEnd.Column - sh.oldEnd.Column
+	}
+	pos.Line += sh.newEnd.Line - sh.oldEnd.Line
+	pos.Offset += sh.newEnd.Offset - sh.oldEnd.Offset
+	return pos
+}
+
+func (sh shift) span(sp Span) Span {
+	return Span{sh.pos(sp.Start), sh.pos(sp.End)}
+}
+
+// defs returns a copy of defs with their positions shifted.
+func (sh shift) defs(defs []definition) []definition {
+	shifted := make([]definition, len(defs))
+	for i, def := range defs {
+		def.span = sh.span(def.span)
+		def.rule = sh.rule(def.rule)
+		if def.errs != nil {
+			errs := make(ErrorList, len(def.errs))
+			for i, d := range def.errs {
+				errs[i] = sh.diagnostic(d)
+			}
+			def.errs = errs
+		}
+		shifted[i] = def
+	}
+	return shifted
+}
+
+// rule returns a copy of the rule tree r with its positions shifted, like
+// Clone does but in a single pass. Alt docs are shared with r.
+func (sh shift) rule(r Rule) Rule {
+	switch rr := r.(type) {
+	case *Labeled:
+		c := *rr
+		c.Rule = sh.rule(rr.Rule)
+		c.span = sh.span(rr.span)
+		return &c
+	case *Node:
+		c := *rr
+		c.span = sh.span(rr.span)
+		return &c
+	case *Token:
+		c := *rr
+		c.span = sh.span(rr.span)
+		return &c
+	case *Opt:
+		c := *rr
+		c.Rule = sh.rule(rr.Rule)
+		c.span = sh.span(rr.span)
+		return &c
+	case *Rep:
+		c := *rr
+		c.Rule = sh.rule(rr.Rule)
+		c.span = sh.span(rr.span)
+		return &c
+	case *Seq:
+		c := *rr
+		c.Rules = sh.rules(rr.Rules)
+		c.span = sh.span(rr.span)
+		return &c
+	case *Alt:
+		c := *rr
+		c.Rules = sh.rules(rr.Rules)
+		c.span = sh.span(rr.span)
+		return &c
+	}
+	return r
+}
+
+func (sh shift) rules(rules []Rule) []Rule {
+	if rules == nil {
+		return nil
+	}
+	shifted := make([]Rule, len(rules))
+	for i, r := range rules {
+		shifted[i] = sh.rule(r)
+	}
+	return shifted
+}
+
+// diagnostic returns a copy of d with its positions shifted.
+func (sh shift) diagnostic(d *Diagnostic) *Diagnostic {
+	c := *d
+	c.Span = sh.span(d.Span)
+	c.Related = nil
+	for _, rel := range d.Related {
+		rel.Span = sh.span(rel.Span)
+		c.Related = append(c.Related, rel)
+	}
+	c.Fixes = nil
+	for _, fix := range d.Fixes {
+		edits := make([]TextEdit, len(fix.Edits))
+		for i, e := range fix.Edits {
+			edits[i] = TextEdit{Span: sh.span(e.Span), NewText: e.NewText}
+		}
+		c.Fixes = append(c.Fixes, Fix{Message: fix.Message, Edits: edits})
+	}
+	return &c
+}
@@ -0,0 +1,169 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package ungrammar
+
+import (
+	"math/rand/v2"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// checkIncremental checks that the grammar and error returned by ip are the
+// same as a full parse of its text produces.
+func checkIncremental(t *testing.T, ip *IncrementalParser, g *Grammar, err error) {
+	t.Helper()
+	wantG, wantErr := NewFileParser(ip.filename, ip.Text()).ParseGrammar()
+	if !reflect.DeepEqual(g, wantG) {
+		t.Fatalf("text %q: got grammar\n%v\nwant\n%v", ip.Text(), g, wantG)
+	}
+	if !reflect.DeepEqual(err, wantErr) {
+		t.Fatalf("text %q: got error\n%v\nwant\n%v", ip.Text(), err, wantErr)
+	}
+}
+
+// offsetEdit returns the edit replacing the bytes from start to end by text.
+func offsetEdit(start, end int, text string) TextEdit {
+	return TextEdit{
+		Span:    Span{Start: Pos{Offset: start}, End: Pos{Offset: end}},
+		NewText: text,
+	}
+}
+
+func TestIncrementalEdit(t *testing.T) {
+	const src = `// Expressions.
+
+// The root.
+Expr = Lit | Bin
+
+Lit = 'int' | 'str'
+
+Bin =
+  lhs:Expr op:('+' | '-') rhs:Expr
+
+Call = Expr '(' Args? ')'
+
+Args = Expr*
+`
+	var tests = []struct {
+		name string
+		// The edit replaces the first occurrence of old in src by new.
+		old, new string
+		reparsed int
+	}{
+		{"rename in rule", "'str'", "'string'", 2},
+		{"change doc", "// The root.", "// The root rule.", 1},
+		{"remove file doc", "// Expressions.\n", "", 1},
+		{"add lines", "Args = Expr*", "Args = Expr\n  (',' Expr)*", 2},
+		{"split rule", "op:('+' | '-')", "op:('+' | '-')\nOp = '*'", 3},
+		{"merge rules", "Call = Expr", "Expr", 1},
+		{"break rule", "Bin =", "Bin", 1},
+		{"unterminated token", "'('", "'(", 2},
+		{"duplicate rule", "Call =", "Lit =", 2},
+		{"append", "Expr*\n", "Expr*\nMore = Args\n", 3},
+		{"replace all", src, "x = y", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip := NewIncrementalParser("test.ungrammar", src)
+			g, err := ip.Grammar()
+			checkIncremental(t, ip, g, err)
+
+			start := strings.Index(src, tt.old)
+			ip.Edit(offsetEdit(start, start+len(tt.old), tt.new))
+			g, err = ip.Grammar()
+			if want := strings.Replace(src, tt.old, tt.new, 1); ip.Text() != want {
+				t.Fatalf("got text %q, want %q", ip.Text(), want)
+			}
+			checkIncremental(t, ip, g, err)
+			if ip.reparsed != tt.reparsed {
+				t.Errorf("got %d segments reparsed, want %d", ip.reparsed, tt.reparsed)
+			}
+		})
+	}
+}
+
+func TestIncrementalEmpty(t *testing.T) {
+	ip := NewIncrementalParser("", "")
+	for _, e := range []TextEdit{
+		offsetEdit(0, 0, "// doc\n"),
+		offsetEdit(7, 7, "x = y"),
+		offsetEdit(0, 12, ""),
+	} {
+		ip.Edit(e)
+		g, err := ip.Grammar()
+		checkIncremental(t, ip, g, err)
+	}
+}
+
+// Random edits of the grammars in testdata, each followed by undoing it.
+func TestIncrementalRandom(t *testing.T) {
+	snippets := []string{
+		"", "x", "Foo", " = ", "=", "|", "'", "'tok'", "\n", "// c\n", "\n// c\n",
+		"(", ")", "*", "?", ":", "@", "é", " ", "Name = ", "a:B",
+	}
+	for _, name := range []string{"exprlang.ungrammar", "ungrammar.ungrammar", "rust.ungrammar"} {
+		t.Run(name, func(t *testing.T) {
+			src := readFileOrPanic(filepath.Join("testdata", name))
+			rnd := rand.New(rand.NewPCG(1, uint64(len(src))))
+			ip := NewIncrementalParser(name, src)
+			for range 200 {
+				text := ip.Text()
+				start := rnd.IntN(len(text) + 1)
+				end := start + rnd.IntN(min(20, len(text)-start)+1)
+				repl := snippets[rnd.IntN(len(snippets))]
+				ip.Edit(offsetEdit(start, end, repl))
+				g, err := ip.Grammar()
+				checkIncremental(t, ip, g, err)
+
+				ip.Edit(offsetEdit(start, start+len(repl), text[start:end]))
+				g, err = ip.Grammar()
+				checkIncremental(t, ip, g, err)
+				if ip.Text() != text {
+					t.Fatalf("undoing an edit didn't restore the text")
+				}
+			}
+		})
+	}
+}
+
+// Several edits between calls to Grammar, which shifts the segments following
+// them once.
+func TestIncrementalEdits(t *testing.T) {
+	ip := NewIncrementalParser("test.ungrammar", "a = 'x'\nb = a\nc = b 'é' d\nd = 'y'\n")
+	ip.Edit(offsetEdit(4, 7, "'long'"))
+	ip.Edit(offsetEdit(0, 0, "// doc\n"))
+	ip.Edit(offsetEdit(22, 23, "z z"))
+	g, err := ip.Grammar()
+	checkIncremental(t, ip, g, err)
+	if g2, _ := ip.Grammar(); g2 != g {
+		t.Errorf("got a new grammar without edits")
+	}
+}
+
+// Edits at offsets inside multi-byte runes.
+func TestIncrementalRunes(t *testing.T) {
+	const src = "a = 'é' b = 'ü€' c = a\nd = 'é' e = d\n"
+	for start := range len(src) {
+		for end := start; end <= min(start+3, len(src)); end++ {
+			for _, repl := range []string{"", "a", "\xc3", "\xa9", "\n"} {
+				ip := NewIncrementalParser("", src)
+				ip.Edit(offsetEdit(start, end, repl))
+				g, err := ip.Grammar()
+				checkIncremental(t, ip, g, err)
+			}
+		}
+	}
+}
+
+func TestIncrementalBadEdit(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("got no panic for an out of bounds edit")
+		}
+	}()
+	NewIncrementalParser("", "x = y").Edit(offsetEdit(3, 10, ""))
+}
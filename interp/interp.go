@@ -0,0 +1,537 @@
+// go-ungrammar: interpreting parser.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+// Package interp implements a parser that interprets a grammar directly,
+// building concrete syntax trees (see package cst) from streams of tokens
+// without a parser written for the language, e.g. for prototyping languages.
+//
+// The parser is a memoizing (packrat) backtracking parser over the rules of
+// the grammar:
+//
+//   - Alt tries all its alternatives, and picks the one with the fewest
+//     errors, then the one matching the most tokens, then the first.
+//   - Opt and Rep are greedy: they match their rule as long as it matches at
+//     least one token, and never backtrack to match fewer times. Like in
+//     PEGs, a repetition that can consume the start of what follows it (like
+//     the name of the next definition in Ungrammar's own grammar) makes the
+//     rest fail; the lexer has to tell such tokens apart.
+//   - Direct and indirect left recursion (like "BinExpr = Expr '+' Expr" with
+//     "Expr = Literal | BinExpr") is supported by growing the match of the
+//     left-recursive rule until it can't grow any longer. Since grammars have
+//     no notion of precedence, ambiguous binary expressions nest to the right.
+//
+// Each parsed rule produces a node of its kind, except for rules that are
+// alternations of rule names (like "Expr = Literal | BinExpr"), which produce
+// the node of the matched alternative directly; so the trees follow the
+// conventions of Grammar.CheckTree.
+//
+// The parser recovers from syntax errors instead of failing outright. Once a
+// sequence has matched at least one token, a rule in it that doesn't match is
+// either considered missing, or matched after skipping a few unexpected
+// tokens; missing rules and skipped tokens are represented by error nodes in
+// the tree (of kind ErrorKind), and reported as errors. Similarly, once a
+// repetition has matched its rule at least once, tokens that can't follow it
+// are skipped up to the next match of its rule (which starts with a token in
+// the rule's FIRST set, see package analysis), and the repetition goes on.
+package interp
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/eliben/go-ungrammar"
+	"github.com/eliben/go-ungrammar/analysis"
+	"github.com/eliben/go-ungrammar/cst"
+)
+
+// Token is a token of the input of the parser.
+type Token struct {
+	// Kind is the kind of the token, which the parser matches with the values
+	// of Token rules, like "ident" or "+".
+	Kind string
+
+	// Text is the text of the token in the syntax tree.
+	Text string
+}
+
+// ErrorKind is the kind of error nodes in syntax trees built by the parser.
+const ErrorKind cst.Kind = 0
+
+// maxSkip is the maximal number of tokens skipped while recovering from a
+// syntax error.
+const maxSkip = 16
+
+// Error is a syntax error found by the parser.
+type Error struct {
+	// Token is the index of the input token where the error was found; it's
+	// the number of tokens for errors at the end of the input.
+	Token int
+	Msg   string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("token %d: %s", e.Token, e.Msg)
+}
+
+// ErrorList is a list of syntax errors, ordered by their position.
+type ErrorList []*Error
+
+func (el ErrorList) Error() string {
+	switch len(el) {
+	case 0:
+		return "no errors"
+	case 1:
+		return el[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", el[0], len(el)-1)
+}
+
+// Parser parses token streams with a grammar. A Parser isn't safe for
+// concurrent use.
+type Parser struct {
+	g *ungrammar.Grammar
+
+	// kindNames lists the names of kinds by value; kinds maps rule names and
+	// quoted token values back to kinds.
+	kindNames []string
+	kinds     map[string]cst.Kind
+
+	// lookaheads caches the lookahead sets of g by root rule.
+	lookaheads map[string]*analysis.Lookahead
+
+	// State of a parse.
+	la       *analysis.Lookahead
+	toks     []Token
+	interned map[tokenKey]*cst.GreenToken
+	memo     map[memoKey]*memoEntry
+	stack    []*memoEntry
+	growing  map[int]int
+}
+
+type tokenKey struct {
+	kind cst.Kind
+	text string
+}
+
+// New returns a parser for g.
+//
+// The parser assigns a cst.Kind to each rule and token of g: ErrorKind is
+// followed by the kinds of rules in the order of g.OrderedNames, and then by
+// the kinds of tokens in order of first appearance in g. Tokens of the input
+// with kinds that aren't in g get new kinds when they're parsed.
+func New(g *ungrammar.Grammar) *Parser {
+	p := &Parser{
+		g:          g,
+		kindNames:  []string{"ERROR"},
+		kinds:      make(map[string]cst.Kind),
+		lookaheads: make(map[string]*analysis.Lookahead),
+	}
+	for _, name := range g.OrderedNames() {
+		p.addKind(name)
+	}
+	for _, name := range g.OrderedNames() {
+		if g.Rules[name] == nil {
+			continue
+		}
+		ungrammar.Inspect(g.Rules[name], func(r ungrammar.Rule) bool {
+			if tok, ok := r.(*ungrammar.Token); ok {
+				p.tokenKind(tok.Value)
+			}
+			return true
+		})
+	}
+	return p
+}
+
+func (p *Parser) addKind(name string) cst.Kind {
+	k := cst.Kind(len(p.kindNames))
+	p.kindNames = append(p.kindNames, name)
+	p.kinds[name] = k
+	return k
+}
+
+// KindName returns the name of a kind: the rule name for nodes, the quoted
+// value for tokens (like "'+'"), and "ERROR" for ErrorKind. It can be passed
+// to cst.Node.Dump.
+func (p *Parser) KindName(k cst.Kind) string {
+	if int(k) < len(p.kindNames) {
+		return p.kindNames[k]
+	}
+	return fmt.Sprintf("Kind(%d)", k)
+}
+
+// NodeKind returns the kind of nodes of the rule name.
+func (p *Parser) NodeKind(name string) (cst.Kind, bool) {
+	k, ok := p.kinds[name]
+	return k, ok
+}
+
+// TokenKind returns the kind of tokens with the given value, assigning a new
+// kind if there's none yet.
+func (p *Parser) TokenKind(value string) cst.Kind {
+	return p.tokenKind(value)
+}
+
+func (p *Parser) tokenKind(value string) cst.Kind {
+	quoted := fmt.Sprintf("'%s'", value)
+	if k, ok := p.kinds[quoted]; ok {
+		return k
+	}
+	return p.addKind(quoted)
+}
+
+// Parse parses toks as the rule root and returns the syntax tree. If there are
+// syntax errors, it returns the tree built with error recovery along with an
+// ErrorList. Parse returns a nil tree only if root isn't defined.
+func (p *Parser) Parse(root string, toks []Token) (*cst.Node, error) {
+	if r, ok := p.g.Rules[root]; !ok || r == nil {
+		return nil, fmt.Errorf("undefined rule %s", root)
+	}
+
+	p.la = p.lookaheads[root]
+	if p.la == nil {
+		p.la = analysis.ComputeLookahead(p.g, root)
+		p.lookaheads[root] = p.la
+	}
+	p.toks = toks
+	p.interned = make(map[tokenKey]*cst.GreenToken)
+	p.memo = make(map[memoKey]*memoEntry)
+	p.stack = nil
+	p.growing = make(map[int]int)
+	defer func() {
+		p.la, p.toks, p.interned, p.memo = nil, nil, nil, nil
+	}()
+
+	res := p.rule(root, 0)
+	var green *cst.GreenNode
+	if res.ok {
+		green = res.elems[0].(*cst.GreenNode)
+	} else {
+		kind, _ := p.NodeKind(root)
+		green = cst.NewGreenNode(kind, nil)
+		res = result{ok: true, errs: []*Error{{0, "expected " + root}}}
+	}
+	if res.end < len(toks) {
+		green = green.InsertChild(len(green.Children()), p.errorNode(res.end, len(toks)))
+		res.errs = append(res.errs, &Error{res.end, fmt.Sprintf("unexpected %s after %s", p.describe(res.end), root)})
+	}
+
+	if len(res.errs) > 0 {
+		errs := ErrorList(res.errs)
+		sort.SliceStable(errs, func(i, j int) bool { return errs[i].Token < errs[j].Token })
+		return cst.NewRoot(green), errs
+	}
+	return cst.NewRoot(green), nil
+}
+
+// result is the result of matching a rule at a position of the input: if ok,
+// the match ends before token end, and produced the tree elements elems and
+// the syntax errors errs.
+type result struct {
+	ok    bool
+	end   int
+	elems []cst.GreenElement
+	errs  []*Error
+}
+
+// concat returns the result of matching r after res.
+func (res result) concat(r result) result {
+	return result{
+		ok:    true,
+		end:   r.end,
+		elems: slices.Concat(res.elems, r.elems),
+		errs:  slices.Concat(res.errs, r.errs),
+	}
+}
+
+// better reports whether res is a better match than other: it matches with
+// fewer errors, or with as many errors and more tokens.
+func (res result) better(other result) bool {
+	if !res.ok || !other.ok {
+		return res.ok
+	}
+	if len(res.errs) != len(other.errs) {
+		return len(res.errs) < len(other.errs)
+	}
+	return res.end > other.end
+}
+
+type memoKey struct {
+	name string
+	pos  int
+}
+
+// memoEntry is the memoized result of matching a rule at a position. While
+// the rule is being matched, inProgress is set; reaching the entry again then
+// means the rule is left-recursive, which makes it the head of a
+// left-recursive cycle, and the other rules on the cycle involved.
+type memoEntry struct {
+	key        memoKey
+	res        result
+	inProgress bool
+	isHead     bool
+	involved   bool
+}
+
+// rule matches the rule name at pos, with memoization and support for left
+// recursion: a left-recursive rule first matches without the left-recursive
+// alternatives (whose recursive reference fails), which gives a seed; then
+// it's matched again and again with the recursive reference matching the
+// previous result, until the match no longer grows.
+func (p *Parser) rule(name string, pos int) result {
+	key := memoKey{name, pos}
+	if e, ok := p.memo[key]; ok {
+		if e.inProgress {
+			e.isHead = true
+			i := slices.Index(p.stack, e)
+			for _, inv := range p.stack[i+1:] {
+				inv.involved = true
+			}
+			return result{}
+		}
+		return e.res
+	}
+
+	e := &memoEntry{key: key, inProgress: true}
+	p.memo[key] = e
+	p.stack = append(p.stack, e)
+	res := p.evalRule(name, pos)
+	if e.isHead {
+		p.growing[pos]++
+		for {
+			e.res, e.inProgress = res, false
+			next := p.evalRule(name, pos)
+			if !next.ok || len(next.errs) > len(res.errs) || next.end <= res.end {
+				break
+			}
+			res = next
+		}
+		p.growing[pos]--
+	}
+	p.stack = p.stack[:len(p.stack)-1]
+
+	// Results depending on the seed of a growing left-recursive rule can't be
+	// reused.
+	if e.involved || p.growing[pos] > 0 {
+		delete(p.memo, key)
+	} else {
+		e.res, e.inProgress = res, false
+	}
+	return res
+}
+
+// evalRule matches the rule name at pos, producing a node of its kind unless
+// it's an alternation of rule names.
+func (p *Parser) evalRule(name string, pos int) result {
+	r := p.g.Rules[name]
+	res := p.eval(r, pos)
+	if !res.ok || isEnum(r) {
+		return res
+	}
+	kind, _ := p.NodeKind(name)
+	res.elems = []cst.GreenElement{cst.NewGreenNode(kind, res.elems)}
+	return res
+}
+
+// isEnum reports whether r is an alternation of rule names.
+func isEnum(r ungrammar.Rule) bool {
+	alt, ok := r.(*ungrammar.Alt)
+	if !ok {
+		return false
+	}
+	for _, sub := range alt.Rules {
+		if _, ok := sub.(*ungrammar.Node); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// eval matches r at pos.
+func (p *Parser) eval(r ungrammar.Rule, pos int) result {
+	switch rr := r.(type) {
+	case *ungrammar.Token:
+		if pos < len(p.toks) && p.toks[pos].Kind == rr.Value {
+			return result{ok: true, end: pos + 1, elems: []cst.GreenElement{p.token(pos)}}
+		}
+		return result{}
+	case *ungrammar.Node:
+		if _, ok := p.g.Rules[rr.Name]; !ok {
+			return result{}
+		}
+		return p.rule(rr.Name, pos)
+	case *ungrammar.Labeled:
+		return p.eval(rr.Rule, pos)
+	case *ungrammar.Seq:
+		res := result{ok: true, end: pos}
+		for i, sub := range rr.Rules {
+			r := p.eval(sub, res.end)
+			if !r.ok {
+				if res.end == pos {
+					// Nothing matched yet; the sequence just doesn't match.
+					return result{}
+				}
+				r = p.recover(sub, rr.Rules[i+1:], res.end)
+			}
+			res = res.concat(r)
+		}
+		return res
+	case *ungrammar.Alt:
+		var best result
+		for _, sub := range rr.Rules {
+			if r := p.eval(sub, pos); r.better(best) {
+				best = r
+			}
+		}
+		return best
+	case *ungrammar.Opt:
+		if r := p.eval(rr.Rule, pos); r.ok && r.end > pos {
+			return r
+		}
+		return result{ok: true, end: pos}
+	case *ungrammar.Rep:
+		res := result{ok: true, end: pos}
+		for {
+			r := p.eval(rr.Rule, res.end)
+			if !r.ok || r.end == res.end {
+				if res.end == pos {
+					return res
+				}
+				if r = p.resync(rr, res.end); !r.ok {
+					return res
+				}
+			}
+			res = res.concat(r)
+		}
+	}
+	return result{}
+}
+
+// recover handles a failure to match r at pos, in a sequence where r is
+// followed by the rules in rest. If the first rule of rest matches at pos, or
+// r doesn't match after skipping up to maxSkip tokens, r is considered
+// missing. Otherwise, the skipped tokens are wrapped in an error node
+// followed by the match of r.
+func (p *Parser) recover(r ungrammar.Rule, rest []ungrammar.Rule, pos int) result {
+	missing := result{
+		ok:    true,
+		end:   pos,
+		elems: []cst.GreenElement{cst.NewGreenNode(ErrorKind, nil)},
+		errs:  []*Error{{pos, fmt.Sprintf("expected %s, found %s", ungrammar.FormatRule(r), p.describe(pos))}},
+	}
+	if len(rest) > 0 && p.eval(rest[0], pos).ok {
+		return missing
+	}
+	for skip := pos + 1; skip <= min(pos+maxSkip, len(p.toks)); skip++ {
+		if res := p.eval(r, skip); res.ok && len(res.errs) == 0 {
+			skipped := result{
+				ok:    true,
+				end:   skip,
+				elems: []cst.GreenElement{p.errorNode(pos, skip)},
+				errs:  []*Error{{pos, fmt.Sprintf("unexpected %s, expected %s", p.describe(pos), ungrammar.FormatRule(r))}},
+			}
+			return skipped.concat(res)
+		}
+	}
+	return missing
+}
+
+// resync handles the end of the repetition rep at pos, after it matched its
+// rule at least once. If the token at pos can't follow rep, tokens are
+// skipped up to a token in the FIRST set of the repeated rule where the rule
+// matches without errors, giving up at the end of the input, at a token that
+// can follow rep, or after maxSkip tokens. The result is the skipped tokens
+// wrapped in an error node followed by the match of the rule, or not ok if
+// resync gave up.
+func (p *Parser) resync(rep *ungrammar.Rep, pos int) result {
+	first, follow := p.la.First(rep.Rule), p.la.Follow(rep)
+	for skip := pos; skip < min(pos+maxSkip+1, len(p.toks)); skip++ {
+		kind := p.toks[skip].Kind
+		if follow[kind] {
+			break
+		}
+		if skip == pos || !first[kind] {
+			continue
+		}
+		if res := p.eval(rep.Rule, skip); res.ok && res.end > skip && len(res.errs) == 0 {
+			skipped := result{
+				ok:    true,
+				end:   skip,
+				elems: []cst.GreenElement{p.errorNode(pos, skip)},
+				errs:  []*Error{{pos, fmt.Sprintf("unexpected %s, expected %s", p.describe(pos), ungrammar.FormatRule(rep.Rule))}},
+			}
+			return skipped.concat(res)
+		}
+	}
+	return result{}
+}
+
+// token returns the green token for the input token at pos.
+func (p *Parser) token(pos int) *cst.GreenToken {
+	tok := p.toks[pos]
+	key := tokenKey{p.tokenKind(tok.Kind), tok.Text}
+	gt, ok := p.interned[key]
+	if !ok {
+		gt = cst.NewGreenToken(key.kind, key.text)
+		p.interned[key] = gt
+	}
+	return gt
+}
+
+// errorNode returns an error node with the input tokens in [start, end).
+func (p *Parser) errorNode(start, end int) *cst.GreenNode {
+	var elems []cst.GreenElement
+	for i := start; i < end; i++ {
+		elems = append(elems, p.token(i))
+	}
+	return cst.NewGreenNode(ErrorKind, elems)
+}
+
+// describe describes the input token at pos in messages.
+func (p *Parser) describe(pos int) string {
+	if pos >= len(p.toks) {
+		return "end of input"
+	}
+	return fmt.Sprintf("'%s'", p.toks[pos].Kind)
+}
+
+// Tree returns a view of the syntax tree rooted at n, which was built by p,
+// as an ungrammar.Tree; e.g. to check it with Grammar.CheckTree. Error nodes
+// have the kind "ERROR", which has no rule.
+func (p *Parser) Tree(n *cst.Node) ungrammar.Tree {
+	return &tree{p, n}
+}
+
+type tree struct {
+	p    *Parser
+	elem cst.Element
+}
+
+func (t *tree) Kind() string {
+	name := t.p.KindName(t.elem.Kind())
+	if t.IsToken() {
+		return strings.TrimSuffix(strings.TrimPrefix(name, "'"), "'")
+	}
+	return name
+}
+
+func (t *tree) IsToken() bool {
+	_, ok := t.elem.(*cst.Token)
+	return ok
+}
+
+func (t *tree) Children() []ungrammar.Tree {
+	n, ok := t.elem.(*cst.Node)
+	if !ok {
+		return nil
+	}
+	var children []ungrammar.Tree
+	for _, c := range n.ChildrenWithTokens() {
+		children = append(children, &tree{t.p, c})
+	}
+	return children
+}
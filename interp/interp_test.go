@@ -0,0 +1,269 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package interp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/eliben/go-ungrammar"
+	"github.com/eliben/go-ungrammar/cst"
+	"github.com/eliben/go-ungrammar/sample"
+)
+
+func mustParse(t *testing.T, input string) *ungrammar.Grammar {
+	t.Helper()
+	g, err := ungrammar.NewParser(input).ParseGrammar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+// lex splits input into tokens at spaces: numbers are 'int_literal', other
+// words starting with a letter are 'ident' unless they're in keywords, and
+// anything else is a token of its own kind.
+func lex(input string, keywords ...string) []Token {
+	var toks []Token
+	for _, word := range strings.Fields(input) {
+		kind := word
+		switch c := word[0]; {
+		case c >= '0' && c <= '9':
+			kind = "int_literal"
+		case (c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') && !slices.Contains(keywords, word):
+			kind = "ident"
+		}
+		toks = append(toks, Token{Kind: kind, Text: word})
+	}
+	return toks
+}
+
+// sexpr returns an S-expression for the tree rooted at n, like
+// `(Literal "1")`.
+func sexpr(p *Parser, e cst.Element) string {
+	switch ee := e.(type) {
+	case *cst.Token:
+		return fmt.Sprintf("%q", ee.Text())
+	case *cst.Node:
+		parts := []string{p.KindName(ee.Kind())}
+		for _, c := range ee.ChildrenWithTokens() {
+			parts = append(parts, sexpr(p, c))
+		}
+		return "(" + strings.Join(parts, " ") + ")"
+	}
+	return ""
+}
+
+func loadExprLang(t *testing.T) *ungrammar.Grammar {
+	src, err := os.ReadFile(filepath.Join("..", "testdata", "exprlang.ungrammar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mustParse(t, string(src))
+}
+
+func TestParse(t *testing.T) {
+	p := New(loadExprLang(t))
+	var tests = []struct {
+		input string
+		want  string
+	}{
+		{"", `(Program)`},
+		{"x", `(Program (Literal "x"))`},
+		{"set x = 1", `(Program (AssignStmt "set" "x" "=" (Literal "1")))`},
+		{"- 1", `(Program (UnaryExpr "-" (Literal "1")))`},
+		{"( 1 )", `(Program (ParenExpr "(" (Literal "1") ")"))`},
+		{"1 + 2", `(Program (BinExpr (Literal "1") "+" (Literal "2")))`},
+		{"1 + 2 * 3", `(Program (BinExpr (Literal "1") "+" (BinExpr (Literal "2") "*" (Literal "3"))))`},
+		{"set x = 1 y", `(Program (AssignStmt "set" "x" "=" (Literal "1")) (Literal "y"))`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			root, err := p.Parse("Program", lex(tt.input, "set"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sexpr(p, root); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLeftRecursion(t *testing.T) {
+	g := mustParse(t, `
+List = List ',' 'x' | 'x'
+Path = (qualifier:Path '::')? segment:'ident'
+`)
+	p := New(g)
+	var tests = []struct {
+		root  string
+		input string
+		want  string
+	}{
+		{"List", "x", `(List "x")`},
+		{"List", "x , x , x", `(List (List (List "x") "," "x") "," "x")`},
+		{"Path", "a", `(Path "a")`},
+		{"Path", "a :: b :: c", `(Path (Path (Path "a") "::" "b") "::" "c")`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			root, err := p.Parse(tt.root, lex(tt.input, "x"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sexpr(p, root); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	p := New(loadExprLang(t))
+	var tests = []struct {
+		input   string
+		want    string
+		wantErr string
+	}{
+		{
+			"set x 1",
+			`(Program (AssignStmt "set" "x" (ERROR) (Literal "1")))`,
+			"token 2: expected '=', found 'int_literal'",
+		},
+		{
+			"set x = = 1",
+			`(Program (AssignStmt "set" "x" "=" (ERROR "=") (Literal "1")))`,
+			"token 3: unexpected '=', expected Expr",
+		},
+		{
+			"set x =",
+			`(Program (AssignStmt "set" "x" "=" (ERROR)))`,
+			"token 3: expected Expr, found end of input",
+		},
+		{
+			"( 1 + 2",
+			`(Program (ParenExpr "(" (BinExpr (Literal "1") "+" (Literal "2")) (ERROR)))`,
+			"token 4: expected ')', found end of input",
+		},
+		{
+			"1 )",
+			`(Program (Literal "1") (ERROR ")"))`,
+			"token 1: unexpected ')' after Program",
+		},
+		{
+			"set x = 1 ) ) y",
+			`(Program (AssignStmt "set" "x" "=" (Literal "1")) (ERROR ")" ")") (Literal "y"))`,
+			"token 4: unexpected ')', expected Stmt",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			root, err := p.Parse("Program", lex(tt.input, "set"))
+			if got := sexpr(p, root); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := p.Parse("Nope", nil); err == nil || err.Error() != "undefined rule Nope" {
+		t.Errorf("got error %v for undefined root", err)
+	}
+}
+
+func TestParseRepErrors(t *testing.T) {
+	p := New(mustParse(t, `
+Block = '{' Stmt* '}'
+Stmt = 'ident' ';'
+`))
+	var tests = []struct {
+		input   string
+		want    string
+		wantErr string
+	}{
+		{
+			"{ a ; ) b ; }",
+			`(Block "{" (Stmt "a" ";") (ERROR ")") (Stmt "b" ";") "}")`,
+			"token 3: unexpected ')', expected Stmt",
+		},
+		{
+			"{ a ; ) ; ) b ; c ; }",
+			`(Block "{" (Stmt "a" ";") (ERROR ")" ";" ")") (Stmt "b" ";") (Stmt "c" ";") "}")`,
+			"token 3: unexpected ')', expected Stmt",
+		},
+
+		// Tokens that can follow the repetition end it.
+		{
+			"{ a ; ) ) }",
+			`(Block "{" (Stmt "a" ";") (ERROR ")" ")") "}")`,
+			"token 3: unexpected ')', expected '}'",
+		},
+		{
+			"{ a ; } b ;",
+			`(Block "{" (Stmt "a" ";") "}" (ERROR "b" ";"))`,
+			"token 4: unexpected 'ident' after Block",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			root, err := p.Parse("Block", lex(tt.input))
+			if got := sexpr(p, root); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseCheckTree(t *testing.T) {
+	g := loadExprLang(t)
+	p := New(g)
+	root, err := p.Parse("Program", lex("set x = ( 1 + - y ) * 2 z % 3", "set"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.CheckTree(p.Tree(root)); err != nil {
+		t.Error(err)
+	}
+
+	root, _ = p.Parse("Program", lex("set x 1", "set"))
+	if err := g.CheckTree(p.Tree(root)); err == nil || !strings.Contains(err.Error(), "unexpected node ERROR") {
+		t.Errorf("got error %v, want an error node", err)
+	}
+}
+
+func TestParseSamples(t *testing.T) {
+	g := loadExprLang(t)
+	p := New(g)
+	for seed := range uint64(50) {
+		gen := sample.New(g, sample.Config{Seed: seed, MaxDepth: 6})
+		stoks, err := gen.Tokens("Program")
+		if err != nil {
+			t.Fatal(err)
+		}
+		toks := make([]Token, len(stoks))
+		for i, tok := range stoks {
+			toks[i] = Token{Kind: tok.Kind, Text: tok.Text}
+		}
+		root, err := p.Parse("Program", toks)
+		if err != nil {
+			t.Fatalf("seed %d: %q: %v", seed, sample.Join(stoks), err)
+		}
+		if err := g.CheckTree(p.Tree(root)); err != nil {
+			t.Errorf("seed %d: %v", seed, err)
+		}
+		if got, want := len(root.Tokens()), len(toks); got != want {
+			t.Errorf("seed %d: got %d tokens, want %d", seed, got, want)
+		}
+	}
+}
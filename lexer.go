@@ -12,24 +12,22 @@ import (
 )
 
 // token represents a Ungrammar language token - it has a name (one of the
-// constants declared below), string value and a location.
+// constants declared below), string value and the span of source it occupies.
+// doc holds the text of the comment lines immediately preceding the token, if
+// any (see lexer.nextToken for details). leading holds the trivia (WHITESPACE
+// and COMMENT tokens) between the previous token and this one. For ERROR
+// tokens, value is the error message and code is its diagnostic code.
 //
 // The term "token" is slightly overloaded in this file; in Ungrammar, a quoted
 // string literal is also called a "Token" -- this is just one of the kinds of
 // tokens this lexer returns.
 type token struct {
-	name  tokenName
-	value string
-	loc   location
-}
-
-type location struct {
-	line   int
-	column int
-}
-
-func (loc location) String() string {
-	return fmt.Sprintf("%v:%v", loc.line, loc.column)
+	name    tokenName
+	value   string
+	span    Span
+	doc     string
+	leading []token
+	code    Code
 }
 
 type tokenName int
@@ -39,6 +37,11 @@ const (
 	ERROR tokenName = iota
 	EOF
 
+	// Trivia; these are never returned by nextToken directly, but are attached
+	// to the tokens following them.
+	WHITESPACE
+	COMMENT
+
 	NODE
 	TOKEN
 
@@ -55,6 +58,9 @@ var tokenNames = [...]string{
 	ERROR: "ERROR",
 	EOF:   "EOF",
 
+	WHITESPACE: "WHITESPACE",
+	COMMENT:    "COMMENT",
+
 	NODE:  "NODE",
 	TOKEN: "TOKEN",
 
@@ -68,7 +74,7 @@ var tokenNames = [...]string{
 }
 
 func (tok token) String() string {
-	return fmt.Sprintf("token{%s, '%s', %s}", tokenNames[tok.name], tok.value, tok.loc)
+	return fmt.Sprintf("token{%s, '%s', %s}", tokenNames[tok.name], tok.value, tok.span)
 }
 
 // lexer provides lexical scanning of text into Ungrammar tokens.
@@ -87,21 +93,58 @@ type lexer struct {
 	// Offset of the next rune in buf.
 	nextpos int
 
-	// location of r
-	loc location
+	// Position of r; pos.Offset is always equal to rpos.
+	pos Pos
+
+	// Comment lines of the current comment group, and the line number of the
+	// last one.
+	commentGroup []string
+	commentLine  int
+
+	// Line number where the last token returned by nextToken ended; 0 if no
+	// token was returned yet.
+	prevTokLine int
+
+	// The first comment group in the input, if it's not the doc comment of the
+	// first token.
+	fileDoc string
+
+	// Trivia seen since the last token returned by nextToken.
+	trivia []token
 }
 
-// newLexer creates a new lexer for the given string.
-func newLexer(buf string) *lexer {
+// newLexer creates a new lexer for the given string. filename is only used to
+// populate the positions of tokens, and may be empty.
+func newLexer(filename string, buf string) *lexer {
 	lex := lexer{
 		buf:     buf,
-		r:       -1,
+		r:       0,
 		rpos:    0,
 		nextpos: 0,
 
 		// column starts at 0 since advace() always increments it before we have
-		// the first rune in r
-		loc: location{1, 0},
+		// the first rune in r (or EOF, for empty input)
+		pos: Pos{Filename: filename, Line: 1, Column: 0},
+	}
+
+	lex.advance()
+	return &lex
+}
+
+// newLexerAt is like newLexer, but starts lexing buf at pos rather than at its
+// start. pos must be the start of buf or the end of a token, since the lexer
+// takes the line of pos as the line of the previous token.
+func newLexerAt(buf string, pos Pos) *lexer {
+	if pos.Offset == 0 {
+		return newLexer(pos.Filename, buf)
+	}
+	lex := lexer{
+		buf:     buf,
+		nextpos: pos.Offset,
+
+		// column is decremented since advance() increments it.
+		pos:         Pos{Filename: pos.Filename, Offset: pos.Offset, Line: pos.Line, Column: pos.Column - 1},
+		prevTokLine: pos.Line,
 	}
 
 	lex.advance()
@@ -109,12 +152,38 @@ func newLexer(buf string) *lexer {
 }
 
 // nextToken returns the next token in the input string.
+//
+// Comments are not returned as tokens, but a group of comments on consecutive
+// lines that ends on the line just before a token is attached to that token
+// as its doc. Comments that follow a token on the same line are never part of
+// a doc.
 func (lex *lexer) nextToken() token {
+	tok := lex.scanToken()
+	if len(lex.commentGroup) > 0 {
+		if lex.commentLine == tok.span.Start.Line-1 {
+			tok.doc = commentText(lex.commentGroup)
+		} else if lex.prevTokLine == 0 && lex.fileDoc == "" {
+			lex.fileDoc = commentText(lex.commentGroup)
+		}
+		lex.commentGroup = nil
+	}
+	tok.leading = lex.trivia
+	lex.trivia = nil
+	lex.prevTokLine = tok.span.End.Line
+	return tok
+}
+
+// scanToken scans the next token in the input string, skipping whitespace
+// and comments.
+func (lex *lexer) scanToken() token {
 	lex.skipNontokens()
 
-	rloc := lex.loc
+	rpos := lex.pos
 	if lex.r < 0 {
-		return token{EOF, "<end of input>", rloc}
+		// The end of input is reported at the column of the last rune of its
+		// line (or column 0 on an empty line), not past it.
+		rpos.Column--
+		return token{name: EOF, value: "<end of input>", span: Span{rpos, rpos}}
 	} else if isIdChar(lex.r) {
 		return lex.scanNode()
 	}
@@ -123,30 +192,23 @@ func (lex *lexer) nextToken() token {
 	case '\'':
 		return lex.scanQuoted()
 	case '=':
-		lex.advance()
-		return token{EQ, "=", rloc}
+		return lex.scanPunct(EQ)
 	case '*':
-		lex.advance()
-		return token{STAR, "*", rloc}
+		return lex.scanPunct(STAR)
 	case '?':
-		lex.advance()
-		return token{QMARK, "?", rloc}
+		return lex.scanPunct(QMARK)
 	case '(':
-		lex.advance()
-		return token{LPAREN, "(", rloc}
+		return lex.scanPunct(LPAREN)
 	case ')':
-		lex.advance()
-		return token{RPAREN, ")", rloc}
+		return lex.scanPunct(RPAREN)
 	case '|':
-		lex.advance()
-		return token{PIPE, "|", rloc}
+		return lex.scanPunct(PIPE)
 	case ':':
-		lex.advance()
-		return token{COLON, ":", rloc}
+		return lex.scanPunct(COLON)
 	default:
-		errtok := lex.emitError(fmt.Sprintf("unknown token starting with %q", lex.r), rloc)
+		msg := fmt.Sprintf("unknown token starting with %q", lex.r)
 		lex.advance()
-		return errtok
+		return lex.emitError(CodeUnknownToken, msg, Span{rpos, lex.pos})
 	}
 }
 
@@ -154,10 +216,16 @@ func (lex *lexer) nextToken() token {
 // input. advance is responsible for maintaining the main invariant of the
 // lexer: at any point after advance has been called at least once, lex.r
 // is the current token the lexer is looking at; lex.rpos is its offset
-// the string and lex.loc is its location. lex.nextpost is the offset of the
+// the string and lex.pos is its position. lex.nextpost is the offset of the
 // next token in the input. When the end of the input is reached, lex.r
-// becomes EOF.
+// becomes EOF, and lex.pos is the position just past the last rune.
 func (lex *lexer) advance() {
+	if lex.r == '\n' {
+		lex.pos.Line++
+		// Set column to 0 because it's incremented below
+		lex.pos.Column = 0
+	}
+
 	if lex.nextpos < len(lex.buf) {
 		lex.rpos = lex.nextpos
 		r, w := rune(lex.buf[lex.nextpos]), 1
@@ -168,11 +236,16 @@ func (lex *lexer) advance() {
 
 		lex.nextpos += w
 		lex.r = r
-		lex.loc.column += 1
+		lex.pos.Column += 1
 	} else {
+		if lex.r >= 0 {
+			// First time we reach EOF: it's positioned right after the last rune.
+			lex.pos.Column += 1
+		}
 		lex.rpos = len(lex.buf)
 		lex.r = -1 // EOF
 	}
+	lex.pos.Offset = lex.rpos
 }
 
 // peekNext looks at the next rune in the input, after lex.r. It only works
@@ -185,59 +258,123 @@ func (lex *lexer) peekNext() rune {
 	}
 }
 
-func (lex *lexer) emitError(msg string, loc location) token {
+func (lex *lexer) emitError(code Code, msg string, span Span) token {
 	return token{
 		name:  ERROR,
 		value: msg,
-		loc:   loc,
+		span:  span,
+		code:  code,
 	}
 }
 
 func (lex *lexer) skipNontokens() {
 	for {
 		switch lex.r {
-		case ' ', '\t', '\r':
-			lex.advance()
-		case '\n':
-			lex.loc.line++
-			// Set column to 0 because advance() immediately increments it
-			lex.loc.column = 0
-			lex.advance()
+		case ' ', '\t', '\r', '\n':
+			lex.skipWhitespace()
 		case '/':
-			if lex.peekNext() == '/' {
-				lex.skipLineComment()
+			if lex.peekNext() != '/' {
+				// Not a comment; let scanToken report an error.
+				return
 			}
+			lex.scanComment()
 		default:
 			return
 		}
 	}
 }
 
+// scanComment scans a line comment and adds it to the current comment group,
+// or starts a new group if the comment isn't on the line immediately after the
+// group's last comment.
+func (lex *lexer) scanComment() {
+	line := lex.pos.Line
+	startpos := lex.pos
+	lex.skipLineComment()
+	lex.addTrivia(COMMENT, startpos)
+	text := strings.TrimRight(lex.buf[startpos.Offset:lex.rpos], "\r")
+
+	if line == lex.prevTokLine {
+		// A comment trailing a token on the same line isn't part of any group.
+		return
+	}
+	if len(lex.commentGroup) == 0 || lex.commentLine != line-1 {
+		if len(lex.commentGroup) > 0 && lex.prevTokLine == 0 && lex.fileDoc == "" {
+			lex.fileDoc = commentText(lex.commentGroup)
+		}
+		lex.commentGroup = nil
+	}
+	lex.commentGroup = append(lex.commentGroup, text)
+	lex.commentLine = line
+}
+
+// skipWhitespace skips a run of whitespace and records it as trivia.
+func (lex *lexer) skipWhitespace() {
+	startpos := lex.pos
+	for lex.r == ' ' || lex.r == '\t' || lex.r == '\r' || lex.r == '\n' {
+		lex.advance()
+	}
+	lex.addTrivia(WHITESPACE, startpos)
+}
+
+// addTrivia records a trivia token with the given name, spanning the input
+// from startpos to the current position.
+func (lex *lexer) addTrivia(name tokenName, startpos Pos) {
+	lex.trivia = append(lex.trivia, token{
+		name:  name,
+		value: lex.buf[startpos.Offset:lex.rpos],
+		span:  Span{startpos, lex.pos},
+	})
+}
+
 func (lex *lexer) skipLineComment() {
 	for lex.r != '\n' && lex.r > 0 {
 		lex.advance()
 	}
 }
 
+// commentText returns the text of a comment group: the comment markers (// or
+// ///) and a single space following them are removed from each line, and lines
+// are joined with newlines.
+func commentText(lines []string) string {
+	var sb strings.Builder
+	for i, line := range lines {
+		if i > 0 {
+			sb.WriteByte('\n')
+		}
+		line = strings.TrimPrefix(line, "//")
+		line = strings.TrimPrefix(line, "/")
+		line = strings.TrimPrefix(line, " ")
+		sb.WriteString(line)
+	}
+	return sb.String()
+}
+
+// scanPunct scans a single-rune punctuation token with the given name.
+func (lex *lexer) scanPunct(name tokenName) token {
+	startpos := lex.pos
+	lex.advance()
+	return token{name: name, value: lex.buf[startpos.Offset:lex.rpos], span: Span{startpos, lex.pos}}
+}
+
 func (lex *lexer) scanNode() token {
-	startloc := lex.loc
-	startpos := lex.rpos
+	startpos := lex.pos
 	for isIdChar(lex.r) {
 		lex.advance()
 	}
-	return token{NODE, lex.buf[startpos:lex.rpos], startloc}
+	return token{name: NODE, value: lex.buf[startpos.Offset:lex.rpos], span: Span{startpos, lex.pos}}
 }
 
 func (lex *lexer) scanQuoted() token {
-	startloc := lex.loc
+	startpos := lex.pos
 	lex.advance() // skip leading quote
 	var tokbuf strings.Builder
 	for {
 		if lex.r == '\'' {
 			lex.advance()
-			return token{TOKEN, tokbuf.String(), startloc}
+			return token{name: TOKEN, value: tokbuf.String(), span: Span{startpos, lex.pos}}
 		} else if lex.r == -1 {
-			return lex.emitError("unterminated token literal", startloc)
+			return lex.emitError(CodeUnterminatedToken, "unterminated token literal", Span{startpos, lex.pos})
 		} else if lex.r == '\\' {
 			// Skip the backslash and write the rune following it into the buffer.
 			lex.advance()
@@ -17,7 +17,7 @@ someid
 |
 `
 
-	lex := newLexer(input)
+	lex := newLexer("", input)
 	var toks []token
 
 	for {
@@ -28,36 +28,98 @@ someid
 		}
 	}
 
-	wantToks := []token{
-		token{NODE, "someid", location{2, 1}},
-		token{COLON, ":", location{3, 1}},
-		token{QMARK, "?", location{3, 3}},
-		token{NODE, "anotherid", location{3, 5}},
-		token{TOKEN, "sometok", location{3, 15}},
-		token{LPAREN, "(", location{5, 26}},
-		token{NODE, "idmore", location{5, 28}},
-		token{TOKEN, "tt tt", location{5, 35}},
-		token{RPAREN, ")", location{5, 43}},
-		token{TOKEN, `tt'q`, location{6, 1}},
-		token{TOKEN, `tt\s`, location{6, 9}},
-		token{PIPE, "|", location{7, 1}},
-		token{EOF, "<end of input>", location{8, 0}},
+	wantToks := []struct {
+		name  tokenName
+		value string
+		text  string
+		pos   Pos
+	}{
+		{NODE, "someid", "someid", Pos{"", 1, 2, 1}},
+		{COLON, ":", ":", Pos{"", 8, 3, 1}},
+		{QMARK, "?", "?", Pos{"", 10, 3, 3}},
+		{NODE, "anotherid", "anotherid", Pos{"", 12, 3, 5}},
+		{TOKEN, "sometok", "'sometok'", Pos{"", 22, 3, 15}},
+		{LPAREN, "(", "(", Pos{"", 68, 5, 26}},
+		{NODE, "idmore", "idmore", Pos{"", 70, 5, 28}},
+		{TOKEN, "tt tt", "'tt tt'", Pos{"", 77, 5, 35}},
+		{RPAREN, ")", ")", Pos{"", 85, 5, 43}},
+		{TOKEN, `tt'q`, `'tt\'q'`, Pos{"", 94, 6, 1}},
+		{TOKEN, `tt\s`, `'tt\\s'`, Pos{"", 102, 6, 9}},
+		{PIPE, "|", "|", Pos{"", 110, 7, 1}},
+		{EOF, "<end of input>", "", Pos{"", 112, 8, 0}},
 	}
 
 	if len(wantToks) != len(toks) {
 		t.Fatalf("length mismatch wantToks=%v, toks=%v", len(wantToks), len(toks))
 	}
-	for i := 0; i < len(wantToks); i++ {
-		if wantToks[i] != toks[i] {
-			t.Errorf("mismatch at index %2v: got %v, want %v", i, wantToks[i], toks[i])
+	for i, want := range wantToks {
+		tok := toks[i]
+		if tok.name != want.name || tok.value != want.value || tok.span.Start != want.pos {
+			t.Errorf("mismatch at index %2v: got %v, want %v %q at %+v", i, tok, tokenNames[want.name], want.value, want.pos)
+		}
+		if text := input[tok.span.Start.Offset:tok.span.End.Offset]; text != want.text {
+			t.Errorf("text mismatch at index %2v: got %q, want %q", i, text, want.text)
 		}
 	}
 }
 
+func TestLexerFilename(t *testing.T) {
+	lex := newLexer("foo.ungrammar", "\n  foo")
+	tok := lex.nextToken()
+	wantStart := Pos{"foo.ungrammar", 3, 2, 3}
+	wantEnd := Pos{"foo.ungrammar", 6, 2, 6}
+	if tok.span.Start != wantStart || tok.span.End != wantEnd {
+		t.Errorf("got span %+v, want %+v-%+v", tok.span, wantStart, wantEnd)
+	}
+	if got := tok.span.String(); got != "foo.ungrammar:2:3-2:6" {
+		t.Errorf("got span string %q, want %q", got, "foo.ungrammar:2:3-2:6")
+	}
+}
+
+func TestLexerDocs(t *testing.T) {
+	const input = `// file doc
+// more
+
+// doc of a
+///  for a
+a b // trailing
+c
+// doc of
+//
+// d
+d // trailing
+// doc of e
+
+e`
+
+	wantDocs := map[string]string{
+		"a": "doc of a\n for a",
+		"b": "",
+		"c": "",
+		"d": "doc of\n\nd",
+		"e": "",
+	}
+
+	lex := newLexer("", input)
+	for _, tok := range allTokens(lex) {
+		if tok.name != NODE {
+			continue
+		}
+		if tok.doc != wantDocs[tok.value] {
+			t.Errorf("%s: got doc %q, want %q", tok.value, tok.doc, wantDocs[tok.value])
+		}
+	}
+
+	wantFileDoc := "file doc\nmore"
+	if lex.fileDoc != wantFileDoc {
+		t.Errorf("got file doc %q, want %q", lex.fileDoc, wantFileDoc)
+	}
+}
+
 func TestLexerEOF(t *testing.T) {
 	// Test that we get as many EOF tokens at the end of the input as we ask for.
 	const input = `:  `
-	lex := newLexer(input)
+	lex := newLexer("", input)
 
 	if tok := lex.nextToken(); tok.name != COLON {
 		t.Errorf("got %v, want COLON", tok)
@@ -69,6 +131,29 @@ func TestLexerEOF(t *testing.T) {
 	}
 }
 
+// The end of input is at the column of the last rune of its line, or at
+// column 0 on an empty line, with the offset past the input.
+func TestLexerEOFPosition(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  Pos
+	}{
+		{"", Pos{"", 0, 1, 0}},
+		{"x", Pos{"", 1, 1, 1}},
+		{"x = é  ", Pos{"", 8, 1, 7}},
+		{"x\n", Pos{"", 2, 2, 0}},
+		{"x\r\n// c", Pos{"", 7, 2, 4}},
+	}
+
+	for _, tt := range tests {
+		toks := allTokens(newLexer("", tt.input))
+		eof := toks[len(toks)-1]
+		if eof.span.Start != tt.want || eof.span.End != tt.want {
+			t.Errorf("%q: got EOF span %+v, want %+v", tt.input, eof.span, tt.want)
+		}
+	}
+}
+
 func allTokens(lex *lexer) []token {
 	var toks []token
 	for {
@@ -86,20 +171,21 @@ func TestLexerError(t *testing.T) {
 		input         string
 		errorIndex    int
 		errorValue    string
-		errorLocation location
+		errorLocation Pos
 	}{
-		{`hello $ bye`, 1, `unknown token starting with '$'`, location{1, 7}},
-		{`hello | $no`, 2, `unknown token starting with '$'`, location{1, 9}},
-		{`hello | $no @`, 4, `unknown token starting with '@'`, location{1, 13}},
-		{`he '202020`, 1, `unterminated token literal`, location{1, 4}},
+		{`hello $ bye`, 1, `unknown token starting with '$'`, Pos{"", 6, 1, 7}},
+		{`hello | $no`, 2, `unknown token starting with '$'`, Pos{"", 8, 1, 9}},
+		{`hello | $no @`, 4, `unknown token starting with '@'`, Pos{"", 12, 1, 13}},
+		{`he '202020`, 1, `unterminated token literal`, Pos{"", 3, 1, 4}},
+		{`a / b`, 1, `unknown token starting with '/'`, Pos{"", 2, 1, 3}},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.input, func(t *testing.T) {
-			lex := newLexer(tt.input)
+			lex := newLexer("", tt.input)
 			toks := allTokens(lex)
 			gotTok := toks[tt.errorIndex]
-			if gotTok.name != ERROR || gotTok.value != tt.errorValue || gotTok.loc != tt.errorLocation {
+			if gotTok.name != ERROR || gotTok.value != tt.errorValue || gotTok.span.Start != tt.errorLocation {
 				t.Errorf("got token %s, want ERROR with value=%q loc=%v", gotTok, tt.errorValue, tt.errorLocation)
 			}
 		})
@@ -0,0 +1,129 @@
+// go-ungrammar: completion in the language server.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package lsp
+
+import (
+	"strings"
+
+	"github.com/eliben/go-ungrammar"
+	"github.com/eliben/go-ungrammar/codegen"
+)
+
+// completions returns the completion proposals at the byte offset off: the
+// names of the grammar's rules, and the token literals already used in it.
+//
+// The syntax token at off decides what's proposed: in a rule name, rule names
+// replacing it; in a token literal (even an unterminated one), token literals
+// replacing it (but not the literal itself, unless it appears elsewhere too);
+// in labels and comments, nothing; and anywhere else, both rule names and
+// token literals inserted at off.
+func (d *document) completions(off int) []CompletionItem {
+	var at *ungrammar.SyntaxToken
+	var parent *ungrammar.SyntaxNode
+	var find func(n *ungrammar.SyntaxNode)
+	find = func(n *ungrammar.SyntaxNode) {
+		for _, c := range n.Children() {
+			sp := c.Span()
+			if sp.Start.Offset >= off {
+				return
+			}
+			if off > sp.End.Offset {
+				continue
+			}
+			switch cc := c.(type) {
+			case *ungrammar.SyntaxNode:
+				find(cc)
+			case *ungrammar.SyntaxToken:
+				at, parent = cc, n
+			}
+		}
+	}
+	find(d.tree)
+
+	rules, tokens := true, true
+	var replace *Range
+	skip := -1
+	if at != nil {
+		r := d.rangeOf(at.Span())
+		switch at.Kind() {
+		case ungrammar.KindComment:
+			return []CompletionItem{}
+		case ungrammar.KindIdent:
+			if parent.Kind() == ungrammar.KindLabeled {
+				return []CompletionItem{}
+			}
+			tokens, replace = false, &r
+		case ungrammar.KindLiteral:
+			rules, replace = false, &r
+			skip = at.Span().Start.Offset
+		case ungrammar.KindBadToken:
+			if strings.HasPrefix(at.Text(), "'") {
+				// Unterminated literals extend to the end of the text, so only
+				// replace them up to off.
+				r.End = d.position(off)
+				rules, replace = false, &r
+			}
+		}
+	}
+
+	items := []CompletionItem{}
+	if rules {
+		for _, name := range d.grammar.OrderedNames() {
+			item := CompletionItem{Label: name, Kind: CompletionKindStruct}
+			if r := d.grammar.Rules[name]; r != nil {
+				item.Detail = formatRule(r)
+				if isEnum(r) {
+					item.Kind = CompletionKindEnum
+				}
+			}
+			if doc := d.grammar.Docs[name]; doc != "" {
+				item.Documentation = &MarkupContent{Kind: "markdown", Value: doc}
+			}
+			items = append(items, item)
+		}
+	}
+	if tokens {
+		for _, value := range d.tokenValues(skip) {
+			class := codegen.ClassifyToken(value)
+			item := CompletionItem{Label: ungrammar.FormatRule(&ungrammar.Token{Value: value}), Detail: class.String()}
+			switch class {
+			case codegen.Punct:
+				item.Kind = CompletionKindOperator
+			case codegen.Keyword:
+				item.Kind = CompletionKindKeyword
+			default:
+				item.Kind = CompletionKindConstant
+			}
+			items = append(items, item)
+		}
+	}
+	if replace != nil {
+		for i := range items {
+			items[i].FilterText = items[i].Label
+			items[i].TextEdit = &TextEdit{Range: *replace, NewText: items[i].Label}
+		}
+	}
+	return items
+}
+
+// tokenValues returns the values of the token literals of the grammar, in
+// order of first appearance, leaving out the literal at the byte offset skip.
+func (d *document) tokenValues(skip int) []string {
+	var values []string
+	seen := make(map[string]bool)
+	for _, name := range d.grammar.OrderedNames() {
+		if r := d.grammar.Rules[name]; r != nil {
+			ungrammar.Inspect(r, func(r ungrammar.Rule) bool {
+				if tok, ok := r.(*ungrammar.Token); ok && !seen[tok.Value] && tok.Location().Offset != skip {
+					seen[tok.Value] = true
+					values = append(values, tok.Value)
+				}
+				return true
+			})
+		}
+	}
+	return values
+}
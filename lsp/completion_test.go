@@ -0,0 +1,90 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package lsp
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompletions(t *testing.T) {
+	// The cursor is at the $ in inputs.
+	const grammar = `// Expressions.
+Expr = lhs:Term '+' rhs:Term
+Term = 'number' | 'fn' | Paren
+Paren = '(' Expr ')'
+`
+	var tests = []struct {
+		input string
+		want  []string
+	}{
+		// Both rule names and tokens after whitespace.
+		{grammar + "X = $", []string{
+			"Expr", "Term", "Paren",
+			"'+'", "'number'", "'fn'", "'('", "')'",
+		}},
+
+		// Rule names in a rule name, replacing it.
+		{grammar + "X = Te$", []string{
+			"Expr 4:4-4:6", "Term 4:4-4:6", "Paren 4:4-4:6", "X 4:4-4:6",
+		}},
+		{grammar + "X = Te$rm", []string{
+			"Expr 4:4-4:8", "Term 4:4-4:8", "Paren 4:4-4:8", "X 4:4-4:8",
+		}},
+
+		// Token literals in a literal, replacing it, even unterminated.
+		{grammar + "X = 'n$' 'fn'", []string{
+			"'+' 4:4-4:7", "'number' 4:4-4:7", "'fn' 4:4-4:7", "'(' 4:4-4:7", "')' 4:4-4:7",
+		}},
+		{grammar + "X = 'n$", []string{
+			"'+' 4:4-4:6", "'number' 4:4-4:6", "'fn' 4:4-4:6", "'(' 4:4-4:6", "')' 4:4-4:6",
+		}},
+
+		// Nothing in labels and comments.
+		{grammar + "X = lab$:Expr", []string{}},
+		{"// Ex$\n" + grammar, []string{}},
+
+		// The rest of a grammar broken by syntax errors is still known.
+		{"A = 'a' | | B\nB = 'b' C\nC = $", []string{"A", "B", "'a'", "'b'"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			off := strings.IndexByte(tt.input, '$')
+			d := newDocument(testURI, 1, strings.Replace(tt.input, "$", "", 1), nil)
+			got := []string{}
+			for _, item := range d.completions(off) {
+				s := item.Label
+				if item.TextEdit != nil {
+					r := item.TextEdit.Range
+					s += fmt.Sprintf(" %d:%d-%d:%d", r.Start.Line, r.Start.Character, r.End.Line, r.End.Character)
+				}
+				got = append(got, s)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got completions %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompletionItems(t *testing.T) {
+	d := newDocument(testURI, 1, "// Sums.\nS = T '+' 'fn' 'int_number'\nT = S | U\nU = 'x'\n", nil)
+	items := d.completions(len(d.text))
+	want := []CompletionItem{
+		{Label: "S", Kind: CompletionKindStruct, Detail: "T '+' 'fn' 'int_number'",
+			Documentation: &MarkupContent{Kind: "markdown", Value: "Sums."}},
+		{Label: "T", Kind: CompletionKindEnum, Detail: "S | U"},
+		{Label: "U", Kind: CompletionKindStruct, Detail: "'x'"},
+		{Label: "'+'", Kind: CompletionKindOperator, Detail: "punctuation"},
+		{Label: "'fn'", Kind: CompletionKindKeyword, Detail: "keyword"},
+		{Label: "'int_number'", Kind: CompletionKindConstant, Detail: "literal"},
+		{Label: "'x'", Kind: CompletionKindKeyword, Detail: "keyword"},
+	}
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("got items\n%+v\nwant\n%+v", items, want)
+	}
+}
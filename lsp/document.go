@@ -0,0 +1,263 @@
+// go-ungrammar: documents of the language server.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package lsp
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/eliben/go-ungrammar"
+	"github.com/eliben/go-ungrammar/analysis"
+)
+
+// document is an open text document, with the grammar parsed from it.
+type document struct {
+	uri     string
+	version int
+	text    string
+	roots   []string
+
+	// lineStarts holds the byte offsets of the starts of lines.
+	lineStarts []int
+
+	// grammar is parsed from text; if there are syntax errors, it's the
+	// partial grammar returned by the parser.
+	grammar *ungrammar.Grammar
+	diags   ungrammar.ErrorList
+
+	// tree is the lossless syntax tree of text, which covers all of it even
+	// if there are syntax errors.
+	tree *ungrammar.SyntaxNode
+
+	// refs lists the references to rules in the grammar, in source order.
+	refs []*ungrammar.Node
+}
+
+// newDocument returns the document with the given text, parsed and checked;
+// roots are passed to Grammar.Validate.
+func newDocument(uri string, version int, text string, roots []string) *document {
+	d := &document{uri: uri, version: version, text: text, roots: roots, lineStarts: lineStarts(text)}
+
+	g, err := ungrammar.NewFileParser(uri, text).ParseGrammar()
+	d.grammar = g
+	d.diags = errorList(err)
+	if err == nil {
+		d.diags = append(d.diags, errorList(g.Validate(roots...))...)
+		d.diags = append(d.diags, analysis.Check(g)...)
+	}
+	d.diags.Sort()
+	d.tree, _ = ungrammar.NewFileParser(uri, text).ParseSyntaxTree()
+
+	for _, name := range g.OrderedNames() {
+		if r := g.Rules[name]; r != nil {
+			ungrammar.Inspect(r, func(r ungrammar.Rule) bool {
+				if node, ok := r.(*ungrammar.Node); ok {
+					d.refs = append(d.refs, node)
+				}
+				return true
+			})
+		}
+	}
+	sort.SliceStable(d.refs, func(i, j int) bool {
+		return d.refs[i].Location().Offset < d.refs[j].Location().Offset
+	})
+	return d
+}
+
+// lineStarts returns the byte offsets of the starts of the lines of text.
+func lineStarts(text string) []int {
+	starts := []int{0}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return starts
+}
+
+func errorList(err error) ungrammar.ErrorList {
+	var errs ungrammar.ErrorList
+	if errors.As(err, &errs) {
+		return errs
+	}
+	return nil
+}
+
+// position returns the LSP position of the byte offset off.
+func (d *document) position(off int) Position {
+	off = max(0, min(off, len(d.text)))
+	line := sort.Search(len(d.lineStarts), func(i int) bool { return d.lineStarts[i] > off }) - 1
+	return Position{Line: line, Character: utf16Len(d.text[d.lineStarts[line]:off])}
+}
+
+// offset returns the byte offset of the LSP position pos; positions past the
+// end of a line or of the text are clamped.
+func (d *document) offset(pos Position) int {
+	if pos.Line < 0 {
+		return 0
+	}
+	if pos.Line >= len(d.lineStarts) {
+		return len(d.text)
+	}
+	off := d.lineStarts[pos.Line]
+	for units := 0; off < len(d.text) && d.text[off] != '\n' && units < pos.Character; {
+		r, size := utf8.DecodeRuneInString(d.text[off:])
+		units += len(utf16.Encode([]rune{r}))
+		off += size
+	}
+	return off
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += len(utf16.Encode([]rune{r}))
+	}
+	return n
+}
+
+// rangeOf returns the LSP range of sp.
+func (d *document) rangeOf(sp ungrammar.Span) Range {
+	end := sp.End.Offset
+	if !sp.End.IsValid() {
+		end = sp.Start.Offset
+	}
+	return Range{d.position(sp.Start.Offset), d.position(end)}
+}
+
+// nameSpan returns the span of the name of the rule name in its definition.
+func (d *document) nameSpan(name string) ungrammar.Span {
+	start := d.grammar.NameLoc[name]
+	end := start
+	end.Offset += len(name)
+	end.Column += utf8.RuneCountInString(name)
+	return ungrammar.Span{Start: start, End: end}
+}
+
+// ruleSpan returns the span of the definition of the rule name, from its name
+// to the end of its rule.
+func (d *document) ruleSpan(name string) ungrammar.Span {
+	sp := d.nameSpan(name)
+	if r := d.grammar.Rules[name]; r != nil && r.Span().End.IsValid() {
+		sp.End = r.Span().End
+	}
+	return sp
+}
+
+// nameAt returns the name of the rule at the byte offset off, either in its
+// definition or in a reference, along with the span of the name there; off
+// may be just past the end of the name. ok is false if there's no rule name
+// at off.
+func (d *document) nameAt(off int) (name string, sp ungrammar.Span, ok bool) {
+	contains := func(sp ungrammar.Span) bool {
+		return sp.Start.Offset <= off && off <= sp.End.Offset
+	}
+	for _, n := range d.grammar.OrderedNames() {
+		if sp := d.nameSpan(n); contains(sp) {
+			return n, sp, true
+		}
+	}
+	for _, ref := range d.refs {
+		if contains(ref.Span()) {
+			return ref.Name, ref.Span(), true
+		}
+	}
+	return "", ungrammar.Span{}, false
+}
+
+// references returns the spans of the references to the rule name, in source
+// order; with decl, the span of its definition's name is included too.
+func (d *document) references(name string, decl bool) []ungrammar.Span {
+	var spans []ungrammar.Span
+	if _, ok := d.grammar.NameLoc[name]; ok && decl {
+		spans = append(spans, d.nameSpan(name))
+	}
+	for _, ref := range d.refs {
+		if ref.Name == name {
+			spans = append(spans, ref.Span())
+		}
+	}
+	slices.SortFunc(spans, func(a, b ungrammar.Span) int { return a.Start.Offset - b.Start.Offset })
+	return spans
+}
+
+// definitionText returns the definition of the rule name in canonical
+// Ungrammar syntax, without its doc comment.
+func (d *document) definitionText(name string) string {
+	single := &ungrammar.Grammar{
+		Rules: map[string]ungrammar.Rule{name: d.grammar.Rules[name]},
+		Names: []string{name},
+	}
+	var buf bytes.Buffer
+	if err := single.Format(&buf); err != nil {
+		// Parts of the rule are missing due to syntax errors.
+		return name + " = …"
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// formatRule returns r in Ungrammar syntax, or "" if parts of r are missing
+// due to syntax errors.
+func formatRule(r ungrammar.Rule) string {
+	if !isComplete(r) {
+		return ""
+	}
+	return ungrammar.FormatRule(r)
+}
+
+// isComplete reports whether r has no missing (nil) parts.
+func isComplete(r ungrammar.Rule) bool {
+	switch rr := r.(type) {
+	case nil:
+		return false
+	case *ungrammar.Labeled:
+		return isComplete(rr.Rule)
+	case *ungrammar.Seq:
+		return !slices.ContainsFunc(rr.Rules, func(r ungrammar.Rule) bool { return !isComplete(r) })
+	case *ungrammar.Alt:
+		return !slices.ContainsFunc(rr.Rules, func(r ungrammar.Rule) bool { return !isComplete(r) })
+	case *ungrammar.Opt:
+		return isComplete(rr.Rule)
+	case *ungrammar.Rep:
+		return isComplete(rr.Rule)
+	}
+	return true
+}
+
+// diagnostics returns the diagnostics of the document in LSP form. Unused
+// rule warnings are reported as hints unless the document has roots.
+func (d *document) diagnostics() []Diagnostic {
+	diags := []Diagnostic{}
+	for _, diag := range d.diags {
+		ld := Diagnostic{
+			Range:    d.rangeOf(diag.Span),
+			Severity: SeverityError,
+			Code:     string(diag.Code),
+			Source:   "ungrammar",
+			Message:  diag.Message,
+		}
+		if diag.Severity == ungrammar.SeverityWarning {
+			ld.Severity = SeverityWarning
+		}
+		if diag.Code == ungrammar.CodeUnusedRule && len(d.roots) == 0 {
+			ld.Severity = SeverityHint
+			ld.Tags = []int{TagUnnecessary}
+		}
+		for _, rel := range diag.Related {
+			ld.RelatedInformation = append(ld.RelatedInformation, DiagnosticRelatedInformation{
+				Location: Location{URI: d.uri, Range: d.rangeOf(rel.Span)},
+				Message:  rel.Message,
+			})
+		}
+		diags = append(diags, ld)
+	}
+	return diags
+}
@@ -0,0 +1,124 @@
+// go-ungrammar: semantic tokens of the language server.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package lsp
+
+import (
+	"strings"
+
+	"github.com/eliben/go-ungrammar"
+)
+
+// Semantic token types and modifiers, as indices into the legend.
+const (
+	semType = iota
+	semProperty
+	semString
+	semOperator
+	semComment
+)
+
+const (
+	semModDefinition = 1 << iota
+)
+
+// semanticLegend is the legend of the semantic tokens reported by the server:
+// rule names are types (with the definition modifier where they're defined),
+// labels are properties, quoted tokens are strings and quantifiers are
+// operators.
+var semanticLegend = SemanticTokensLegend{
+	TokenTypes:     []string{"type", "property", "string", "operator", "comment"},
+	TokenModifiers: []string{"definition"},
+}
+
+// semanticToken is a classified range of a single line of the document.
+type semanticToken struct {
+	start, end int // byte offsets
+	typ, mods  int
+}
+
+// semanticTokens classifies the tokens of the document's syntax tree. Since
+// the tree covers the whole text even if it has syntax errors, this works on
+// broken documents too; in input skipped by the parser, only quoted tokens,
+// comments and the names of known rules are classified.
+func (d *document) semanticTokens() []semanticToken {
+	var toks []semanticToken
+	add := func(sp ungrammar.Span, typ, mods int) {
+		// Tokens can't span lines in LSP, so multi-line token literals are
+		// split at line ends.
+		start := sp.Start.Offset
+		for {
+			nl := strings.IndexByte(d.text[start:sp.End.Offset], '\n')
+			if nl < 0 {
+				break
+			}
+			if nl > 0 {
+				toks = append(toks, semanticToken{start, start + nl, typ, mods})
+			}
+			start += nl + 1
+		}
+		if start < sp.End.Offset {
+			toks = append(toks, semanticToken{start, sp.End.Offset, typ, mods})
+		}
+	}
+
+	var visit func(n *ungrammar.SyntaxNode)
+	visit = func(n *ungrammar.SyntaxNode) {
+		sawName := false
+		for _, c := range n.Children() {
+			if cn, ok := c.(*ungrammar.SyntaxNode); ok {
+				visit(cn)
+				continue
+			}
+			switch c.Kind() {
+			case ungrammar.KindComment:
+				add(c.Span(), semComment, 0)
+			case ungrammar.KindLiteral:
+				add(c.Span(), semString, 0)
+			case ungrammar.KindBadToken:
+				// Unterminated token literals.
+				if strings.HasPrefix(c.Text(), "'") {
+					add(c.Span(), semString, 0)
+				}
+			case ungrammar.KindStar, ungrammar.KindQmark:
+				add(c.Span(), semOperator, 0)
+			case ungrammar.KindIdent:
+				switch n.Kind() {
+				case ungrammar.KindDefinition:
+					if !sawName {
+						add(c.Span(), semType, semModDefinition)
+						sawName = true
+					}
+				case ungrammar.KindNode:
+					add(c.Span(), semType, 0)
+				case ungrammar.KindLabeled:
+					add(c.Span(), semProperty, 0)
+				case ungrammar.KindError:
+					if _, ok := d.grammar.Rules[c.Text()]; ok {
+						add(c.Span(), semType, 0)
+					}
+				}
+			}
+		}
+	}
+	visit(d.tree)
+	return toks
+}
+
+// encodeSemanticTokens encodes toks in the relative form of SemanticTokens.
+func (d *document) encodeSemanticTokens(toks []semanticToken) SemanticTokens {
+	data := []int{}
+	var prev Position
+	for _, tok := range toks {
+		start := d.position(tok.start)
+		char := start.Character
+		if start.Line == prev.Line {
+			char -= prev.Character
+		}
+		data = append(data, start.Line-prev.Line, char, utf16Len(d.text[tok.start:tok.end]), tok.typ, tok.mods)
+		prev = start
+	}
+	return SemanticTokens{Data: data}
+}
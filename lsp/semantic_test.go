@@ -0,0 +1,63 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package lsp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSemanticTokens(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  []string
+	}{
+		{"x = a:y* 'b'? // c\ny = 'b'", []string{
+			"type+def x", "property a", "type y", "operator *", "string 'b'", "operator ?", "comment // c",
+			"type+def y", "string 'b'",
+		}},
+
+		// Multi-line token literals are split at line ends.
+		{"x = 'a\nb'", []string{"type+def x", "string 'a", "string b'"}},
+
+		// Classification continues past syntax errors; in skipped input, only
+		// known rule names and token literals are classified.
+		{"x = y | | z\n@ y 'q' w\ny = 'u'\nv = 'open", []string{
+			"type+def x", "type y", "type y", "string 'q'",
+			"type+def y", "string 'u'", "type+def v", "string 'open",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			d := newDocument(testURI, 1, tt.input, nil)
+			var got []string
+			for _, tok := range d.semanticTokens() {
+				s := semanticLegend.TokenTypes[tok.typ]
+				if tok.mods&semModDefinition != 0 {
+					s += "+def"
+				}
+				got = append(got, s+" "+d.text[tok.start:tok.end])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got tokens %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeSemanticTokens(t *testing.T) {
+	d := newDocument(testURI, 1, "x = 'é' y\n\ny = 'z'", nil)
+	got := d.encodeSemanticTokens(d.semanticTokens()).Data
+	want := []int{
+		0, 0, 1, semType, semModDefinition,
+		0, 4, 3, semString, 0,
+		0, 4, 1, semType, 0,
+		2, 0, 1, semType, semModDefinition,
+		0, 4, 3, semString, 0,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got data %v, want %v", got, want)
+	}
+}
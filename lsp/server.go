@@ -0,0 +1,451 @@
+// go-ungrammar: language server.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+// Package lsp implements a Language Server Protocol server for Ungrammar
+// files; see the cmd/ungrammar-lsp command for running it over stdio.
+//
+// The server keeps the open documents parsed, and publishes diagnostics for
+// them: syntax errors from the parser, and once a document parses, problems
+// found by Grammar.Validate and analysis.Check. It supports going to the
+// definition of a rule, finding the references to a rule, hovering over rule
+// names to see their definitions, document symbols for the outline of a
+// grammar, and renaming rules. It also completes rule names and token
+// literals, and provides semantic tokens for highlighting rule definitions,
+// rule references, labels, token literals and quantifiers. Completion and
+// highlighting work on the lossless syntax tree of documents, so they keep
+// working in documents with syntax errors.
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/eliben/go-ungrammar"
+)
+
+// Options configures the server. Clients can set them in the
+// initializationOptions of the initialize request, e.g.
+// {"roots": ["SourceFile"]}.
+type Options struct {
+	// Roots are the entry rules of grammars, passed to Grammar.Validate: rules
+	// that can't be reached from them are reported. Without roots, rules that
+	// aren't referenced by other rules are reported as hints (which editors
+	// typically show as faded text) rather than warnings, since the entry
+	// rules of a grammar are among them.
+	Roots []string `json:"roots,omitempty"`
+}
+
+// Server is a language server for Ungrammar files.
+type Server struct {
+	conn *conn
+	opts Options
+	docs map[string]*document
+
+	initialized  bool
+	shutdown     bool
+	exitReceived bool
+}
+
+// NewServer returns a server reading messages from in and writing messages to
+// out.
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{conn: newConn(in, out), docs: make(map[string]*document)}
+}
+
+// Run serves requests until the client sends the exit notification or closes
+// the input. It returns nil if the client shut the server down properly
+// (with a shutdown request before the exit notification or the end of the
+// input), and an error otherwise.
+func (s *Server) Run() error {
+	for !s.exitReceived {
+		msg, err := s.conn.read()
+		if err != nil {
+			var rerr *responseError
+			if errors.As(err, &rerr) {
+				// The ID of a message that can't be parsed is unknown, which
+				// the response tells with a null ID.
+				nullID := json.RawMessage("null")
+				if err := s.conn.write(&message{ID: &nullID, Error: rerr}); err != nil {
+					return err
+				}
+				continue
+			}
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		if err := s.handle(msg); err != nil {
+			return err
+		}
+	}
+	if !s.shutdown {
+		return errors.New("lsp: exit without shutdown")
+	}
+	return nil
+}
+
+// handler handles a request or notification with the given params. The
+// result of a request is marshaled into its response.
+type handler func(s *Server, params json.RawMessage) (any, error)
+
+var handlers map[string]handler
+
+func init() {
+	handlers = map[string]handler{
+		"initialize":                       (*Server).initialize,
+		"initialized":                      func(*Server, json.RawMessage) (any, error) { return nil, nil },
+		"shutdown":                         (*Server).shutdownRequest,
+		"exit":                             (*Server).exit,
+		"textDocument/didOpen":             (*Server).didOpen,
+		"textDocument/didChange":           (*Server).didChange,
+		"textDocument/didClose":            (*Server).didClose,
+		"textDocument/definition":          (*Server).definition,
+		"textDocument/references":          (*Server).references,
+		"textDocument/hover":               (*Server).hover,
+		"textDocument/documentSymbol":      (*Server).documentSymbol,
+		"textDocument/prepareRename":       (*Server).prepareRename,
+		"textDocument/rename":              (*Server).rename,
+		"textDocument/completion":          (*Server).completion,
+		"textDocument/semanticTokens/full": (*Server).semanticTokens,
+	}
+}
+
+// handle handles a message, responding to it if it's a request. It only
+// returns errors writing to the client.
+func (s *Server) handle(msg *message) error {
+	isRequest := msg.ID != nil
+	h, ok := handlers[msg.Method]
+	var result any
+	var err error
+	switch {
+	case !ok:
+		err = &responseError{codeMethodNotFound, fmt.Sprintf("method not found: %s", msg.Method)}
+	case !s.initialized && msg.Method != "initialize" && msg.Method != "exit":
+		err = &responseError{codeServerNotInitialized, "server not initialized"}
+	case s.shutdown && msg.Method != "exit":
+		err = &responseError{codeInvalidRequest, "server is shutting down"}
+	default:
+		result, err = h(s, msg.Params)
+	}
+	if !isRequest {
+		// Errors in notifications can't be reported.
+		return nil
+	}
+
+	resp := &message{ID: msg.ID}
+	if err != nil {
+		var rerr *responseError
+		if !errors.As(err, &rerr) {
+			rerr = &responseError{codeRequestFailed, err.Error()}
+		}
+		resp.Error = rerr
+	} else {
+		data, merr := json.Marshal(result)
+		if merr != nil {
+			return merr
+		}
+		resp.Result = data
+	}
+	return s.conn.write(resp)
+}
+
+// notify sends a notification to the client.
+func (s *Server) notify(method string, params any) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return s.conn.write(&message{Method: method, Params: data})
+}
+
+// unmarshalParams decodes params into v.
+func unmarshalParams(params json.RawMessage, v any) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &responseError{codeInvalidParams, err.Error()}
+	}
+	return nil
+}
+
+func (s *Server) initialize(params json.RawMessage) (any, error) {
+	var p InitializeParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.InitializationOptions != nil {
+		s.opts = *p.InitializationOptions
+	}
+	s.initialized = true
+	return InitializeResult{
+		Capabilities: ServerCapabilities{
+			TextDocumentSync:       SyncFull,
+			DefinitionProvider:     true,
+			ReferencesProvider:     true,
+			HoverProvider:          true,
+			DocumentSymbolProvider: true,
+			RenameProvider:         &RenameOptions{PrepareProvider: true},
+			CompletionProvider:     &CompletionOptions{TriggerCharacters: []string{"'"}},
+			SemanticTokensProvider: &SemanticTokensOptions{Legend: semanticLegend, Full: true},
+		},
+		ServerInfo: ServerInfo{Name: "ungrammar-lsp"},
+	}, nil
+}
+
+func (s *Server) shutdownRequest(json.RawMessage) (any, error) {
+	s.shutdown = true
+	return nil, nil
+}
+
+func (s *Server) exit(json.RawMessage) (any, error) {
+	s.exitReceived = true
+	return nil, nil
+}
+
+// update replaces the document at uri with one with the given text, and
+// publishes its diagnostics.
+func (s *Server) update(uri string, version int, text string) error {
+	doc := newDocument(uri, version, text, s.opts.Roots)
+	s.docs[uri] = doc
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         uri,
+		Version:     version,
+		Diagnostics: doc.diagnostics(),
+	})
+}
+
+func (s *Server) didOpen(params json.RawMessage) (any, error) {
+	var p DidOpenTextDocumentParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	return nil, s.update(p.TextDocument.URI, p.TextDocument.Version, p.TextDocument.Text)
+}
+
+func (s *Server) didChange(params json.RawMessage) (any, error) {
+	var p DidChangeTextDocumentParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	text := doc.text
+	for _, change := range p.ContentChanges {
+		if change.Range == nil {
+			text = change.Text
+			continue
+		}
+		// Ranges are relative to the text after the previous changes.
+		d := &document{text: text, lineStarts: lineStarts(text)}
+		start, end := d.offset(change.Range.Start), d.offset(change.Range.End)
+		text = text[:start] + change.Text + text[end:]
+	}
+	return nil, s.update(p.TextDocument.URI, p.TextDocument.Version, text)
+}
+
+func (s *Server) didClose(params json.RawMessage) (any, error) {
+	var p DidCloseTextDocumentParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	delete(s.docs, p.TextDocument.URI)
+	return nil, s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         p.TextDocument.URI,
+		Diagnostics: []Diagnostic{},
+	})
+}
+
+func (s *Server) document(uri string) (*document, error) {
+	doc, ok := s.docs[uri]
+	if !ok {
+		return nil, fmt.Errorf("unknown document %s", uri)
+	}
+	return doc, nil
+}
+
+// nameAt decodes params and returns the document and the rule name at the
+// position they refer to; ok is false if there's no rule name there.
+func (s *Server) nameAt(params json.RawMessage, p any, pos *TextDocumentPositionParams) (doc *document, name string, sp ungrammar.Span, ok bool, err error) {
+	if err := unmarshalParams(params, p); err != nil {
+		return nil, "", ungrammar.Span{}, false, err
+	}
+	doc, err = s.document(pos.TextDocument.URI)
+	if err != nil {
+		return nil, "", ungrammar.Span{}, false, err
+	}
+	name, sp, ok = doc.nameAt(doc.offset(pos.Position))
+	return doc, name, sp, ok, nil
+}
+
+func (s *Server) definition(params json.RawMessage) (any, error) {
+	var p TextDocumentPositionParams
+	doc, name, _, ok, err := s.nameAt(params, &p, &p)
+	if err != nil || !ok {
+		return nil, err
+	}
+	if _, defined := doc.grammar.NameLoc[name]; !defined {
+		return nil, nil
+	}
+	return Location{URI: doc.uri, Range: doc.rangeOf(doc.nameSpan(name))}, nil
+}
+
+func (s *Server) references(params json.RawMessage) (any, error) {
+	var p ReferenceParams
+	doc, name, _, ok, err := s.nameAt(params, &p, &p.TextDocumentPositionParams)
+	if err != nil || !ok {
+		return nil, err
+	}
+	locs := []Location{}
+	for _, sp := range doc.references(name, p.Context.IncludeDeclaration) {
+		locs = append(locs, Location{URI: doc.uri, Range: doc.rangeOf(sp)})
+	}
+	return locs, nil
+}
+
+func (s *Server) hover(params json.RawMessage) (any, error) {
+	var p TextDocumentPositionParams
+	doc, name, sp, ok, err := s.nameAt(params, &p, &p)
+	if err != nil || !ok {
+		return nil, err
+	}
+	if _, defined := doc.grammar.Rules[name]; !defined {
+		return nil, nil
+	}
+	value := "```ungrammar\n" + doc.definitionText(name) + "\n```"
+	if d := doc.grammar.Docs[name]; d != "" {
+		value += "\n\n" + d
+	}
+	r := doc.rangeOf(sp)
+	return Hover{Contents: MarkupContent{Kind: "markdown", Value: value}, Range: &r}, nil
+}
+
+func (s *Server) documentSymbol(params json.RawMessage) (any, error) {
+	var p DocumentSymbolParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	symbols := []DocumentSymbol{}
+	for _, name := range doc.grammar.OrderedNames() {
+		r := doc.grammar.Rules[name]
+		sym := DocumentSymbol{
+			Name:           name,
+			Kind:           SymbolKindStruct,
+			Range:          doc.rangeOf(doc.ruleSpan(name)),
+			SelectionRange: doc.rangeOf(doc.nameSpan(name)),
+		}
+		if r != nil {
+			sym.Detail = formatRule(r)
+			if isEnum(r) {
+				sym.Kind = SymbolKindEnum
+			}
+			ungrammar.Inspect(r, func(r ungrammar.Rule) bool {
+				if lbl, ok := r.(*ungrammar.Labeled); ok {
+					start := lbl.Location()
+					end := start
+					end.Offset += len(lbl.Label)
+					sym.Children = append(sym.Children, DocumentSymbol{
+						Name:           lbl.Label,
+						Detail:         formatRule(lbl.Rule),
+						Kind:           SymbolKindField,
+						Range:          doc.rangeOf(lbl.Span()),
+						SelectionRange: doc.rangeOf(ungrammar.Span{Start: start, End: end}),
+					})
+				}
+				return true
+			})
+		}
+		symbols = append(symbols, sym)
+	}
+	return symbols, nil
+}
+
+// isEnum reports whether r is an alternation of rule names.
+func isEnum(r ungrammar.Rule) bool {
+	alt, ok := r.(*ungrammar.Alt)
+	if !ok {
+		return false
+	}
+	for _, sub := range alt.Rules {
+		if _, ok := sub.(*ungrammar.Node); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) prepareRename(params json.RawMessage) (any, error) {
+	var p TextDocumentPositionParams
+	doc, name, sp, ok, err := s.nameAt(params, &p, &p)
+	if err != nil || !ok {
+		return nil, err
+	}
+	if _, defined := doc.grammar.Rules[name]; !defined {
+		return nil, nil
+	}
+	return PrepareRenameResult{Range: doc.rangeOf(sp), Placeholder: name}, nil
+}
+
+func (s *Server) rename(params json.RawMessage) (any, error) {
+	var p RenameParams
+	doc, name, _, ok, err := s.nameAt(params, &p, &p.TextDocumentPositionParams)
+	if err != nil {
+		return nil, err
+	}
+	if _, defined := doc.grammar.Rules[name]; !ok || !defined {
+		return nil, errors.New("no rule to rename here")
+	}
+	if !isName(p.NewName) {
+		return nil, fmt.Errorf("%q isn't a valid rule name", p.NewName)
+	}
+	if _, exists := doc.grammar.Rules[p.NewName]; exists && p.NewName != name {
+		return nil, fmt.Errorf("rule %s already exists", p.NewName)
+	}
+
+	edits := []TextEdit{}
+	for _, sp := range doc.references(name, true) {
+		edits = append(edits, TextEdit{Range: doc.rangeOf(sp), NewText: p.NewName})
+	}
+	return WorkspaceEdit{Changes: map[string][]TextEdit{doc.uri: edits}}, nil
+}
+
+func (s *Server) completion(params json.RawMessage) (any, error) {
+	var p CompletionParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return doc.completions(doc.offset(p.Position)), nil
+}
+
+func (s *Server) semanticTokens(params json.RawMessage) (any, error) {
+	var p SemanticTokensParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return doc.encodeSemanticTokens(doc.semanticTokens()), nil
+}
+
+// isName reports whether s is a valid rule name: a non-empty sequence of
+// letters and underscores.
+func isName(s string) bool {
+	return s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return r != '_' && !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z')
+	}) < 0
+}
@@ -0,0 +1,506 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testURI = "file:///test.ungram"
+
+const testGrammar = `// A sum of terms.
+Expr = lhs:Term '+' rhs:Term
+
+Term = Num | Paren
+
+Paren = '(' Expr ')'
+
+Num = 'number'
+`
+
+// session is a scripted client session: requests and notifications are
+// queued up, then run runs them through a server in one go.
+type session struct {
+	in     bytes.Buffer
+	nextID int
+}
+
+func (s *session) send(id *int, method string, params any) {
+	msg := map[string]any{"jsonrpc": "2.0", "method": method}
+	if id != nil {
+		msg["id"] = *id
+	}
+	if params != nil {
+		msg["params"] = params
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(&s.in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+// request queues a request and returns its ID.
+func (s *session) request(method string, params any) int {
+	s.nextID++
+	id := s.nextID
+	s.send(&id, method, params)
+	return id
+}
+
+func (s *session) notify(method string, params any) {
+	s.send(nil, method, params)
+}
+
+// result is the outcome of running a session: the responses by request ID,
+// and the notifications sent by the server in order.
+type result struct {
+	err           error
+	responses     map[int]*message
+	notifications []*message
+}
+
+func (s *session) run(t *testing.T) *result {
+	t.Helper()
+	var out bytes.Buffer
+	res := &result{responses: make(map[int]*message)}
+	res.err = NewServer(&s.in, &out).Run()
+
+	c := newConn(&out, nil)
+	for {
+		msg, err := c.read()
+		if err != nil {
+			break
+		}
+		if msg.ID == nil {
+			res.notifications = append(res.notifications, msg)
+			continue
+		}
+		var id int
+		if err := json.Unmarshal(*msg.ID, &id); err != nil {
+			t.Fatal(err)
+		}
+		res.responses[id] = msg
+	}
+	return res
+}
+
+// decode decodes the result of the response to request id into v.
+func (r *result) decode(t *testing.T, id int, v any) {
+	t.Helper()
+	resp, ok := r.responses[id]
+	if !ok {
+		t.Fatalf("no response to request %d", id)
+	}
+	if resp.Error != nil {
+		t.Fatalf("request %d: error %d: %s", id, resp.Error.Code, resp.Error.Message)
+	}
+	if err := json.Unmarshal(resp.Result, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// diagnostics returns the diagnostics of the last publishDiagnostics
+// notification.
+func (r *result) diagnostics(t *testing.T) PublishDiagnosticsParams {
+	t.Helper()
+	for i := len(r.notifications) - 1; i >= 0; i-- {
+		if n := r.notifications[i]; n.Method == "textDocument/publishDiagnostics" {
+			var p PublishDiagnosticsParams
+			if err := json.Unmarshal(n.Params, &p); err != nil {
+				t.Fatal(err)
+			}
+			return p
+		}
+	}
+	t.Fatal("no diagnostics published")
+	return PublishDiagnosticsParams{}
+}
+
+// start queues the initialization of the server and the opening of a document
+// with the given text.
+func start(opts *Options, text string) *session {
+	s := &session{}
+	s.request("initialize", InitializeParams{InitializationOptions: opts})
+	s.notify("initialized", struct{}{})
+	s.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: testURI, LanguageID: "ungrammar", Version: 1, Text: text},
+	})
+	return s
+}
+
+func (s *session) stop() {
+	s.request("shutdown", nil)
+	s.notify("exit", nil)
+}
+
+func at(line, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: testURI},
+		Position:     Position{Line: line, Character: character},
+	}
+}
+
+func rng(line, start, end int) Range {
+	return Range{Position{line, start}, Position{line, end}}
+}
+
+func TestLifecycle(t *testing.T) {
+	s := start(nil, testGrammar)
+	completion := s.request("textDocument/completion", CompletionParams{at(3, 9)})
+	semantic := s.request("textDocument/semanticTokens/full", SemanticTokensParams{TextDocument: TextDocumentIdentifier{URI: testURI}})
+	s.stop()
+	res := s.run(t)
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	var init InitializeResult
+	res.decode(t, 1, &init)
+	caps := init.Capabilities
+	if init.ServerInfo.Name != "ungrammar-lsp" || !caps.HoverProvider || caps.CompletionProvider == nil ||
+		caps.SemanticTokensProvider == nil || !reflect.DeepEqual(caps.SemanticTokensProvider.Legend, semanticLegend) {
+		t.Errorf("got initialize result %+v", init)
+	}
+
+	var items []CompletionItem
+	res.decode(t, completion, &items)
+	if len(items) != 4 || items[2].Label != "Paren" {
+		t.Errorf("got completions %+v", items)
+	}
+	var tokens SemanticTokens
+	res.decode(t, semantic, &tokens)
+	// The comment, Expr lhs Term '+' rhs Term, Term Num Paren, Paren '(' Expr
+	// ')', Num 'number'.
+	if n := len(tokens.Data); n != 5*16 {
+		t.Errorf("got %d semantic tokens, want 16", n/5)
+	}
+
+	// Exiting without a shutdown is an error.
+	s = start(nil, testGrammar)
+	s.notify("exit", nil)
+	if err := s.run(t).err; err == nil {
+		t.Error("got no error exiting without shutdown")
+	}
+
+	// Requests before initialize fail, as do unknown methods.
+	s = &session{}
+	early := s.request("textDocument/hover", at(0, 0))
+	s.request("initialize", InitializeParams{})
+	unknown := s.request("textDocument/frobnicate", nil)
+	s.stop()
+	res = s.run(t)
+	if e := res.responses[early].Error; e == nil || e.Code != codeServerNotInitialized {
+		t.Errorf("got error %v for request before initialize", e)
+	}
+	if e := res.responses[unknown].Error; e == nil || e.Code != codeMethodNotFound {
+		t.Errorf("got error %v for unknown method", e)
+	}
+}
+
+func TestBadMessages(t *testing.T) {
+	// A body that isn't JSON gets an error response with a null ID.
+	var in, out bytes.Buffer
+	fmt.Fprintf(&in, "Content-Length: 5\r\n\r\n{nope")
+	if err := NewServer(&in, &out).Run(); err == nil {
+		t.Error("got no error exiting without shutdown")
+	}
+	if got := out.String(); !strings.Contains(got, `"id":null`) || !strings.Contains(got, fmt.Sprint(codeParseError)) {
+		t.Errorf("got response %q, want a parse error with a null ID", got)
+	}
+
+	// Lengths that can't be read fail the server.
+	for _, length := range []string{"-1", "1000000000000", "x"} {
+		in.Reset()
+		fmt.Fprintf(&in, "Content-Length: %s\r\n\r\n{}", length)
+		if err := NewServer(&in, &out).Run(); err == nil || !strings.Contains(err.Error(), "bad Content-Length") {
+			t.Errorf("got error %v for Content-Length %s", err, length)
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	var tests = []struct {
+		name  string
+		opts  *Options
+		input string
+		want  []Diagnostic
+	}{
+		{"clean", &Options{Roots: []string{"Expr"}}, testGrammar, []Diagnostic{}},
+
+		{"syntax error", nil, "x = 'a' |\ny = 'b'", []Diagnostic{
+			{Range: rng(1, 0, 1), Severity: SeverityError, Code: "expected-rule", Source: "ungrammar",
+				Message: "expected rule, got y"},
+		}},
+
+		{"undefined rule", nil, "x = y", []Diagnostic{
+			{Range: rng(0, 0, 1), Severity: SeverityHint, Code: "unused-rule", Source: "ungrammar",
+				Message: "rule x is unused", Tags: []int{TagUnnecessary}},
+			{Range: rng(0, 4, 5), Severity: SeverityError, Code: "undefined-rule", Source: "ungrammar",
+				Message: "undefined rule y"},
+		}},
+
+		{"unused rule as hint", nil, "x = 'a'\ny = 'b'", []Diagnostic{
+			{Range: rng(0, 0, 1), Severity: SeverityHint, Code: "unused-rule", Source: "ungrammar",
+				Message: "rule x is unused", Tags: []int{TagUnnecessary}},
+			{Range: rng(1, 0, 1), Severity: SeverityHint, Code: "unused-rule", Source: "ungrammar",
+				Message: "rule y is unused", Tags: []int{TagUnnecessary}},
+		}},
+
+		{"unreachable rule with roots", &Options{Roots: []string{"x"}}, "x = 'a'\ny = 'b'", []Diagnostic{
+			{Range: rng(1, 0, 1), Severity: SeverityWarning, Code: "unused-rule", Source: "ungrammar",
+				Message: "rule y is unused"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := start(tt.opts, tt.input)
+			s.stop()
+			got := s.run(t).diagnostics(t)
+			if got.URI != testURI || got.Version != 1 {
+				t.Errorf("got diagnostics for %s version %d", got.URI, got.Version)
+			}
+			// Only compare the first line of messages, and leave out related
+			// information.
+			for i := range got.Diagnostics {
+				got.Diagnostics[i].Message, _, _ = strings.Cut(got.Diagnostics[i].Message, "\n")
+				got.Diagnostics[i].RelatedInformation = nil
+			}
+			if !reflect.DeepEqual(got.Diagnostics, tt.want) {
+				t.Errorf("got diagnostics\n%+v\nwant\n%+v", got.Diagnostics, tt.want)
+			}
+		})
+	}
+}
+
+func TestDidChange(t *testing.T) {
+	s := start(nil, "x = y\n")
+	s.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument: VersionedTextDocumentIdentifier{URI: testURI, Version: 2},
+		ContentChanges: []TextDocumentContentChangeEvent{
+			{Range: &Range{Position{1, 0}, Position{1, 0}}, Text: "y = 'a'\n"},
+			{Range: &Range{Position{0, 4}, Position{0, 5}}, Text: "y*"},
+		},
+	})
+	s.request("textDocument/documentSymbol", DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: testURI}})
+	s.stop()
+	res := s.run(t)
+
+	diags := res.diagnostics(t)
+	if diags.Version != 2 || len(diags.Diagnostics) != 1 || diags.Diagnostics[0].Code != "unused-rule" {
+		t.Errorf("got diagnostics %+v", diags)
+	}
+	var symbols []DocumentSymbol
+	res.decode(t, 2, &symbols)
+	var details []string
+	for _, sym := range symbols {
+		details = append(details, sym.Name+" = "+sym.Detail)
+	}
+	if want := []string{"x = y*", "y = 'a'"}; !reflect.DeepEqual(details, want) {
+		t.Errorf("got symbols %q, want %q", details, want)
+	}
+}
+
+func TestNavigation(t *testing.T) {
+	s := start(nil, testGrammar)
+	defFromRef := s.request("textDocument/definition", at(1, 13))
+	defAtEnd := s.request("textDocument/definition", at(3, 10))
+	defNone := s.request("textDocument/definition", at(1, 20))
+	refs := s.request("textDocument/references", ReferenceParams{
+		TextDocumentPositionParams: at(3, 0),
+		Context:                    ReferenceContext{IncludeDeclaration: true},
+	})
+	refsNoDecl := s.request("textDocument/references", ReferenceParams{
+		TextDocumentPositionParams: at(3, 0),
+	})
+	hover := s.request("textDocument/hover", at(1, 0))
+	s.stop()
+	res := s.run(t)
+
+	var loc Location
+	res.decode(t, defFromRef, &loc)
+	if want := (Location{testURI, rng(3, 0, 4)}); loc != want {
+		t.Errorf("got definition %+v, want %+v", loc, want)
+	}
+	res.decode(t, defAtEnd, &loc)
+	if want := (Location{testURI, rng(7, 0, 3)}); loc != want {
+		t.Errorf("got definition %+v, want %+v", loc, want)
+	}
+	var none *Location
+	res.decode(t, defNone, &none)
+	if none != nil {
+		t.Errorf("got definition %+v for token, want none", none)
+	}
+
+	var locs []Location
+	res.decode(t, refs, &locs)
+	want := []Location{{testURI, rng(1, 11, 15)}, {testURI, rng(1, 24, 28)}, {testURI, rng(3, 0, 4)}}
+	if !reflect.DeepEqual(locs, want) {
+		t.Errorf("got references %+v, want %+v", locs, want)
+	}
+	res.decode(t, refsNoDecl, &locs)
+	if !reflect.DeepEqual(locs, want[:2]) {
+		t.Errorf("got references %+v, want %+v", locs, want[:2])
+	}
+
+	var h Hover
+	res.decode(t, hover, &h)
+	wantHover := "```ungrammar\nExpr =\n  lhs:Term '+' rhs:Term\n```\n\nA sum of terms."
+	if h.Contents.Kind != "markdown" || h.Contents.Value != wantHover {
+		t.Errorf("got hover %q, want %q", h.Contents.Value, wantHover)
+	}
+}
+
+func TestDocumentSymbols(t *testing.T) {
+	s := start(nil, testGrammar)
+	id := s.request("textDocument/documentSymbol", DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: testURI}})
+	s.stop()
+	var symbols []DocumentSymbol
+	s.run(t).decode(t, id, &symbols)
+
+	var got []string
+	var walk func(indent string, syms []DocumentSymbol)
+	walk = func(indent string, syms []DocumentSymbol) {
+		for _, sym := range syms {
+			got = append(got, fmt.Sprintf("%s%s %d %v %v", indent, sym.Name, sym.Kind, sym.Range, sym.SelectionRange))
+			walk(indent+"  ", sym.Children)
+		}
+	}
+	walk("", symbols)
+	want := []string{
+		"Expr 23 {{1 0} {1 28}} {{1 0} {1 4}}",
+		"  lhs 8 {{1 7} {1 15}} {{1 7} {1 10}}",
+		"  rhs 8 {{1 20} {1 28}} {{1 20} {1 23}}",
+		"Term 10 {{3 0} {3 18}} {{3 0} {3 4}}",
+		"Paren 23 {{5 0} {5 20}} {{5 0} {5 5}}",
+		"Num 23 {{7 0} {7 14}} {{7 0} {7 3}}",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got symbols\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// Rules missing parts due to syntax errors have no details, and are written
+// with an ellipsis in hovers.
+func TestBrokenRuleDetails(t *testing.T) {
+	s := start(nil, "x = l:\ny = x |\nz = 'z'")
+	hover := s.request("textDocument/hover", at(0, 0))
+	symbols := s.request("textDocument/documentSymbol", DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: testURI}})
+	completion := s.request("textDocument/completion", CompletionParams{at(2, 4)})
+	s.stop()
+	res := s.run(t)
+
+	var h Hover
+	res.decode(t, hover, &h)
+	if want := "```ungrammar\nx = …\n```"; h.Contents.Value != want {
+		t.Errorf("got hover %q, want %q", h.Contents.Value, want)
+	}
+
+	var syms []DocumentSymbol
+	res.decode(t, symbols, &syms)
+	var got []string
+	for _, sym := range syms {
+		got = append(got, sym.Name+": "+sym.Detail)
+		for _, child := range sym.Children {
+			got = append(got, "  "+child.Name+": "+child.Detail)
+		}
+	}
+	want := []string{"x: ", "  l: ", "y: ", "z: 'z'"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got symbols %q, want %q", got, want)
+	}
+
+	var items []CompletionItem
+	res.decode(t, completion, &items)
+	got = nil
+	for _, item := range items {
+		got = append(got, item.Label+": "+item.Detail)
+	}
+	want = []string{"x: ", "y: ", "z: 'z'", "'z': keyword"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got completions %q, want %q", got, want)
+	}
+}
+
+func TestRename(t *testing.T) {
+	s := start(nil, testGrammar)
+	prepare := s.request("textDocument/prepareRename", at(3, 2))
+	rename := s.request("textDocument/rename", RenameParams{TextDocumentPositionParams: at(1, 12), NewName: "Atom"})
+	var errIDs []int
+	for _, p := range []RenameParams{
+		{TextDocumentPositionParams: at(1, 12), NewName: "Num"},
+		{TextDocumentPositionParams: at(1, 12), NewName: "9lives"},
+		{TextDocumentPositionParams: at(1, 17), NewName: "Plus"},
+	} {
+		errIDs = append(errIDs, s.request("textDocument/rename", p))
+	}
+	s.stop()
+	res := s.run(t)
+
+	var pr PrepareRenameResult
+	res.decode(t, prepare, &pr)
+	if want := (PrepareRenameResult{rng(3, 0, 4), "Term"}); pr != want {
+		t.Errorf("got prepareRename %+v, want %+v", pr, want)
+	}
+
+	var edit WorkspaceEdit
+	res.decode(t, rename, &edit)
+	want := WorkspaceEdit{Changes: map[string][]TextEdit{testURI: {
+		{rng(1, 11, 15), "Atom"},
+		{rng(1, 24, 28), "Atom"},
+		{rng(3, 0, 4), "Atom"},
+	}}}
+	if !reflect.DeepEqual(edit, want) {
+		t.Errorf("got rename %+v, want %+v", edit, want)
+	}
+
+	wantErrors := []string{
+		"rule Num already exists",
+		`"9lives" isn't a valid rule name`,
+		"no rule to rename here",
+	}
+	for i, id := range errIDs {
+		e := res.responses[id].Error
+		if e == nil || e.Message != wantErrors[i] {
+			t.Errorf("got error %v, want %q", e, wantErrors[i])
+		}
+	}
+}
+
+func TestPositions(t *testing.T) {
+	d := newDocument(testURI, 1, "x = 'é𝄞'\ny = x", nil)
+	var tests = []struct {
+		off int
+		pos Position
+	}{
+		{0, Position{0, 0}},
+		{5, Position{0, 5}},
+		{7, Position{0, 6}},
+		{11, Position{0, 8}},
+		{12, Position{0, 9}},
+		{13, Position{1, 0}},
+		{18, Position{1, 5}},
+	}
+	for _, tt := range tests {
+		if got := d.position(tt.off); got != tt.pos {
+			t.Errorf("position(%d) = %v, want %v", tt.off, got, tt.pos)
+		}
+		if got := d.offset(tt.pos); got != tt.off {
+			t.Errorf("offset(%v) = %d, want %d", tt.pos, got, tt.off)
+		}
+	}
+
+	// Positions past the ends of lines are clamped.
+	if got := d.offset(Position{0, 100}); got != 12 {
+		t.Errorf("got offset %d past the end of a line, want 12", got)
+	}
+	if got := d.offset(Position{5, 0}); got != len(d.text) {
+		t.Errorf("got offset %d past the end of the text, want %d", got, len(d.text))
+	}
+}
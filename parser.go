@@ -5,23 +5,44 @@
 
 package ungrammar
 
-import "fmt"
+import (
+	"fmt"
+	"slices"
+)
 
 // Parser parses ungrammar syntax into a Grammar. Create a new parser with
-// NewParser, and then call its ParseGrammar method.
+// NewParser, and then call its ParseGrammar method (or ParseSyntaxTree for a
+// lossless syntax tree). A Parser can only be used to parse its input once.
 type Parser struct {
 	lex *lexer
 
 	tok     token
 	nextTok token
 
+	// prevEnd is the end position of the last token consumed by advance; it's
+	// used to compute the spans of rules.
+	prevEnd Pos
+
+	// b builds a lossless syntax tree while parsing, if it's not nil.
+	b *syntaxBuilder
+
 	errs ErrorList
 }
 
 // NewParser creates a new parser with the given string input.
 func NewParser(buf string) *Parser {
+	return NewFileParser("", buf)
+}
+
+// NewFileParser is like NewParser, but records filename in all the positions
+// of the parsed grammar and in error messages.
+func NewFileParser(filename string, buf string) *Parser {
+	return newParser(newLexer(filename, buf))
+}
+
+func newParser(lex *lexer) *Parser {
 	p := &Parser{
-		lex:  newLexer(buf),
+		lex:  lex,
 		errs: nil,
 	}
 
@@ -32,32 +53,117 @@ func NewParser(buf string) *Parser {
 
 // ParseGrammar takes the input the Parser was initialized with and parses it
 // into a Grammar. It returns an ErrorList which collects all the errors
-// encountered during parsing, and in case of errors the returned Grammar may be
-// partial.
+// encountered during parsing (as Diagnostics with SeverityError), and in case
+// of errors the returned Grammar may be partial.
 func (p *Parser) ParseGrammar() (*Grammar, error) {
-	rules := make(map[string]Rule)
-	locs := make(map[string]location)
+	var defs []definition
 	for !p.eof() {
-		name, location, rule := p.parseNamedRule()
-		if rule != nil {
-			if _, found := rules[name]; found {
-				p.emitError(location, fmt.Sprintf("duplicate rule name %v", name))
-			}
-			rules[name] = rule
-			locs[name] = location
+		defs = append(defs, p.parseDefinition())
+	}
+
+	grammar, errs := buildGrammar(defs, p.lex.fileDoc)
+	if len(errs) > 0 {
+		return grammar, errs
+	} else {
+		return grammar, nil
+	}
+}
+
+// definition is the result of a top-level step of parsing a grammar: a named
+// rule, or the input skipped due to errors if rule is nil. errs holds the
+// errors found in the step.
+type definition struct {
+	name string
+	span Span // of the name
+	doc  string
+	rule Rule
+	errs ErrorList
+}
+
+// parseDefinition parses a top-level named rule. If the parser doesn't point
+// to one, it skips the input up to the next one.
+func (p *Parser) parseDefinition() definition {
+	n := len(p.errs)
+	nameTok, rule := p.parseNamedRule()
+	def := definition{rule: rule, errs: slices.Clone(p.errs[n:])}
+	if rule != nil {
+		def.name = nameTok.value
+		def.span = nameTok.span
+		def.doc = nameTok.doc
+	}
+	return def
+}
+
+// buildGrammar builds a grammar from the top-level definitions parsed from
+// the input, with fileDoc as its doc; it returns the errors found in the
+// definitions, along with errors for rules defined more than once.
+func buildGrammar(defs []definition, fileDoc string) (*Grammar, ErrorList) {
+	rules := make(map[string]Rule)
+	locs := make(map[string]Pos)
+	docs := make(map[string]string)
+	var names []string
+	var errs ErrorList
+	for _, def := range defs {
+		errs = append(errs, def.errs...)
+		if def.rule == nil {
+			continue
+		}
+		name := def.name
+		if _, found := rules[name]; found {
+			errs.Add(&Diagnostic{
+				Severity: SeverityError,
+				Code:     CodeDuplicateRule,
+				Span:     def.span,
+				Message:  fmt.Sprintf("duplicate rule name %v", name),
+				Related: []Related{{
+					Span:    nameSpan(name, locs[name]),
+					Message: fmt.Sprintf("%v previously defined here", name),
+				}},
+			})
+			// The last definition wins; move the name to its position.
+			names = slices.DeleteFunc(names, func(n string) bool { return n == name })
+		}
+		names = append(names, name)
+		rules[name] = def.rule
+		locs[name] = def.span.Start
+		if def.doc != "" {
+			docs[name] = def.doc
+		} else {
+			delete(docs, name)
 		}
 	}
 
 	grammar := &Grammar{
 		Rules:   rules,
+		Names:   names,
 		NameLoc: locs,
+		Docs:    docs,
+		Doc:     fileDoc,
 	}
+	return grammar, errs
+}
 
-	if len(p.errs) > 0 {
-		return grammar, p.errs
-	} else {
-		return grammar, nil
+// ParseSyntaxTree is like ParseGrammar, but returns a lossless syntax tree of
+// the input instead of a Grammar. The returned tree's root has the kind
+// KindGrammar and spans the whole input; every byte of the input (including
+// whitespace, comments and input the parser skipped due to errors) is covered
+// by exactly one token in the tree. The returned error is the same as
+// ParseGrammar would return.
+func (p *Parser) ParseSyntaxTree() (*SyntaxNode, error) {
+	p.b = &syntaxBuilder{buf: p.lex.buf}
+	p.b.startNode(KindGrammar)
+	_, err := p.ParseGrammar()
+
+	// Trailing trivia is attached to the EOF token, which is never consumed.
+	for _, t := range p.tok.leading {
+		p.b.addToken(t)
+	}
+	root := p.b.finishNode()
+	root.span = Span{
+		Start: Pos{Filename: p.lex.pos.Filename, Offset: 0, Line: 1, Column: 1},
+		End:   p.tok.span.End,
 	}
+	return root, err
 }
 
 // advance returns the current token and consumes it (the next call to advance
@@ -68,7 +174,12 @@ func (p *Parser) advance() token {
 		return tok
 	}
 
+	if p.b != nil {
+		p.b.token(tok)
+	}
+
 	// Shift the lookahead "buffer"
+	p.prevEnd = tok.span.End
 	p.tok = p.nextTok
 	p.nextTok = p.lex.nextToken()
 	return tok
@@ -78,46 +189,109 @@ func (p *Parser) eof() bool {
 	return p.tok.name == EOF
 }
 
+// atNamedRule reports whether the parser points to the start of a top-level
+// named rule, Node '='.
+func (p *Parser) atNamedRule() bool {
+	return p.tok.name == NODE && p.nextTok.name == EQ
+}
+
+// The following methods forward to the syntax tree builder, if there is one.
+
+func (p *Parser) startNode(kind SyntaxKind) {
+	if p.b != nil {
+		p.b.startNode(kind)
+	}
+}
+
+func (p *Parser) checkpoint() int {
+	if p.b != nil {
+		return p.b.checkpoint()
+	}
+	return 0
+}
+
+func (p *Parser) startNodeAt(cp int, kind SyntaxKind) {
+	if p.b != nil {
+		p.b.startNodeAt(cp, kind)
+	}
+}
+
+func (p *Parser) finishNode() {
+	if p.b != nil {
+		p.b.finishNode()
+	}
+}
+
 // parseNamedRule parses a top-level named rule: Node '=' <rule>, and returns
-// its name, the location of the name and the rule itself. It returns an empty
-// name and rule if the parser doesn't currently point to a rule.
-func (p *Parser) parseNamedRule() (string, location, Rule) {
+// the token holding its name and the rule itself. It returns a nil rule if the
+// parser doesn't currently point to a rule.
+func (p *Parser) parseNamedRule() (token, Rule) {
 	tok := p.tok
-	if tok.name == NODE {
+	if p.atNamedRule() {
+		p.startNode(KindDefinition)
+		defer p.finishNode()
+
 		p.advance()
-		if p.tok.name == EQ {
-			p.advance()
-			rule := p.parseAlt()
-			return tok.value, tok.loc, rule
-		}
+		p.advance()
+		rule := p.parseAlt()
+		return tok, rule
 	}
 
 	// If we're here, a named rule was not found.
-	p.emitError(tok.loc, fmt.Sprintf("expected named rule, got %v", tok.value))
+	p.emitError(tok.span, CodeExpectedNamedRule, fmt.Sprintf("expected named rule, got %v", tok.value))
 	p.synchronize()
-	return "", location{}, nil
+	return token{}, nil
 }
 
 // parseAlt parses a top-level rule, the LHS of Node '=' <Rule>. It's
 // potentially a '|'-seprated alternation of sequences.
+//
+// The doc of each alternative is taken from the '|' preceding it, or from the
+// first token of the alternative if the '|' has no doc; if that token is a
+// label, the doc is the alternative's only, not the label's.
 func (p *Parser) parseAlt() Rule {
+	cp := p.checkpoint()
+	start := p.tok.span.Start
+	docs := []string{p.tok.doc}
+	// tokDocs holds the starts of alternatives whose doc was taken from their
+	// first token.
+	tokDocs := []Pos{start}
 	alts := []Rule{p.parseSeq()}
+	hasDocs := docs[0] != ""
 	for p.tok.name == PIPE {
-		p.advance()
+		doc := p.advance().doc
+		if doc == "" {
+			doc = p.tok.doc
+			tokDocs = append(tokDocs, p.tok.span.Start)
+		}
+		hasDocs = hasDocs || doc != ""
+		docs = append(docs, doc)
 		alts = append(alts, p.parseSeq())
 	}
 	if len(alts) == 1 {
 		return alts[0]
 	} else {
-		return &Alt{alts}
+		if !hasDocs {
+			docs = nil
+		}
+		for _, alt := range alts {
+			if lbl := leadingLabel(alt); lbl != nil && slices.Contains(tokDocs, lbl.span.Start) {
+				lbl.Doc = ""
+			}
+		}
+		p.startNodeAt(cp, KindAlt)
+		p.finishNode()
+		return &Alt{Rules: alts, Docs: docs, span: Span{start, p.prevEnd}}
 	}
 }
 
 // parseSeq parses a sequence of single rules.
 func (p *Parser) parseSeq() Rule {
+	cp := p.checkpoint()
+	start := p.tok.span.Start
 	sr := p.parseSingleRule()
 	if sr == nil {
-		p.emitError(p.tok.loc, fmt.Sprintf("expected rule, got %v", p.tok.value))
+		p.emitError(p.tok.span, CodeExpectedRule, fmt.Sprintf("expected rule, got %v", p.tok.value))
 		p.synchronize()
 		return nil
 	}
@@ -133,7 +307,9 @@ func (p *Parser) parseSeq() Rule {
 	if len(seq) == 1 {
 		return seq[0]
 	} else {
-		return &Seq{seq}
+		p.startNodeAt(cp, KindSeq)
+		p.finishNode()
+		return &Seq{Rules: seq, span: Span{start, p.prevEnd}}
 	}
 }
 
@@ -152,16 +328,22 @@ func (p *Parser) parseSeq() Rule {
 // parse a single rule, we look ahead for a '=' and bail if it's found, leaving
 // "Bob =" to a higher-level parser. In that case, nil is returned.
 func (p *Parser) parseSingleRule() Rule {
+	cp := p.checkpoint()
+	start := p.tok.span.Start
 	atom := p.parseSingleRuleAtom()
 	if atom == nil {
 		return nil
 	}
 	if p.tok.name == QMARK {
+		p.startNodeAt(cp, KindOpt)
+		defer p.finishNode()
 		p.advance()
-		return &Opt{atom}
+		return &Opt{Rule: atom, span: Span{start, p.prevEnd}}
 	} else if p.tok.name == STAR {
+		p.startNodeAt(cp, KindRep)
+		defer p.finishNode()
 		p.advance()
-		return &Rep{atom}
+		return &Rep{Rule: atom, span: Span{start, p.prevEnd}}
 	}
 	return atom
 }
@@ -177,52 +359,71 @@ func (p *Parser) parseSingleRuleAtom() Rule {
 		if p.nextTok.name == EQ {
 			return nil
 		} else if p.nextTok.name == COLON {
+			p.startNode(KindLabeled)
+			defer p.finishNode()
+
 			labelTok := p.advance()
 			// This is a labeled rule and the label is now in labelTok.
 			// Skip the colon.
 			p.advance()
 			r := p.parseSingleRule()
 			if r == nil {
-				p.emitError(p.tok.loc, fmt.Sprintf("expected rule after label, got %v", p.tok.value))
+				p.emitError(p.tok.span, CodeExpectedRule, fmt.Sprintf("expected rule after label, got %v", p.tok.value))
 				p.synchronize()
 			}
 			return &Labeled{
-				Label:    labelTok.value,
-				Rule:     r,
-				labelLoc: labelTok.loc,
+				Label: labelTok.value,
+				Rule:  r,
+				Doc:   labelTok.doc,
+				span:  Span{labelTok.span.Start, p.prevEnd},
 			}
 		} else {
-			tok := p.tok
-			p.advance()
+			p.startNode(KindNode)
+			defer p.finishNode()
+
+			tok := p.advance()
 			return &Node{
-				Name:    tok.value,
-				nameLoc: tok.loc,
+				Name: tok.value,
+				span: tok.span,
 			}
 		}
 	case TOKEN:
-		tok := p.tok
-		p.advance()
+		p.startNode(KindToken)
+		defer p.finishNode()
+
+		tok := p.advance()
 		return &Token{
-			Value:    tok.value,
-			valueLoc: tok.loc,
+			Value: tok.value,
+			span:  tok.span,
 		}
 	case LPAREN:
+		p.startNode(KindParen)
+		defer p.finishNode()
+
 		// Consume '(' and parse the full rule
-		p.advance()
+		lparen := p.advance()
 		r := p.parseAlt()
 
 		// Expect closing ')', but return the rule anyway if we don't find it.
 		if p.tok.name != RPAREN {
-			p.emitError(p.tok.loc, fmt.Sprintf("expected ')', got %v", p.tok.value))
+			p.emitError(p.tok.span, CodeExpectedRParen, fmt.Sprintf("expected ')', got %v", p.tok.value))
 			p.synchronize()
 			return r
 		}
 
-		// Consume ')'
-		p.advance()
+		// Consume ')'. If the parenthesized rule is a sequence or alternation,
+		// its span is extended to include the parentheses.
+		rparen := p.advance()
+		parenSpan := Span{lparen.span.Start, rparen.span.End}
+		switch rr := r.(type) {
+		case *Seq:
+			rr.span = parenSpan
+		case *Alt:
+			rr.span = parenSpan
+		}
 		return r
 	case ERROR:
-		p.emitError(p.tok.loc, p.tok.value)
+		p.emitError(p.tok.span, p.tok.code, p.tok.value)
 		p.synchronize()
 	}
 	return nil
@@ -230,15 +431,28 @@ func (p *Parser) parseSingleRuleAtom() Rule {
 
 // synchronize consumes tokens until it finds a safe place to restart parsing.
 // It tries to find the next Node '=' where a new named rule can be defined.
+// The skipped tokens are wrapped in a KindError node in the syntax tree.
 func (p *Parser) synchronize() {
+	cp := p.checkpoint()
+	skipped := false
 	for !p.eof() {
-		if p.tok.name == NODE && p.nextTok.name == EQ {
-			return
+		if p.atNamedRule() {
+			break
 		}
 		p.advance()
+		skipped = true
+	}
+	if skipped {
+		p.startNodeAt(cp, KindError)
+		p.finishNode()
 	}
 }
 
-func (p *Parser) emitError(loc location, msg string) {
-	p.errs.Add(fmt.Errorf("%s: %s", loc, msg))
+func (p *Parser) emitError(span Span, code Code, msg string) {
+	p.errs.Add(&Diagnostic{
+		Severity: SeverityError,
+		Code:     code,
+		Span:     span,
+		Message:  msg,
+	})
 }
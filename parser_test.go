@@ -5,6 +5,7 @@ package ungrammar
 
 import (
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
 	"slices"
@@ -128,6 +129,140 @@ func TestRustUngrammarFile(t *testing.T) {
 	}
 }
 
+func TestDefinitionOrder(t *testing.T) {
+	input := `
+Zed = a
+Alpha = b | c
+Mid = 'm'
+Alpha = d`
+
+	p := NewParser(input)
+	g, _ := p.ParseGrammar()
+
+	// The last definition of Alpha wins, in all of the grammar.
+	wantNames := []string{"Zed", "Mid", "Alpha"}
+	if !slices.Equal(g.Names, wantNames) {
+		t.Errorf("got names %v, want %v", g.Names, wantNames)
+	}
+	if got := g.NameLoc["Alpha"].String(); got != "5:1" {
+		t.Errorf("got Alpha location %v, want 5:1", got)
+	}
+
+	wantString := "Zed: a\nMid: 'm'\nAlpha: d\n"
+	if got := g.String(); got != wantString {
+		t.Errorf("got string %q, want %q", got, wantString)
+	}
+
+	// Grammars constructed without a parser have their rules sorted by name.
+	g = &Grammar{Rules: map[string]Rule{
+		"b": &Node{Name: "x"},
+		"a": &Token{Value: "y"},
+	}}
+	wantString = "a: 'y'\nb: x\n"
+	if got := g.String(); got != wantString {
+		t.Errorf("got string %q, want %q", got, wantString)
+	}
+
+	// Listed names come first; those without rules are skipped.
+	g.Names = []string{"b", "gone"}
+	wantString = "b: x\na: 'y'\n"
+	if got := g.String(); got != wantString {
+		t.Errorf("got string %q, want %q", got, wantString)
+	}
+}
+
+func TestDocs(t *testing.T) {
+	input := `// The grammar
+
+// The foo
+Foo =
+  // first
+  a b
+  // second
+| c
+| // not a doc
+  lab:d
+Bar = // not a doc
+  // the label
+  x:y z
+Baz =
+  // the first
+  f:x
+  // the second
+| g:y z`
+
+	p := NewParser(input)
+	g, err := p.ParseGrammar()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g.Doc != "The grammar" {
+		t.Errorf("got grammar doc %q, want %q", g.Doc, "The grammar")
+	}
+
+	wantDocs := map[string]string{"Foo": "The foo"}
+	if !maps.Equal(g.Docs, wantDocs) {
+		t.Errorf("got docs %v, want %v", g.Docs, wantDocs)
+	}
+
+	fooAlt := g.Rules["Foo"].(*Alt)
+	wantAltDocs := []string{"first", "second", ""}
+	if !slices.Equal(fooAlt.Docs, wantAltDocs) {
+		t.Errorf("got alt docs %q, want %q", fooAlt.Docs, wantAltDocs)
+	}
+	if lbl := fooAlt.Rules[2].(*Labeled); lbl.Doc != "" {
+		t.Errorf("got label doc %q, want none", lbl.Doc)
+	}
+
+	barLbl := g.Rules["Bar"].(*Seq).Rules[0].(*Labeled)
+	if barLbl.Doc != "the label" {
+		t.Errorf("got label doc %q, want %q", barLbl.Doc, "the label")
+	}
+
+	// The docs of alternatives starting with labels are the alternatives'
+	// only, so editing them doesn't leave a stale copy behind.
+	bazAlt := g.Rules["Baz"].(*Alt)
+	wantAltDocs = []string{"the first", "the second"}
+	if !slices.Equal(bazAlt.Docs, wantAltDocs) {
+		t.Errorf("got alt docs %q, want %q", bazAlt.Docs, wantAltDocs)
+	}
+	if lbl := leadingLabel(bazAlt.Rules[0]); lbl.Doc != "" {
+		t.Errorf("got label doc %q, want none", lbl.Doc)
+	}
+	if lbl := leadingLabel(bazAlt.Rules[1]); lbl.Doc != "" {
+		t.Errorf("got label doc %q, want none", lbl.Doc)
+	}
+	bazAlt.Docs[0] = "the edited first"
+	var sb strings.Builder
+	if err := g.Format(&sb); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sb.String(), "// the first") {
+		t.Errorf("got stale doc in formatted grammar:\n%s", sb.String())
+	}
+}
+
+func TestRustUngrammarDocs(t *testing.T) {
+	contents := readFileOrPanic(filepath.Join("testdata", "rust.ungrammar"))
+	p := NewParser(string(contents))
+	g, err := p.ParseGrammar()
+	if err != nil {
+		t.Error(err)
+	}
+
+	wantAdt := "A Data Type.\n\nNot used directly in the grammar, but handy to have anyway."
+	if g.Docs["Adt"] != wantAdt {
+		t.Errorf("got Adt doc %q, want %q", g.Docs["Adt"], wantAdt)
+	}
+
+	rangeAlt := g.Rules["RangePat"].(*Alt)
+	wantAltDocs := []string{"1..", "1..2", "..2"}
+	if !slices.Equal(rangeAlt.Docs, wantAltDocs) {
+		t.Errorf("got RangePat docs %q, want %q", rangeAlt.Docs, wantAltDocs)
+	}
+}
+
 func TestLocations(t *testing.T) {
 	input := `
 x = foo | bar
@@ -147,7 +282,7 @@ y = a b?`
 
 	var tests = []struct {
 		name          string
-		loc           location
+		loc           Pos
 		wantLocString string
 	}{
 		{"x name", g.NameLoc["x"], "2:1"},
@@ -170,6 +305,113 @@ y = a b?`
 	}
 }
 
+// Rules built without a parser have no spans; composite rules take their
+// locations from their first sub-rule.
+func TestBuiltLocations(t *testing.T) {
+	g, err := NewParser("x = a b\ny = c | d").ParseGrammar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	xseq := g.Rules["x"].(*Seq)
+	yalt := g.Rules["y"].(*Alt)
+
+	var tests = []struct {
+		name          string
+		rule          Rule
+		wantLocString string
+	}{
+		{"seq", &Seq{Rules: xseq.Rules}, "1:5"},
+		{"alt", &Alt{Rules: yalt.Rules}, "2:5"},
+		{"opt", &Opt{Rule: &Seq{Rules: xseq.Rules}}, "1:5"},
+		{"rep", &Rep{Rule: yalt.Rules[1]}, "2:9"},
+		{"empty seq", &Seq{}, "-"},
+		{"opt of nil", &Opt{}, "-"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.Location().String(); got != tt.wantLocString {
+				t.Errorf("got %v, want %v", got, tt.wantLocString)
+			}
+		})
+	}
+}
+
+func TestSpans(t *testing.T) {
+	input := `
+x = foo | lab:bar* 'tok'
+y = (a b)? (c | 'd')
+z = k:(m n)`
+
+	p := NewParser(input)
+	g, err := p.ParseGrammar()
+	if err != nil {
+		t.Error(err)
+	}
+
+	xalt := g.Rules["x"].(*Alt)
+	xseq := xalt.Rules[1].(*Seq)
+	xlbl := xseq.Rules[0].(*Labeled)
+	yseq := g.Rules["y"].(*Seq)
+	yopt := yseq.Rules[0].(*Opt)
+	zlbl := g.Rules["z"].(*Labeled)
+
+	var tests = []struct {
+		name     string
+		span     Span
+		wantText string
+	}{
+		{"x alt", xalt.Span(), `foo | lab:bar* 'tok'`},
+		{"x alt 0", xalt.Rules[0].Span(), `foo`},
+		{"x seq", xseq.Span(), `lab:bar* 'tok'`},
+		{"x labeled", xlbl.Span(), `lab:bar*`},
+		{"x labeled rep", xlbl.Rule.Span(), `bar*`},
+		{"x token", xseq.Rules[1].Span(), `'tok'`},
+		{"y seq", yseq.Span(), `(a b)? (c | 'd')`},
+		{"y opt", yopt.Span(), `(a b)?`},
+		{"y opt seq", yopt.Rule.Span(), `(a b)`},
+		{"y alt", yseq.Rules[1].Span(), `(c | 'd')`},
+		{"z labeled", zlbl.Span(), `k:(m n)`},
+		{"z labeled seq", zlbl.Rule.Span(), `(m n)`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotText := input[tt.span.Start.Offset:tt.span.End.Offset]
+			if gotText != tt.wantText {
+				t.Errorf("got text %q, want %q", gotText, tt.wantText)
+			}
+		})
+	}
+
+	wantSpan := "3:5-3:21"
+	if got := yseq.Span().String(); got != wantSpan {
+		t.Errorf("got span %v, want %v", got, wantSpan)
+	}
+}
+
+func TestFilePositions(t *testing.T) {
+	input := `
+x = foo
+yy = = bar`
+
+	p := NewFileParser("my.ungrammar", input)
+	g, err := p.ParseGrammar()
+	if err == nil {
+		t.Fatal("expected errors, got nil")
+	}
+
+	wantErr := "my.ungrammar:3:6: expected rule, got ="
+	if err.Error() != wantErr {
+		t.Errorf("got error %q, want %q", err.Error(), wantErr)
+	}
+
+	wantPos := Pos{Filename: "my.ungrammar", Offset: 5, Line: 2, Column: 5}
+	if got := g.Rules["x"].Location(); got != wantPos {
+		t.Errorf("got position %+v, want %+v", got, wantPos)
+	}
+}
+
 // Test error handling and parser recovery. The parser will try to make progress
 // even in face of errors, returning partial results while errors persist.
 func TestParseErrors(t *testing.T) {
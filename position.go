@@ -0,0 +1,72 @@
+// go-ungrammar: source positions.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package ungrammar
+
+import "fmt"
+
+// Pos describes a position in Ungrammar source. It's loosely modeled on
+// token.Position in the Go standard library.
+//
+// Offset is a 0-based byte offset into the input. Line and Column are 1-based;
+// Column counts runes (not bytes) from the start of the line. A Pos is valid
+// if its Line is > 0.
+type Pos struct {
+	Filename string
+	Offset   int
+	Line     int
+	Column   int
+}
+
+// IsValid reports whether the position is valid.
+func (pos Pos) IsValid() bool {
+	return pos.Line > 0
+}
+
+// String returns a string in one of several forms:
+//
+//	file:line:column    valid position with file name
+//	line:column         valid position without file name
+//	file                invalid position with file name
+//	-                   invalid position without file name
+func (pos Pos) String() string {
+	s := pos.Filename
+	if pos.IsValid() {
+		if s != "" {
+			s += ":"
+		}
+		s += fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+	}
+	if s == "" {
+		s = "-"
+	}
+	return s
+}
+
+// Span describes a range of Ungrammar source, from Start (inclusive) to End
+// (exclusive).
+type Span struct {
+	Start Pos
+	End   Pos
+}
+
+// IsValid reports whether the span is valid.
+func (sp Span) IsValid() bool {
+	return sp.Start.IsValid()
+}
+
+// Contains reports whether the byte offset off is inside the span.
+func (sp Span) Contains(off int) bool {
+	return sp.Start.Offset <= off && off < sp.End.Offset
+}
+
+// String returns the span's Start position followed by the line:column of
+// its End position, e.g. "file:1:5-1:9".
+func (sp Span) String() string {
+	if !sp.End.IsValid() {
+		return sp.Start.String()
+	}
+	return fmt.Sprintf("%s-%d:%d", sp.Start, sp.End.Line, sp.End.Column)
+}
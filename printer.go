@@ -0,0 +1,257 @@
+// go-ungrammar: printing grammars in Ungrammar syntax.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package ungrammar
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Format writes g to w in canonical Ungrammar syntax, such that parsing the
+// output produces a grammar equivalent to g. Rules are written in the order of
+// g.Names (see Grammar.String), each preceded by its doc comment and followed
+// by an empty line; doc comments of alternatives and labels are preserved as
+// well. Parentheses are only emitted where required by precedence.
+//
+// Format returns an error if g contains nil rules, which happens for grammars
+// parsed with errors.
+func (g *Grammar) Format(w io.Writer) error {
+	pr := &printer{multiline: true}
+	if g.Doc != "" {
+		pr.doc(g.Doc, "")
+		pr.sb.WriteString("\n")
+	}
+
+	for i, name := range g.OrderedNames() {
+		if i > 0 {
+			pr.sb.WriteString("\n")
+		}
+		if doc := g.Docs[name]; doc != "" {
+			pr.doc(doc, "")
+		}
+		fmt.Fprintf(&pr.sb, "%s =\n", name)
+		pr.topLevel(g.Rules[name])
+		if pr.err != nil {
+			return fmt.Errorf("rule %s: %w", name, pr.err)
+		}
+	}
+
+	_, err := io.WriteString(w, pr.sb.String())
+	return err
+}
+
+// FormatRule returns r in Ungrammar syntax, on a single line. Doc comments are
+// omitted, and nil rules are written as <nil>.
+func FormatRule(r Rule) string {
+	pr := &printer{}
+	pr.rule(r, precAlt)
+	return pr.sb.String()
+}
+
+// Precedence levels of rules, from loosest to tightest binding. Labeled rules
+// share a level with the postfix quantifiers: "l:x?" is Labeled(Opt(x)).
+const (
+	precAlt = iota
+	precSeq
+	precPostfix
+	precAtom
+)
+
+func rulePrec(r Rule) int {
+	switch r.(type) {
+	case *Alt:
+		return precAlt
+	case *Seq:
+		return precSeq
+	case *Opt, *Rep, *Labeled:
+		return precPostfix
+	default:
+		return precAtom
+	}
+}
+
+// printer writes rules in Ungrammar syntax. In multiline mode, the top-level
+// alternatives of rules are written on separate lines and doc comments are
+// emitted; otherwise everything is written on a single line.
+type printer struct {
+	sb        strings.Builder
+	multiline bool
+
+	// indent is the indentation of continuation lines in multiline mode.
+	indent string
+
+	// atLineStart is true when nothing but indentation was written on the
+	// current line.
+	atLineStart bool
+
+	// docWritten is a label whose doc was already written as the doc of the
+	// alternative it starts.
+	docWritten *Labeled
+
+	err error
+}
+
+// doc writes the doc comment text on its own lines, indented with indent.
+func (pr *printer) doc(text string, indent string) {
+	for _, line := range strings.Split(text, "\n") {
+		pr.sb.WriteString(indent + strings.TrimRight("// "+line, " ") + "\n")
+	}
+}
+
+// topLevel writes the body of a named rule, each alternative of a top-level
+// Alt on its own line.
+func (pr *printer) topLevel(r Rule) {
+	pr.indent = "  "
+	if alt, ok := r.(*Alt); ok {
+		pr.alternatives(alt, "")
+	} else {
+		pr.sb.WriteString(pr.indent)
+		pr.atLineStart = true
+		pr.rule(r, precAlt)
+	}
+	pr.sb.WriteString("\n")
+}
+
+// alternatives writes the alternatives of alt on separate lines, prefixing
+// each line with base. The doc of each alternative is written on the lines
+// preceding it; if the alternative has no doc but starts with a label that
+// does, the label's doc is written there instead.
+func (pr *printer) alternatives(alt *Alt, base string) {
+	saved := pr.indent
+	pr.indent = base + "  "
+	for i, r := range alt.Rules {
+		if i > 0 {
+			pr.sb.WriteString("\n")
+		}
+		var doc string
+		if i < len(alt.Docs) {
+			doc = alt.Docs[i]
+		}
+		if lbl := leadingLabel(r); lbl != nil && (doc == "" || doc == lbl.Doc) {
+			doc = lbl.Doc
+			pr.docWritten = lbl
+		}
+		if doc != "" {
+			pr.doc(doc, pr.indent)
+		}
+		if i == 0 {
+			pr.sb.WriteString(pr.indent)
+		} else {
+			pr.sb.WriteString(base + "| ")
+		}
+		pr.atLineStart = i == 0
+		pr.rule(r, precSeq)
+		pr.docWritten = nil
+	}
+	pr.indent = saved
+}
+
+// leadingLabel returns the Labeled rule r starts with, or nil if it doesn't
+// start with one.
+func leadingLabel(r Rule) *Labeled {
+	if seq, ok := r.(*Seq); ok && len(seq.Rules) > 0 {
+		r = seq.Rules[0]
+	}
+	lbl, _ := r.(*Labeled)
+	return lbl
+}
+
+// rule writes r, wrapping it in parentheses if its precedence is lower than
+// prec.
+func (pr *printer) rule(r Rule, prec int) {
+	if r == nil {
+		if pr.err == nil {
+			pr.err = fmt.Errorf("nil rule")
+		}
+		pr.write("<nil>")
+		return
+	}
+
+	if rulePrec(r) < prec {
+		if alt, ok := r.(*Alt); ok && pr.multiline && alt.Docs != nil {
+			pr.write("(\n")
+			pr.alternatives(alt, pr.indent+"  ")
+			pr.write("\n" + pr.indent + ")")
+			return
+		}
+		pr.write("(")
+		pr.rule(r, precAlt)
+		pr.write(")")
+		return
+	}
+
+	switch rr := r.(type) {
+	case *Node:
+		pr.write(rr.Name)
+	case *Token:
+		pr.write(quoteToken(rr.Value))
+	case *Labeled:
+		if pr.writesDoc(rr) {
+			// The doc has to go on its own lines, before the label.
+			if !pr.atLineStart {
+				pr.sb.WriteString("\n" + pr.indent)
+			}
+			for _, line := range strings.Split(rr.Doc, "\n") {
+				pr.sb.WriteString(strings.TrimRight("// "+line, " ") + "\n" + pr.indent)
+			}
+		}
+		pr.write(rr.Label + ":")
+		pr.rule(rr.Rule, precPostfix)
+	case *Opt:
+		pr.rule(rr.Rule, precAtom)
+		pr.write("?")
+	case *Rep:
+		pr.rule(rr.Rule, precAtom)
+		pr.write("*")
+	case *Seq:
+		for i, sub := range rr.Rules {
+			if i > 0 {
+				if lbl, ok := sub.(*Labeled); ok && pr.writesDoc(lbl) {
+					pr.sb.WriteString("\n" + pr.indent)
+					pr.atLineStart = true
+				} else {
+					pr.write(" ")
+				}
+			}
+			pr.rule(sub, precPostfix)
+		}
+	case *Alt:
+		for i, sub := range rr.Rules {
+			if i > 0 {
+				pr.write(" | ")
+			}
+			pr.rule(sub, precSeq)
+		}
+	default:
+		panic(fmt.Sprintf("unknown rule type %T", r))
+	}
+}
+
+// writesDoc reports whether the doc of lbl should be written before it.
+func (pr *printer) writesDoc(lbl *Labeled) bool {
+	return pr.multiline && lbl.Doc != "" && lbl != pr.docWritten
+}
+
+func (pr *printer) write(s string) {
+	pr.sb.WriteString(s)
+	pr.atLineStart = false
+}
+
+// quoteToken returns the value of a Token quoted in Ungrammar syntax, escaping
+// quotes and backslashes.
+func quoteToken(value string) string {
+	var sb strings.Builder
+	sb.WriteByte('\'')
+	for _, r := range value {
+		if r == '\'' || r == '\\' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	sb.WriteByte('\'')
+	return sb.String()
+}
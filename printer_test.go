@@ -0,0 +1,174 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package ungrammar
+
+import (
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFormatRule(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  string
+	}{
+		{`x = a`, `a`},
+		{`x = ( a )`, `a`},
+		{`x = 'a\'b\\c'`, `'a\'b\\c'`},
+		{`x = a b | c`, `a b | c`},
+		{`x = a (b | c)`, `a (b | c)`},
+		{`x = (a b) | c`, `a b | c`},
+		{`x = (a b)* c?`, `(a b)* c?`},
+		{`x = (a | b)?`, `(a | b)?`},
+		{`x = l:a?`, `l:a?`},
+		{`x = (l:a)?`, `(l:a)?`},
+		{`x = l:(a b)`, `l:(a b)`},
+		{`x = l:(a | b)*`, `l:(a | b)*`},
+		{`x = a (b c) d`, `a (b c) d`},
+		{`x = a | (b | c)`, `a | (b | c)`},
+		{`x = (a?)?`, `(a?)?`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			g, err := NewParser(tt.input).ParseGrammar()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := FormatRule(g.Rules["x"])
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+
+			// The formatted rule parses back to the same structure.
+			g2, err := NewParser("x = " + got).ParseGrammar()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if g.String() != g2.String() {
+				t.Errorf("reparsed rule %v != original %v", g2.String(), g.String())
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	input := `// The grammar
+
+// Doc of Foo
+Foo = a (b | c)* | l:d
+Bar =
+  // first
+  x:y
+  // second
+  | 'z' p:q
+Baz = w
+// doc of r
+r:Rule`
+
+	g, err := NewParser(input).ParseGrammar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	if err := g.Format(&sb); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `// The grammar
+
+// Doc of Foo
+Foo =
+  a (b | c)*
+| l:d
+
+Bar =
+  // first
+  x:y
+  // second
+| 'z' p:q
+
+Baz =
+  w
+  // doc of r
+  r:Rule
+`
+	if sb.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", sb.String(), want)
+	}
+}
+
+// Check that formatting grammars and parsing them back produces the same
+// grammars.
+func TestFormatRoundTrip(t *testing.T) {
+	inputs := []string{
+		readFileOrPanic(filepath.Join("testdata", "ungrammar.ungrammar")),
+		readFileOrPanic(filepath.Join("testdata", "exprlang.ungrammar")),
+		readFileOrPanic(filepath.Join("testdata", "rust.ungrammar")),
+		`x = a (
+		   // doc a
+		   b c
+		 | d
+		 // doc e
+		 | e) f`,
+	}
+
+	for _, input := range inputs {
+		g, err := NewParser(input).ParseGrammar()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sb strings.Builder
+		if err := g.Format(&sb); err != nil {
+			t.Fatal(err)
+		}
+
+		g2, err := NewParser(sb.String()).ParseGrammar()
+		if err != nil {
+			t.Fatalf("error parsing formatted grammar: %v\n%s", err, sb.String())
+		}
+		if g.String() != g2.String() {
+			t.Errorf("reparsed grammar mismatch:\n%v", displaySliceDiff(grammarToStrings(g2), grammarToStrings(g)))
+		}
+		if !slices.Equal(g.Names, g2.Names) || !maps.Equal(g.Docs, g2.Docs) || g.Doc != g2.Doc {
+			t.Errorf("reparsed grammar names or docs mismatch")
+		}
+
+		// Formatting is idempotent.
+		var sb2 strings.Builder
+		if err := g2.Format(&sb2); err != nil {
+			t.Fatal(err)
+		}
+		if sb.String() != sb2.String() {
+			t.Errorf("formatting not idempotent:\n%s\n---\n%s", sb.String(), sb2.String())
+		}
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	g, _ := NewParser(`x = a | | b`).ParseGrammar()
+	var sb strings.Builder
+	if err := g.Format(&sb); err == nil {
+		t.Errorf("got no error for grammar with nil rules")
+	}
+
+	// A grammar constructed programmatically.
+	g = &Grammar{Rules: map[string]Rule{
+		"Foo": &Seq{Rules: []Rule{
+			&Labeled{Label: "l", Rule: &Alt{Rules: []Rule{&Node{Name: "A"}, &Token{Value: "'"}}}},
+			&Rep{Rule: &Opt{Rule: &Node{Name: "B"}}},
+		}},
+	}}
+	sb.Reset()
+	if err := g.Format(&sb); err != nil {
+		t.Fatal(err)
+	}
+	want := "Foo =\n  l:(A | '\\'') (B?)*\n"
+	if sb.String() != want {
+		t.Errorf("got %q, want %q", sb.String(), want)
+	}
+}
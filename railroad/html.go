@@ -0,0 +1,48 @@
+// go-ungrammar: HTML index of railroad diagrams.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package railroad
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+
+	"github.com/eliben/go-ungrammar"
+)
+
+// HTML returns an HTML page with the given title and the railroad diagrams of
+// all the rules of g, in the order of g.OrderedNames. Each diagram is in a
+// section with the rule's name as its id, and the boxes for references to
+// defined rules link to the sections of the rules.
+func HTML(g *ungrammar.Grammar, title string) []byte {
+	opts := Options{Link: func(name string) string {
+		if _, ok := g.Rules[name]; !ok {
+			return ""
+		}
+		return "#" + name
+	}}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n</head>\n<body>\n",
+		html.EscapeString(title))
+	fmt.Fprintf(&buf, "<h1>%s</h1>\n", html.EscapeString(title))
+	buf.WriteString("<ul>\n")
+	for _, name := range g.OrderedNames() {
+		fmt.Fprintf(&buf, "<li><a href=\"#%[1]s\">%[1]s</a></li>\n", html.EscapeString(name))
+	}
+	buf.WriteString("</ul>\n")
+	for _, name := range g.OrderedNames() {
+		r := g.Rules[name]
+		if r == nil {
+			continue
+		}
+		fmt.Fprintf(&buf, "<section id=\"%[1]s\">\n<h2>%[1]s</h2>\n", html.EscapeString(name))
+		writeSVG(&buf, r, opts)
+		buf.WriteString("</section>\n")
+	}
+	buf.WriteString("</body>\n</html>\n")
+	return buf.Bytes()
+}
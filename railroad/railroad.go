@@ -0,0 +1,356 @@
+// go-ungrammar: railroad diagrams.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+// Package railroad renders rules as railroad (syntax) diagrams in SVG.
+//
+// Tokens are drawn as rounded boxes and references to rules as square boxes,
+// which can link to the diagrams of the referenced rules. Sequences are drawn
+// left to right, alternatives are stacked below the first one, optional rules
+// have a bypass above them and repeated rules a loop below them; labels are
+// written above the rules they label.
+package railroad
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"unicode/utf8"
+
+	"github.com/eliben/go-ungrammar"
+)
+
+// Dimensions of diagrams, in pixels.
+const (
+	// arcRadius is the radius of the arcs connecting lines.
+	arcRadius = 10
+
+	// vertSpace is the vertical space between the branches of alternatives
+	// and loops.
+	vertSpace = 8
+
+	// gap is the horizontal space between the items of a sequence.
+	gap = 10
+
+	// boxHeight is the height of token and rule boxes; boxPadding is the
+	// horizontal space between their borders and their text.
+	boxHeight  = 22
+	boxPadding = 10
+
+	// charWidth is the (approximate) width of characters of the text in boxes,
+	// and labelCharWidth of the text of labels; labelHeight is the height of
+	// labels.
+	charWidth      = 9
+	labelCharWidth = 7
+	labelHeight    = 14
+
+	// margin is the space around a diagram.
+	margin = 20
+)
+
+// style is the default stylesheet of diagrams; elements have the classes
+// "token", "node" and "label" for styling.
+const style = `
+path { stroke-width: 2; stroke: black; fill: none; }
+rect { stroke-width: 2; stroke: black; fill: #eef; }
+rect.token { fill: #efe; }
+text { font: 14px monospace; text-anchor: middle; }
+text.label { font-size: 11px; text-anchor: start; fill: #555; }
+a text { fill: #00c; text-decoration: underline; }
+`
+
+// Options configures SVG.
+type Options struct {
+	// Link returns the URL that the box for a reference to the rule name links
+	// to, e.g. the diagram of the rule; boxes don't link anywhere if Link is
+	// nil or returns "".
+	Link func(name string) string
+}
+
+// SVG returns a standalone SVG railroad diagram of r.
+func SVG(r ungrammar.Rule, opts Options) []byte {
+	var buf bytes.Buffer
+	writeSVG(&buf, r, opts)
+	return buf.Bytes()
+}
+
+func writeSVG(buf *bytes.Buffer, r ungrammar.Rule, opts Options) {
+	d := layout(r)
+	width := 2*margin + 2*gap + d.width()
+	height := 2*margin + d.up() + d.down()
+	fmt.Fprintf(buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		width, height, width, height)
+	fmt.Fprintf(buf, "<style>%s</style>\n", style)
+
+	w := &writer{buf: buf, opts: opts}
+	x, y := margin, margin+d.up()
+	// Start and end bars, with short lines leading to the diagram.
+	w.path("M %d %d v 20 m 0 -10 h %d", x, y-10, gap)
+	d.render(w, x+gap, y)
+	w.path("M %d %d h %d m 0 -10 v 20", x+gap+d.width(), y, gap)
+	buf.WriteString("</svg>\n")
+}
+
+// writer writes the elements of a diagram.
+type writer struct {
+	buf  *bytes.Buffer
+	opts Options
+}
+
+func (w *writer) path(format string, args ...any) {
+	fmt.Fprintf(w.buf, `<path d="%s"/>`+"\n", fmt.Sprintf(format, args...))
+}
+
+// hline draws a horizontal line from (x1, y) to (x2, y), if they differ.
+func (w *writer) hline(x1, x2, y int) {
+	if x1 != x2 {
+		w.path("M %d %d H %d", x1, y, x2)
+	}
+}
+
+// diagram is the layout of a rule. Its entry is on its left edge and its exit
+// on its right edge, both on a horizontal line extending up() pixels above
+// and down() pixels below.
+type diagram interface {
+	width() int
+	up() int
+	down() int
+
+	// render draws the diagram with its entry at (x, y).
+	render(w *writer, x, y int)
+}
+
+// layout returns the diagram of r.
+func layout(r ungrammar.Rule) diagram {
+	switch rr := r.(type) {
+	case *ungrammar.Token:
+		return &box{text: rr.Value, class: "token"}
+	case *ungrammar.Node:
+		return &box{text: rr.Name, class: "node", name: rr.Name}
+	case *ungrammar.Labeled:
+		return &labeled{label: rr.Label, d: layout(rr.Rule)}
+	case *ungrammar.Seq:
+		s := &sequence{}
+		for _, sub := range rr.Rules {
+			s.items = append(s.items, layout(sub))
+		}
+		return s
+	case *ungrammar.Alt:
+		c := &choice{}
+		for _, sub := range rr.Rules {
+			c.branches = append(c.branches, layout(sub))
+		}
+		return c
+	case *ungrammar.Opt:
+		return &optional{d: layout(rr.Rule)}
+	case *ungrammar.Rep:
+		return &optional{d: &loop{d: layout(rr.Rule)}}
+	}
+	return &sequence{}
+}
+
+// box is a token or a reference to a rule.
+type box struct {
+	text  string
+	class string
+
+	// name is the name of the referenced rule.
+	name string
+}
+
+func (b *box) width() int { return utf8.RuneCountInString(b.text)*charWidth + 2*boxPadding }
+func (b *box) up() int    { return boxHeight / 2 }
+func (b *box) down() int  { return boxHeight / 2 }
+
+func (b *box) render(w *writer, x, y int) {
+	rx := 0
+	if b.class == "token" {
+		rx = boxHeight / 2
+	}
+	fmt.Fprintf(w.buf, `<rect class="%s" x="%d" y="%d" width="%d" height="%d" rx="%d"/>`+"\n",
+		b.class, x, y-boxHeight/2, b.width(), boxHeight, rx)
+	text := fmt.Sprintf(`<text x="%d" y="%d">%s</text>`, x+b.width()/2, y+5, html.EscapeString(b.text))
+	if link := w.link(b.name); link != "" {
+		text = fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(link), text)
+	}
+	w.buf.WriteString(text + "\n")
+}
+
+func (w *writer) link(name string) string {
+	if name == "" || w.opts.Link == nil {
+		return ""
+	}
+	return w.opts.Link(name)
+}
+
+// labeled is a diagram with a label written above it.
+type labeled struct {
+	label string
+	d     diagram
+}
+
+func (l *labeled) width() int {
+	return max(l.d.width(), (utf8.RuneCountInString(l.label)+1)*labelCharWidth)
+}
+func (l *labeled) up() int   { return l.d.up() + labelHeight }
+func (l *labeled) down() int { return l.d.down() }
+
+func (l *labeled) render(w *writer, x, y int) {
+	fmt.Fprintf(w.buf, `<text class="label" x="%d" y="%d">%s:</text>`+"\n", x, y-l.d.up()-4, html.EscapeString(l.label))
+	l.d.render(w, x, y)
+	w.hline(x+l.d.width(), x+l.width(), y)
+}
+
+// sequence is a series of diagrams, drawn left to right.
+type sequence struct {
+	items []diagram
+}
+
+func (s *sequence) width() int {
+	width := 0
+	for i, d := range s.items {
+		if i > 0 {
+			width += gap
+		}
+		width += d.width()
+	}
+	return width
+}
+
+func (s *sequence) up() int {
+	up := 0
+	for _, d := range s.items {
+		up = max(up, d.up())
+	}
+	return up
+}
+
+func (s *sequence) down() int {
+	down := 0
+	for _, d := range s.items {
+		down = max(down, d.down())
+	}
+	return down
+}
+
+func (s *sequence) render(w *writer, x, y int) {
+	for i, d := range s.items {
+		if i > 0 {
+			w.hline(x, x+gap, y)
+			x += gap
+		}
+		d.render(w, x, y)
+		x += d.width()
+	}
+}
+
+// choice is a set of alternative diagrams: the first one on the main line,
+// and the others stacked below it.
+type choice struct {
+	branches []diagram
+}
+
+// offsets returns the vertical offsets of the branches from the main line.
+func (c *choice) offsets() []int {
+	offsets := make([]int, len(c.branches))
+	for i := 1; i < len(c.branches); i++ {
+		offsets[i] = offsets[i-1] + max(c.branches[i-1].down()+vertSpace+c.branches[i].up(), 2*arcRadius)
+	}
+	return offsets
+}
+
+func (c *choice) width() int {
+	width := 0
+	for _, d := range c.branches {
+		width = max(width, d.width())
+	}
+	return width + 4*arcRadius
+}
+
+func (c *choice) up() int {
+	if len(c.branches) == 0 {
+		return 0
+	}
+	return c.branches[0].up()
+}
+
+func (c *choice) down() int {
+	if len(c.branches) == 0 {
+		return 0
+	}
+	last := len(c.branches) - 1
+	return c.offsets()[last] + c.branches[last].down()
+}
+
+func (c *choice) render(w *writer, x, y int) {
+	right := x + c.width()
+	offsets := c.offsets()
+	for i, d := range c.branches {
+		dy := offsets[i]
+		if i == 0 {
+			w.hline(x, x+2*arcRadius, y)
+		} else {
+			// Curve down from the entry, and back up to the exit.
+			w.path("M %d %d a %d %d 0 0 1 %d %d v %d a %d %d 0 0 0 %d %d",
+				x, y, arcRadius, arcRadius, arcRadius, arcRadius, dy-2*arcRadius, arcRadius, arcRadius, arcRadius, arcRadius)
+			w.path("M %d %d a %d %d 0 0 0 %d %d v %d a %d %d 0 0 1 %d %d",
+				right-2*arcRadius, y+dy, arcRadius, arcRadius, arcRadius, -arcRadius, -(dy - 2*arcRadius), arcRadius, arcRadius, arcRadius, -arcRadius)
+		}
+		d.render(w, x+2*arcRadius, y+dy)
+		w.hline(x+2*arcRadius+d.width(), right-2*arcRadius, y+dy)
+		if i == 0 {
+			w.hline(right-2*arcRadius, right, y)
+		}
+	}
+}
+
+// optional is a diagram with a bypass above it.
+type optional struct {
+	d diagram
+}
+
+// bypass returns the vertical offset of the bypass above the main line.
+func (o *optional) bypass() int {
+	return max(o.d.up()+vertSpace, 2*arcRadius)
+}
+
+func (o *optional) width() int { return o.d.width() + 4*arcRadius }
+func (o *optional) up() int    { return o.bypass() }
+func (o *optional) down() int  { return o.d.down() }
+
+func (o *optional) render(w *writer, x, y int) {
+	right := x + o.width()
+	dy := o.bypass()
+	w.path("M %d %d a %d %d 0 0 0 %d %d v %d a %d %d 0 0 1 %d %d H %d a %d %d 0 0 1 %d %d v %d a %d %d 0 0 0 %d %d",
+		x, y, arcRadius, arcRadius, arcRadius, -arcRadius, -(dy - 2*arcRadius), arcRadius, arcRadius, arcRadius, -arcRadius,
+		right-2*arcRadius, arcRadius, arcRadius, arcRadius, arcRadius, dy-2*arcRadius, arcRadius, arcRadius, arcRadius, arcRadius)
+	w.hline(x, x+2*arcRadius, y)
+	o.d.render(w, x+2*arcRadius, y)
+	w.hline(x+2*arcRadius+o.d.width(), right, y)
+}
+
+// loop is a diagram that can be repeated, with a loop back below it.
+type loop struct {
+	d diagram
+}
+
+// back returns the vertical offset of the loop back below the main line.
+func (l *loop) back() int {
+	return max(l.d.down()+vertSpace, 2*arcRadius)
+}
+
+func (l *loop) width() int { return l.d.width() + 2*arcRadius }
+func (l *loop) up() int    { return l.d.up() }
+func (l *loop) down() int  { return l.back() }
+
+func (l *loop) render(w *writer, x, y int) {
+	right := x + l.width()
+	dy := l.back()
+	w.hline(x, x+arcRadius, y)
+	l.d.render(w, x+arcRadius, y)
+	w.hline(x+arcRadius+l.d.width(), right, y)
+	w.path("M %d %d a %d %d 0 0 1 %d %d v %d a %d %d 0 0 1 %d %d H %d a %d %d 0 0 1 %d %d v %d a %d %d 0 0 1 %d %d",
+		right-arcRadius, y, arcRadius, arcRadius, arcRadius, arcRadius, dy-2*arcRadius, arcRadius, arcRadius, -arcRadius, arcRadius,
+		x+arcRadius, arcRadius, arcRadius, -arcRadius, -arcRadius, -(dy - 2*arcRadius), arcRadius, arcRadius, arcRadius, -arcRadius)
+}
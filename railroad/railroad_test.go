@@ -0,0 +1,245 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package railroad
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/eliben/go-ungrammar"
+)
+
+func mustParse(t *testing.T, input string) *ungrammar.Grammar {
+	t.Helper()
+	g, err := ungrammar.NewParser(input).ParseGrammar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func mustParseRule(t *testing.T, input string) ungrammar.Rule {
+	t.Helper()
+	return mustParse(t, "X = "+input).Rules["X"]
+}
+
+func TestLayout(t *testing.T) {
+	var tests = []struct {
+		input           string
+		width, up, down int
+	}{
+		{"'a'", 29, 11, 11},
+		{"Name", 56, 11, 11},
+		{"'a' 'b'", 68, 11, 11},
+		{"x:Name", 56, 25, 11},
+		{"long_label:'a'", 77, 25, 11},
+
+		// Widths count runes, not bytes.
+		{"'é'", 29, 11, 11},
+		{"'€€€€'", 56, 11, 11},
+		{"'a' | 'b'", 69, 11, 41},
+		{"'a' | 'b' | 'c'", 69, 11, 71},
+		{"'a'?", 69, 20, 11},
+		{"'a'*", 89, 20, 20},
+		{"('a' | 'b')*", 129, 20, 49},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			d := layout(mustParseRule(t, tt.input))
+			if d.width() != tt.width || d.up() != tt.up || d.down() != tt.down {
+				t.Errorf("got width=%d up=%d down=%d, want %d %d %d", d.width(), d.up(), d.down(), tt.width, tt.up, tt.down)
+			}
+		})
+	}
+}
+
+// Names and labels of rules constructed without a parser may contain runes
+// outside ASCII.
+func TestLayoutRunes(t *testing.T) {
+	d := layout(&ungrammar.Labeled{Label: "lóng_lábél", Rule: &ungrammar.Node{Name: "Nämé"}})
+	if d.width() != 77 {
+		t.Errorf("got width=%d, want 77", d.width())
+	}
+	if d := layout(&ungrammar.Node{Name: "Nämé"}); d.width() != 56 {
+		t.Errorf("got width=%d, want 56", d.width())
+	}
+}
+
+// svgElements decodes an SVG document, returning its elements.
+func svgElements(t *testing.T, svg []byte) []xml.StartElement {
+	t.Helper()
+	var elems []xml.StartElement
+	dec := xml.NewDecoder(strings.NewReader(string(svg)))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if err.Error() != "EOF" {
+				t.Fatal(err)
+			}
+			return elems
+		}
+		if se, ok := tok.(xml.StartElement); ok {
+			elems = append(elems, se)
+		}
+	}
+}
+
+func attr(se xml.StartElement, name string) string {
+	for _, a := range se.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func TestSVG(t *testing.T) {
+	r := mustParseRule(t, "'<' args:Arg* '>' Other")
+	svg := SVG(r, Options{Link: func(name string) string {
+		if name == "Arg" {
+			return name + ".svg"
+		}
+		return ""
+	}})
+	if !strings.Contains(string(svg), "&lt;") || !strings.Contains(string(svg), "&gt;") {
+		t.Errorf("tokens not escaped:\n%s", svg)
+	}
+
+	var links, rects []string
+	for _, se := range svgElements(t, svg) {
+		switch se.Name.Local {
+		case "a":
+			links = append(links, attr(se, "href"))
+		case "rect":
+			rects = append(rects, attr(se, "class"))
+		}
+	}
+	if strings.Join(links, " ") != "Arg.svg" {
+		t.Errorf("got links %v", links)
+	}
+	if got := strings.Join(rects, " "); got != "token node token node" {
+		t.Errorf("got rects %s", got)
+	}
+}
+
+type point struct{ x, y int }
+
+// pathEnds returns the end points of the lines drawn by the path data d,
+// which uses the commands emitted by this package.
+func pathEnds(t *testing.T, d string) []point {
+	t.Helper()
+	fields := strings.Fields(d)
+	num := func(i int) int {
+		n, err := strconv.Atoi(fields[i])
+		if err != nil {
+			t.Fatalf("bad path %q: %v", d, err)
+		}
+		return n
+	}
+	var ends []point
+	var cur point
+	for i := 0; i < len(fields); {
+		switch cmd := fields[i]; cmd {
+		case "M", "m":
+			if i > 0 {
+				ends = append(ends, cur)
+			}
+			if cmd == "M" {
+				cur = point{num(i + 1), num(i + 2)}
+			} else {
+				cur = point{cur.x + num(i+1), cur.y + num(i+2)}
+			}
+			ends = append(ends, cur)
+			i += 3
+		case "h":
+			cur.x += num(i + 1)
+			i += 2
+		case "H":
+			cur.x = num(i + 1)
+			i += 2
+		case "v":
+			cur.y += num(i + 1)
+			i += 2
+		case "a":
+			cur = point{cur.x + num(i+6), cur.y + num(i+7)}
+			i += 8
+		default:
+			t.Fatalf("unexpected command %q in path %q", cmd, d)
+		}
+	}
+	return append(ends, cur)
+}
+
+// TestConnected checks that all the lines in the diagrams of the rules of the
+// test grammars are connected: each end of a line meets the end of another
+// line or the middle of a box's side, except for the start and end bars.
+func TestConnected(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("..", "testdata", "*.ungrammar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g := mustParse(t, string(src))
+		for _, name := range g.OrderedNames() {
+			ends := make(map[point]int)
+			for _, se := range svgElements(t, SVG(g.Rules[name], Options{})) {
+				switch se.Name.Local {
+				case "path":
+					for _, p := range pathEnds(t, attr(se, "d")) {
+						ends[p]++
+					}
+				case "rect":
+					n := func(a string) int {
+						v, _ := strconv.Atoi(attr(se, a))
+						return v
+					}
+					y := n("y") + n("height")/2
+					ends[point{n("x"), y}]++
+					ends[point{n("x") + n("width"), y}]++
+				}
+			}
+			dangling := 0
+			for _, c := range ends {
+				if c < 2 {
+					dangling++
+				}
+			}
+			// Each bar has 3 dangling points: its two ends and its middle,
+			// where the line to the diagram starts.
+			if dangling != 6 {
+				t.Errorf("%s: %s: got %d dangling line ends, want 6", filepath.Base(path), name, dangling)
+			}
+		}
+	}
+}
+
+func TestHTML(t *testing.T) {
+	g := mustParse(t, `
+Expr = Literal | Paren
+Paren = '(' Expr ')' Missing
+Literal = 'number'
+`)
+	page := string(HTML(g, "Exprs & more"))
+	for _, want := range []string{
+		"<title>Exprs &amp; more</title>",
+		`<li><a href="#Paren">Paren</a></li>`,
+		"<section id=\"Paren\">\n<h2>Paren</h2>\n<svg",
+		`<a href="#Expr"><text`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page doesn't contain %q", want)
+		}
+	}
+	if strings.Contains(page, `href="#Missing"`) {
+		t.Errorf("page links to undefined rule")
+	}
+}
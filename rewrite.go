@@ -0,0 +1,280 @@
+// go-ungrammar: rewriting rule trees.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package ungrammar
+
+import (
+	"fmt"
+	"slices"
+)
+
+// An ApplyFunc is invoked by Apply for each rule, including nil children of
+// Labeled, Opt and Rep rules, during traversal. The return value of ApplyFunc
+// controls the syntax tree traversal. See Apply for details.
+type ApplyFunc func(*Cursor) bool
+
+// Apply traverses a rule tree recursively, starting with root, and calling
+// pre and post for each rule as described below. Apply returns the root of
+// the possibly modified tree, which differs from root if root was replaced.
+//
+// Apply is modeled on astutil.Apply. If pre is not nil, it is called for each
+// rule before the rule's children are traversed (pre-order). If pre returns
+// false, no children are traversed, and post is not called for that rule.
+//
+// If post is not nil, and a prior call of pre didn't return false, post is
+// called for each rule after its children are traversed (post-order). If post
+// returns false, traversal is terminated and Apply returns immediately.
+//
+// Apply rewrites the tree in place; use Clone to keep the original. Rules
+// keep their spans, so unchanged rules keep reporting their location in the
+// input; the spans of parents aren't updated when their children change.
+//
+// If pre replaces the current rule, the children of the new rule are
+// traversed instead of those of the old one. Rules inserted with InsertBefore
+// and InsertAfter aren't traversed.
+func Apply(root Rule, pre, post ApplyFunc) Rule {
+	result, _ := applyNamed("", root, pre, post)
+	return result
+}
+
+// applyNamed implements Apply for the tree of the rule name (see Cursor.Name).
+// It also reports whether post terminated the traversal.
+func applyNamed(name string, root Rule, pre, post ApplyFunc) (result Rule, aborted bool) {
+	parent := &rootRule{Rule: root}
+	defer func() {
+		if r := recover(); r != nil {
+			if r != abort {
+				panic(r)
+			}
+			aborted = true
+		}
+		result = parent.Rule
+	}()
+	a := &application{name: name, pre: pre, post: post}
+	a.apply(parent, &parent.Rule)
+	return parent.Rule, false
+}
+
+// rootRule is the parent of the root of the tree traversed by Apply, so the
+// root can be replaced like any other rule.
+type rootRule struct {
+	Rule
+}
+
+var abort = new(int) // singleton, to signal termination of Apply
+
+// A Cursor describes a rule encountered during Apply. Information about the
+// rule and its parent is available from the Rule, Parent and Index methods.
+//
+// The Replace, Delete, InsertBefore and InsertAfter methods can be used to
+// change the tree around the current rule.
+type Cursor struct {
+	name   string
+	parent Rule
+	rule   Rule
+
+	// ref points to the field or slice element holding the current rule.
+	ref *Rule
+
+	// If the current rule is an element of the Rules of a Seq or Alt, iter
+	// tracks its position in the slice.
+	iter *iterator
+}
+
+type iterator struct {
+	index, step int
+}
+
+// Rule returns the current rule.
+func (c *Cursor) Rule() Rule {
+	return c.rule
+}
+
+// Parent returns the parent of the current rule, or nil for the root of the
+// traversal.
+func (c *Cursor) Parent() Rule {
+	if _, ok := c.parent.(*rootRule); ok {
+		return nil
+	}
+	return c.parent
+}
+
+// Name returns the name of the named rule whose tree is being traversed, when
+// called from Grammar.Rewrite; otherwise it returns "".
+func (c *Cursor) Name() string {
+	return c.name
+}
+
+// Index reports the index of the current rule in the Rules of its parent Seq
+// or Alt, or a value < 0 if the current rule isn't part of such a slice. The
+// index of the current rule changes if InsertBefore is called while
+// processing the current rule.
+func (c *Cursor) Index() int {
+	if c.iter != nil {
+		return c.iter.index
+	}
+	return -1
+}
+
+// Replace replaces the current rule with r. Replace panics if the current
+// rule was deleted.
+func (c *Cursor) Replace(r Rule) {
+	if c.ref == nil {
+		panic("Cursor.Replace: rule was deleted")
+	}
+	*c.ref = r
+	c.rule = r
+}
+
+// Delete deletes the current rule from its containing Seq or Alt. If the
+// current rule isn't part of a Seq or Alt, Delete panics.
+func (c *Cursor) Delete() {
+	rules, docs := c.siblings("Delete")
+	i := c.iter.index
+	*rules = slices.Delete(*rules, i, i+1)
+	if len(*docs) > 0 {
+		*docs = slices.Delete(*docs, i, i+1)
+	}
+	c.iter.step--
+	c.ref = nil
+}
+
+// InsertBefore inserts r before the current rule in its containing Seq or
+// Alt. If the current rule isn't part of a Seq or Alt, InsertBefore panics.
+// Apply does not walk r.
+func (c *Cursor) InsertBefore(r Rule) {
+	rules, docs := c.siblings("InsertBefore")
+	i := c.iter.index
+	*rules = slices.Insert(*rules, i, r)
+	if len(*docs) > 0 {
+		*docs = slices.Insert(*docs, i, "")
+	}
+	c.iter.index++
+	c.ref = &(*rules)[c.iter.index]
+}
+
+// InsertAfter inserts r after the current rule in its containing Seq or Alt.
+// If the current rule isn't part of a Seq or Alt, InsertAfter panics. Apply
+// does not walk r.
+func (c *Cursor) InsertAfter(r Rule) {
+	rules, docs := c.siblings("InsertAfter")
+	i := c.iter.index
+	*rules = slices.Insert(*rules, i+1, r)
+	if len(*docs) > 0 {
+		*docs = slices.Insert(*docs, i+1, "")
+	}
+	c.iter.step++
+	c.ref = &(*rules)[i]
+}
+
+// siblings returns the slice holding the current rule, and the Docs of the
+// parent if it's an Alt (they're kept in sync with its Rules). It panics if
+// the current rule isn't in a slice.
+func (c *Cursor) siblings(method string) (rules *[]Rule, docs *[]string) {
+	if c.iter == nil || c.ref == nil {
+		panic(fmt.Sprintf("Cursor.%s: rule not contained in a Seq or Alt", method))
+	}
+	var noDocs []string
+	switch p := c.parent.(type) {
+	case *Seq:
+		return &p.Rules, &noDocs
+	case *Alt:
+		return &p.Rules, &p.Docs
+	}
+	panic("unreachable")
+}
+
+type application struct {
+	name      string
+	pre, post ApplyFunc
+}
+
+// apply applies pre and post to the rule held in *ref, whose parent is
+// parent, and traverses its children.
+func (a *application) apply(parent Rule, ref *Rule) {
+	a.applyAt(parent, ref, nil)
+}
+
+func (a *application) applyAt(parent Rule, ref *Rule, iter *iterator) {
+	c := &Cursor{name: a.name, parent: parent, rule: *ref, ref: ref, iter: iter}
+	if a.pre != nil && !a.pre(c) {
+		return
+	}
+
+	switch r := c.rule.(type) {
+	case *Labeled:
+		a.apply(r, &r.Rule)
+	case *Opt:
+		a.apply(r, &r.Rule)
+	case *Rep:
+		a.apply(r, &r.Rule)
+	case *Seq:
+		a.applyList(r, &r.Rules)
+	case *Alt:
+		a.applyList(r, &r.Rules)
+	}
+
+	if a.post != nil && !a.post(c) {
+		panic(abort)
+	}
+}
+
+func (a *application) applyList(parent Rule, rules *[]Rule) {
+	iter := &iterator{}
+	for iter.index < len(*rules) {
+		iter.step = 1
+		a.applyAt(parent, &(*rules)[iter.index], iter)
+		iter.index += iter.step
+	}
+}
+
+// Clone returns a deep copy of the rule tree r. The copy has the same spans
+// and docs as r.
+func Clone(r Rule) Rule {
+	switch rr := r.(type) {
+	case *Labeled:
+		c := *rr
+		c.Rule = Clone(rr.Rule)
+		return &c
+	case *Node:
+		c := *rr
+		return &c
+	case *Token:
+		c := *rr
+		return &c
+	case *Opt:
+		c := *rr
+		c.Rule = Clone(rr.Rule)
+		return &c
+	case *Rep:
+		c := *rr
+		c.Rule = Clone(rr.Rule)
+		return &c
+	case *Seq:
+		c := *rr
+		c.Rules = cloneRules(rr.Rules)
+		return &c
+	case *Alt:
+		c := *rr
+		c.Rules = cloneRules(rr.Rules)
+		c.Docs = slices.Clone(rr.Docs)
+		return &c
+	case nil:
+		return nil
+	default:
+		panic(fmt.Sprintf("unknown rule type %T", r))
+	}
+}
+
+func cloneRules(rules []Rule) []Rule {
+	if rules == nil {
+		return nil
+	}
+	clones := make([]Rule, len(rules))
+	for i, r := range rules {
+		clones[i] = Clone(r)
+	}
+	return clones
+}
@@ -0,0 +1,235 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package ungrammar
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	var tests = []struct {
+		input string
+		pre   ApplyFunc
+		post  ApplyFunc
+		want  string
+	}{
+		{
+			`a b c`,
+			func(c *Cursor) bool {
+				if n, ok := c.Rule().(*Node); ok && n.Name == "b" {
+					c.Replace(&Token{Value: "B"})
+				}
+				return true
+			},
+			nil,
+			`a 'B' c`,
+		},
+		{
+			`a b c b`,
+			func(c *Cursor) bool {
+				if n, ok := c.Rule().(*Node); ok && n.Name == "b" {
+					c.Delete()
+				}
+				return true
+			},
+			nil,
+			`a c`,
+		},
+		{
+			`a b`,
+			func(c *Cursor) bool {
+				if _, ok := c.Rule().(*Node); ok {
+					c.InsertBefore(&Token{Value: "<"})
+					c.InsertAfter(&Token{Value: ">"})
+				}
+				return true
+			},
+			nil,
+			`'<' a '>' '<' b '>'`,
+		},
+		{
+			// Replacing the root.
+			`a`,
+			func(c *Cursor) bool {
+				if c.Parent() == nil {
+					c.Replace(&Opt{Rule: c.Rule()})
+				}
+				return true
+			},
+			nil,
+			`a?`,
+		},
+		{
+			// Children of replacements are traversed.
+			`a | b`,
+			func(c *Cursor) bool {
+				switch r := c.Rule().(type) {
+				case *Alt:
+					c.Replace(&Seq{Rules: r.Rules})
+				case *Node:
+					c.Replace(&Rep{Rule: r})
+					return false
+				}
+				return true
+			},
+			nil,
+			`a* b*`,
+		},
+		{
+			// Returning false from pre skips the children.
+			`a (b c)?`,
+			func(c *Cursor) bool {
+				if n, ok := c.Rule().(*Node); ok {
+					n.Name += "1"
+				}
+				_, isOpt := c.Rule().(*Opt)
+				return !isOpt
+			},
+			nil,
+			`a1 (b c)?`,
+		},
+		{
+			// Returning false from post terminates the traversal.
+			`a b c`,
+			nil,
+			func(c *Cursor) bool {
+				if n, ok := c.Rule().(*Node); ok {
+					n.Name += "1"
+					return n.Name != "b1"
+				}
+				return true
+			},
+			`a1 b1 c`,
+		},
+		{
+			// Post-order simplification of single-element sequences.
+			`a (b c) d`,
+			func(c *Cursor) bool {
+				if n, ok := c.Rule().(*Node); ok && (n.Name == "c" || n.Name == "d") {
+					c.Delete()
+				}
+				return true
+			},
+			func(c *Cursor) bool {
+				if seq, ok := c.Rule().(*Seq); ok && len(seq.Rules) == 1 {
+					c.Replace(seq.Rules[0])
+				}
+				return true
+			},
+			`a b`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			r := mustParseRule(t, tt.input)
+			got := FormatRule(Apply(r, tt.pre, tt.post))
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyCursor(t *testing.T) {
+	r := mustParseRule(t, `a l:(b | c)`)
+
+	type visit struct {
+		rule   string
+		parent string
+		index  int
+	}
+	var got []visit
+	Apply(r, func(c *Cursor) bool {
+		parent := "<nil>"
+		if c.Parent() != nil {
+			parent = FormatRule(c.Parent())
+		}
+		got = append(got, visit{FormatRule(c.Rule()), parent, c.Index()})
+		return true
+	}, nil)
+
+	want := []visit{
+		{"a l:(b | c)", "<nil>", -1},
+		{"a", "a l:(b | c)", 0},
+		{"l:(b | c)", "a l:(b | c)", 1},
+		{"b | c", "l:(b | c)", -1},
+		{"b", "b | c", 0},
+		{"c", "b | c", 1},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v\nwant %v", got, want)
+	}
+}
+
+func TestApplyAltDocs(t *testing.T) {
+	g, err := NewParser(`x =
+  // doc a
+  a
+  // doc b
+| b
+| c`).ParseGrammar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	alt := Apply(g.Rules["x"], func(c *Cursor) bool {
+		if n, ok := c.Rule().(*Node); ok {
+			switch n.Name {
+			case "a":
+				c.Delete()
+			case "c":
+				c.InsertBefore(&Token{Value: "t"})
+			}
+		}
+		return true
+	}, nil).(*Alt)
+
+	if got := FormatRule(alt); got != "b | 't' | c" {
+		t.Errorf("got %s", got)
+	}
+	if want := []string{"doc b", "", ""}; !slices.Equal(alt.Docs, want) {
+		t.Errorf("got docs %q, want %q", alt.Docs, want)
+	}
+}
+
+func TestApplyKeepsLocations(t *testing.T) {
+	r := mustParseRule(t, `a b c`)
+	r = Apply(r, func(c *Cursor) bool {
+		if n, ok := c.Rule().(*Node); ok && n.Name == "a" {
+			c.Delete()
+		}
+		return true
+	}, nil)
+
+	var got []string
+	for _, sub := range r.(*Seq).Rules {
+		got = append(got, sub.Location().String())
+	}
+	if want := []string{"1:7", "1:9"}; !slices.Equal(got, want) {
+		t.Errorf("got locations %v, want %v", got, want)
+	}
+}
+
+func TestClone(t *testing.T) {
+	r := mustParseRule(t, `a l:(b | 'c')* d?`)
+	clone := Clone(r)
+	if got, want := FormatRule(clone), FormatRule(r); got != want {
+		t.Errorf("got clone %s, want %s", got, want)
+	}
+	if clone.Span() != r.Span() {
+		t.Errorf("got clone span %v, want %v", clone.Span(), r.Span())
+	}
+
+	// Modifying the clone doesn't affect the original.
+	Apply(clone, func(c *Cursor) bool {
+		if n, ok := c.Rule().(*Node); ok {
+			n.Name = "z"
+		}
+		return true
+	}, nil)
+	if got := FormatRule(r); got != "a l:(b | 'c')* d?" {
+		t.Errorf("original modified: %s", got)
+	}
+}
@@ -0,0 +1,379 @@
+// go-ungrammar: random generation of syntax trees.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+// Package sample generates random syntax trees and token streams that conform
+// to a grammar, e.g. for fuzzing language tools.
+//
+// A Generator expands rules starting from a root rule, picking alternatives,
+// the presence of optional rules and the number of repetitions at random.
+// From a configurable depth on, it switches to shortest derivations (computed
+// by a static analysis of the grammar), so generation always terminates.
+//
+// Generated trees follow the conventions of Grammar.CheckTree, which accepts
+// them: each rule expansion produces a node of the rule's kind, except for
+// rules that are alternations of rule names (like "Expr = Literal | BinExpr"),
+// which produce the node of the chosen alternative directly.
+package sample
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strings"
+
+	"github.com/eliben/go-ungrammar"
+)
+
+// Config configures a Generator. The zero value of each field selects a
+// default.
+type Config struct {
+	// Seed seeds the generator's random source; generators with the same
+	// grammar, configuration and seed generate the same samples.
+	Seed uint64
+
+	// MaxDepth is the depth of nested rule expansions from which on the
+	// generator only takes shortest derivations: it picks the alternatives
+	// that need the fewest nested expansions, omits optional rules and doesn't
+	// repeat repeated ones. The default is 10.
+	MaxDepth int
+
+	// OptProb is the probability of generating an optional rule (Opt). The
+	// default is 0.5; a negative value means 0.
+	OptProb float64
+
+	// RepProb is the probability of generating another repetition of a
+	// repeated rule (Rep), up to MaxRep repetitions. The default is 0.5; a
+	// negative value means 0.
+	RepProb float64
+
+	// MaxRep is the maximal number of repetitions of a repeated rule. The
+	// default is 5.
+	MaxRep int
+
+	// Weights maps rule names to weights for picking alternatives: an
+	// alternative that's a reference to rule R (possibly with a label) has
+	// weight Weights[R], and other alternatives or those of rules not in
+	// Weights have weight 1. An alternative with weight 0 is only picked if
+	// it's needed for a shortest derivation.
+	Weights map[string]float64
+
+	// TokenText returns the text of a token with the given value, e.g. a
+	// random identifier for 'ident'. If nil, the text of a token is its value.
+	TokenText func(value string, rng *rand.Rand) string
+}
+
+// Node is a node of a generated syntax tree: either a token or an interior
+// node with children. Node implements ungrammar.Tree.
+type Node struct {
+	kind     string
+	text     string
+	isToken  bool
+	children []*Node
+}
+
+// Kind returns the name of the rule of an interior node, or the value of a
+// token.
+func (n *Node) Kind() string {
+	return n.kind
+}
+
+// IsToken reports whether n is a token.
+func (n *Node) IsToken() bool {
+	return n.isToken
+}
+
+// Text returns the text of a token, or the texts of all the tokens of an
+// interior node separated by spaces.
+func (n *Node) Text() string {
+	if n.isToken {
+		return n.text
+	}
+	return Join(n.Tokens())
+}
+
+// Nodes returns the children of n.
+func (n *Node) Nodes() []*Node {
+	return n.children
+}
+
+// Children returns the children of n, as required by ungrammar.Tree.
+func (n *Node) Children() []ungrammar.Tree {
+	trees := make([]ungrammar.Tree, len(n.children))
+	for i, c := range n.children {
+		trees[i] = c
+	}
+	return trees
+}
+
+// Tokens returns the tokens of the subtree rooted at n, in order.
+func (n *Node) Tokens() []Token {
+	var toks []Token
+	var collect func(n *Node)
+	collect = func(n *Node) {
+		if n.isToken {
+			toks = append(toks, Token{Kind: n.kind, Text: n.text})
+		}
+		for _, c := range n.children {
+			collect(c)
+		}
+	}
+	collect(n)
+	return toks
+}
+
+// String returns a debug representation of the subtree rooted at n, like
+// `(Call (Literal "f") "(" ")")`; tokens are written as their quoted text.
+func (n *Node) String() string {
+	if n.isToken {
+		return fmt.Sprintf("%q", n.text)
+	}
+	parts := []string{n.kind}
+	for _, c := range n.children {
+		parts = append(parts, c.String())
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+// Token is a token of a generated token stream.
+type Token struct {
+	// Kind is the token's value in the grammar, like "ident" or "+".
+	Kind string
+	Text string
+}
+
+// Join returns the texts of toks separated by spaces.
+func Join(toks []Token) string {
+	texts := make([]string, len(toks))
+	for i, tok := range toks {
+		texts[i] = tok.Text
+	}
+	return strings.Join(texts, " ")
+}
+
+// unbounded is the derivation depth of rules that can't derive a finite tree.
+const unbounded = math.MaxInt
+
+// Generator generates random samples of a grammar.
+type Generator struct {
+	g   *ungrammar.Grammar
+	cfg Config
+	rng *rand.Rand
+
+	// minDepth maps rule names to the depth of their shortest derivations:
+	// the minimal number of nested rule expansions needed to derive a tree
+	// of tokens.
+	minDepth map[string]int
+}
+
+// New returns a generator of samples of g with the given configuration.
+func New(g *ungrammar.Grammar, cfg Config) *Generator {
+	if cfg.MaxDepth == 0 {
+		cfg.MaxDepth = 10
+	}
+	if cfg.OptProb == 0 {
+		cfg.OptProb = 0.5
+	}
+	if cfg.RepProb == 0 {
+		cfg.RepProb = 0.5
+	}
+	if cfg.MaxRep == 0 {
+		cfg.MaxRep = 5
+	}
+	gen := &Generator{
+		g:   g,
+		cfg: cfg,
+		rng: rand.New(rand.NewPCG(cfg.Seed, cfg.Seed^0x9e3779b97f4a7c15)),
+	}
+	gen.computeMinDepth()
+	return gen
+}
+
+// computeMinDepth computes gen.minDepth by iterating to a fixed point.
+func (gen *Generator) computeMinDepth() {
+	gen.minDepth = make(map[string]int)
+	for name := range gen.g.Rules {
+		gen.minDepth[name] = unbounded
+	}
+	for changed := true; changed; {
+		changed = false
+		for name, r := range gen.g.Rules {
+			if d := gen.ruleDepth(r); d < gen.minDepth[name] {
+				gen.minDepth[name] = d
+				changed = true
+			}
+		}
+	}
+}
+
+// ruleDepth returns the depth of the shortest derivation of r, given the
+// current minDepth of rules.
+func (gen *Generator) ruleDepth(r ungrammar.Rule) int {
+	switch rr := r.(type) {
+	case *ungrammar.Token, *ungrammar.Opt, *ungrammar.Rep:
+		return 0
+	case *ungrammar.Node:
+		d, ok := gen.minDepth[rr.Name]
+		if !ok || d == unbounded {
+			return unbounded
+		}
+		return d + 1
+	case *ungrammar.Labeled:
+		return gen.ruleDepth(rr.Rule)
+	case *ungrammar.Seq:
+		depth := 0
+		for _, sub := range rr.Rules {
+			depth = max(depth, gen.ruleDepth(sub))
+		}
+		return depth
+	case *ungrammar.Alt:
+		depth := unbounded
+		for _, sub := range rr.Rules {
+			depth = min(depth, gen.ruleDepth(sub))
+		}
+		return depth
+	}
+	return unbounded
+}
+
+// Tree generates a random syntax tree derived from the rule root. It returns
+// an error if root isn't defined, or can't derive a finite tree.
+func (gen *Generator) Tree(root string) (*Node, error) {
+	if _, ok := gen.g.Rules[root]; !ok {
+		return nil, fmt.Errorf("undefined rule %s", root)
+	}
+	if gen.minDepth[root] == unbounded {
+		return nil, fmt.Errorf("rule %s can't derive a finite tree", root)
+	}
+	return gen.expand(root, 0), nil
+}
+
+// Tokens generates a random token stream derived from the rule root; it's
+// equivalent to the tokens of a tree generated by Tree.
+func (gen *Generator) Tokens(root string) ([]Token, error) {
+	tree, err := gen.Tree(root)
+	if err != nil {
+		return nil, err
+	}
+	return tree.Tokens(), nil
+}
+
+// expand returns the node for an expansion of the rule name at the given
+// depth. Rules that are alternations of rule names expand directly to the
+// node of the chosen alternative.
+func (gen *Generator) expand(name string, depth int) *Node {
+	r := gen.g.Rules[name]
+	if isEnum(r) {
+		sub := gen.pickAlt(r.(*ungrammar.Alt), depth)
+		return gen.expand(sub.(*ungrammar.Node).Name, depth+1)
+	}
+	node := &Node{kind: name}
+	gen.generate(node, r, depth)
+	return node
+}
+
+// isEnum reports whether r is an alternation of rule names.
+func isEnum(r ungrammar.Rule) bool {
+	alt, ok := r.(*ungrammar.Alt)
+	if !ok {
+		return false
+	}
+	for _, sub := range alt.Rules {
+		if _, ok := sub.(*ungrammar.Node); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// generate appends the children generated for r at the given depth to
+// parent.
+func (gen *Generator) generate(parent *Node, r ungrammar.Rule, depth int) {
+	switch rr := r.(type) {
+	case *ungrammar.Token:
+		text := rr.Value
+		if gen.cfg.TokenText != nil {
+			text = gen.cfg.TokenText(rr.Value, gen.rng)
+		}
+		parent.children = append(parent.children, &Node{kind: rr.Value, text: text, isToken: true})
+	case *ungrammar.Node:
+		parent.children = append(parent.children, gen.expand(rr.Name, depth+1))
+	case *ungrammar.Labeled:
+		gen.generate(parent, rr.Rule, depth)
+	case *ungrammar.Seq:
+		for _, sub := range rr.Rules {
+			gen.generate(parent, sub, depth)
+		}
+	case *ungrammar.Alt:
+		gen.generate(parent, gen.pickAlt(rr, depth), depth)
+	case *ungrammar.Opt:
+		if gen.canGrow(rr.Rule, depth) && gen.rng.Float64() < gen.cfg.OptProb {
+			gen.generate(parent, rr.Rule, depth)
+		}
+	case *ungrammar.Rep:
+		for i := 0; i < gen.cfg.MaxRep && gen.canGrow(rr.Rule, depth) && gen.rng.Float64() < gen.cfg.RepProb; i++ {
+			gen.generate(parent, rr.Rule, depth)
+		}
+	}
+}
+
+// canGrow reports whether the optional or repeated rule r may be generated at
+// the given depth.
+func (gen *Generator) canGrow(r ungrammar.Rule, depth int) bool {
+	return depth < gen.cfg.MaxDepth && gen.ruleDepth(r) != unbounded
+}
+
+// pickAlt picks an alternative of alt at the given depth, at random by
+// weight; from MaxDepth on, only among the alternatives with the shortest
+// derivations. Alternatives that can't derive a finite tree are never picked.
+func (gen *Generator) pickAlt(alt *ungrammar.Alt, depth int) ungrammar.Rule {
+	var candidates []ungrammar.Rule
+	var weights []float64
+	best := unbounded
+	for _, sub := range alt.Rules {
+		best = min(best, gen.ruleDepth(sub))
+	}
+	for _, sub := range alt.Rules {
+		d := gen.ruleDepth(sub)
+		if d == unbounded || (depth >= gen.cfg.MaxDepth && d > best) {
+			continue
+		}
+		candidates = append(candidates, sub)
+		weights = append(weights, gen.weight(sub))
+	}
+
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	if total <= 0 {
+		// Only zero-weight alternatives are left; pick the shortest.
+		for _, sub := range candidates {
+			if gen.ruleDepth(sub) == best {
+				return sub
+			}
+		}
+	}
+	x := gen.rng.Float64() * total
+	for i, w := range weights {
+		if x < w {
+			return candidates[i]
+		}
+		x -= w
+	}
+	return candidates[len(candidates)-1]
+}
+
+// weight returns the weight of the alternative r (see Config.Weights).
+func (gen *Generator) weight(r ungrammar.Rule) float64 {
+	if lbl, ok := r.(*ungrammar.Labeled); ok {
+		r = lbl.Rule
+	}
+	if node, ok := r.(*ungrammar.Node); ok {
+		if w, ok := gen.cfg.Weights[node.Name]; ok {
+			return max(w, 0)
+		}
+	}
+	return 1
+}
@@ -0,0 +1,141 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package sample
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eliben/go-ungrammar"
+)
+
+func mustParse(t *testing.T, input string) *ungrammar.Grammar {
+	t.Helper()
+	g, err := ungrammar.NewParser(input).ParseGrammar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+// treeDepth returns the nesting depth of the interior nodes of n.
+func treeDepth(n *Node) int {
+	depth := 0
+	for _, c := range n.Nodes() {
+		if !c.IsToken() {
+			depth = max(depth, treeDepth(c))
+		}
+	}
+	return depth + 1
+}
+
+func TestTreesConform(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("..", "testdata", "*.ungrammar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := map[string]string{
+		"exprlang.ungrammar":  "Program",
+		"rust.ungrammar":      "SourceFile",
+		"ungrammar.ungrammar": "Grammar",
+	}
+	for _, path := range paths {
+		base := filepath.Base(path)
+		t.Run(base, func(t *testing.T) {
+			src, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			g := mustParse(t, string(src))
+			for seed := range uint64(20) {
+				gen := New(g, Config{Seed: seed, MaxDepth: 8})
+				tree, err := gen.Tree(roots[base])
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := g.CheckTree(tree); err != nil {
+					t.Fatalf("seed %d: generated tree doesn't conform: %v\n%s", seed, err, tree)
+				}
+			}
+		})
+	}
+}
+
+func TestDepthLimit(t *testing.T) {
+	g := mustParse(t, `
+Expr = Literal | Paren | Bin
+Paren = '(' Expr ')'
+Bin = Expr '+' Expr
+Literal = 'int'
+`)
+	for seed := range uint64(50) {
+		tree, err := New(g, Config{Seed: seed, MaxDepth: 5, Weights: map[string]float64{"Literal": 0}}).Tree("Expr")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Expansions of Expr count towards the depth, but don't produce nodes.
+		if d := treeDepth(tree); d > 4 {
+			t.Errorf("seed %d: got depth %d for %s", seed, d, tree)
+		}
+		// With Literal weighted 0, it's only picked at the depth limit.
+		if tree.Kind() == "Literal" {
+			t.Errorf("seed %d: got Literal at the root", seed)
+		}
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	g := mustParse(t, `Program = Stmt*  Stmt = 'ident' '=' 'int' ';'`)
+	cfg := Config{
+		Seed:    42,
+		RepProb: 0.9,
+		TokenText: func(value string, rng *rand.Rand) string {
+			switch value {
+			case "ident":
+				return fmt.Sprintf("x%d", rng.IntN(100))
+			case "int":
+				return fmt.Sprint(rng.IntN(100))
+			}
+			return value
+		},
+	}
+	toks1, err := New(g, cfg).Tokens("Program")
+	if err != nil {
+		t.Fatal(err)
+	}
+	toks2, _ := New(g, cfg).Tokens("Program")
+	if Join(toks1) != Join(toks2) {
+		t.Errorf("different output for the same seed: %q and %q", Join(toks1), Join(toks2))
+	}
+	if len(toks1) == 0 || len(toks1)%4 != 0 || len(toks1) > 20 {
+		t.Errorf("got %d tokens, want a multiple of 4 up to 20: %q", len(toks1), Join(toks1))
+	}
+	for i, tok := range toks1 {
+		if i%4 == 0 && (tok.Kind != "ident" || !strings.HasPrefix(tok.Text, "x")) {
+			t.Errorf("got token %+v, want an identifier", tok)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	g := mustParse(t, `a = b  b = a 'x'  c = 'c' | a`)
+	gen := New(g, Config{})
+	if _, err := gen.Tree("a"); err == nil || err.Error() != "rule a can't derive a finite tree" {
+		t.Errorf("got error %v", err)
+	}
+	if _, err := gen.Tree("nope"); err == nil || err.Error() != "undefined rule nope" {
+		t.Errorf("got error %v", err)
+	}
+	// Non-productive alternatives are never picked.
+	for range 10 {
+		tree, err := gen.Tree("c")
+		if err != nil || tree.Text() != "c" {
+			t.Errorf("got %v, %v", tree, err)
+		}
+	}
+}
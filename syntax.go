@@ -0,0 +1,261 @@
+// go-ungrammar: lossless syntax tree of Ungrammar source.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package ungrammar
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SyntaxKind is the kind of a SyntaxNode or SyntaxToken.
+type SyntaxKind int
+
+const (
+	// Node kinds
+	KindGrammar    SyntaxKind = iota // the whole input
+	KindDefinition                   // Name '=' Rule
+	KindAlt                          // Rule '|' Rule ...
+	KindSeq                          // Rule Rule ...
+	KindOpt                          // Rule '?'
+	KindRep                          // Rule '*'
+	KindLabeled                      // label ':' Rule
+	KindNode                         // reference to a named rule
+	KindToken                        // 'token'
+	KindParen                        // '(' Rule ')'
+	KindError                        // input skipped by the parser due to errors
+
+	// Token kinds
+	KindWhitespace
+	KindComment
+	KindIdent   // rule names and labels
+	KindLiteral // quoted token literals
+	KindEq
+	KindStar
+	KindPipe
+	KindQmark
+	KindColon
+	KindLParen
+	KindRParen
+	KindBadToken // input the lexer could not tokenize
+)
+
+var syntaxKindNames = [...]string{
+	KindGrammar:    "Grammar",
+	KindDefinition: "Definition",
+	KindAlt:        "Alt",
+	KindSeq:        "Seq",
+	KindOpt:        "Opt",
+	KindRep:        "Rep",
+	KindLabeled:    "Labeled",
+	KindNode:       "Node",
+	KindToken:      "Token",
+	KindParen:      "Paren",
+	KindError:      "Error",
+
+	KindWhitespace: "Whitespace",
+	KindComment:    "Comment",
+	KindIdent:      "Ident",
+	KindLiteral:    "Literal",
+	KindEq:         "Eq",
+	KindStar:       "Star",
+	KindPipe:       "Pipe",
+	KindQmark:      "Qmark",
+	KindColon:      "Colon",
+	KindLParen:     "LParen",
+	KindRParen:     "RParen",
+	KindBadToken:   "BadToken",
+}
+
+func (k SyntaxKind) String() string {
+	if k >= 0 && int(k) < len(syntaxKindNames) {
+		return syntaxKindNames[k]
+	}
+	return fmt.Sprintf("SyntaxKind(%d)", int(k))
+}
+
+// IsTrivia reports whether k is the kind of a whitespace or comment token.
+func (k SyntaxKind) IsTrivia() bool {
+	return k == KindWhitespace || k == KindComment
+}
+
+// tokenKinds maps the lexer's token names to the kinds of syntax tokens.
+var tokenKinds = [...]SyntaxKind{
+	ERROR:      KindBadToken,
+	WHITESPACE: KindWhitespace,
+	COMMENT:    KindComment,
+	NODE:       KindIdent,
+	TOKEN:      KindLiteral,
+	EQ:         KindEq,
+	STAR:       KindStar,
+	PIPE:       KindPipe,
+	QMARK:      KindQmark,
+	COLON:      KindColon,
+	LPAREN:     KindLParen,
+	RPAREN:     KindRParen,
+}
+
+// SyntaxElement is either a *SyntaxNode or a *SyntaxToken.
+type SyntaxElement interface {
+	Kind() SyntaxKind
+	Span() Span
+
+	// Text returns the exact source text of the element.
+	Text() string
+}
+
+// SyntaxNode is an interior node of a lossless syntax tree, produced by
+// Parser.ParseSyntaxTree. Unlike Rule trees, syntax trees represent every
+// byte of the input, including whitespace, comments and parentheses;
+// concatenating the text of all the tokens in a tree reproduces the input
+// exactly.
+type SyntaxNode struct {
+	kind     SyntaxKind
+	children []SyntaxElement
+	span     Span
+}
+
+// SyntaxToken is a leaf of a lossless syntax tree.
+type SyntaxToken struct {
+	kind SyntaxKind
+	text string
+	span Span
+}
+
+func (n *SyntaxNode) Kind() SyntaxKind {
+	return n.kind
+}
+
+func (n *SyntaxNode) Span() Span {
+	return n.span
+}
+
+// Children returns the child nodes and tokens of n, in source order.
+func (n *SyntaxNode) Children() []SyntaxElement {
+	return n.children
+}
+
+func (n *SyntaxNode) Text() string {
+	var sb strings.Builder
+	for _, tok := range n.Tokens() {
+		sb.WriteString(tok.text)
+	}
+	return sb.String()
+}
+
+// Tokens returns all the tokens in the subtree rooted at n, in source order.
+func (n *SyntaxNode) Tokens() []*SyntaxToken {
+	var toks []*SyntaxToken
+	var collect func(n *SyntaxNode)
+	collect = func(n *SyntaxNode) {
+		for _, c := range n.children {
+			switch cc := c.(type) {
+			case *SyntaxNode:
+				collect(cc)
+			case *SyntaxToken:
+				toks = append(toks, cc)
+			}
+		}
+	}
+	collect(n)
+	return toks
+}
+
+// String returns a debug representation of the subtree rooted at n, omitting
+// trivia. For example, the input "x = a?" produces:
+//
+//	Grammar(Definition(Ident"x" Eq"=" Opt(Node(Ident"a") Qmark"?")))
+func (n *SyntaxNode) String() string {
+	var parts []string
+	for _, c := range n.children {
+		if c.Kind().IsTrivia() {
+			continue
+		}
+		parts = append(parts, fmt.Sprint(c))
+	}
+	return fmt.Sprintf("%s(%s)", n.kind, strings.Join(parts, " "))
+}
+
+func (t *SyntaxToken) Kind() SyntaxKind {
+	return t.kind
+}
+
+func (t *SyntaxToken) Span() Span {
+	return t.span
+}
+
+func (t *SyntaxToken) Text() string {
+	return t.text
+}
+
+func (t *SyntaxToken) String() string {
+	return fmt.Sprintf("%s%q", t.kind, t.text)
+}
+
+// syntaxBuilder builds a syntax tree bottom-up while the parser runs. Nodes
+// are opened with startNode (or startNodeAt, to wrap previously added
+// children) and closed with finishNode; tokens are added to the innermost open
+// node.
+type syntaxBuilder struct {
+	buf   string
+	stack []*SyntaxNode
+}
+
+func (b *syntaxBuilder) top() *SyntaxNode {
+	return b.stack[len(b.stack)-1]
+}
+
+func (b *syntaxBuilder) startNode(kind SyntaxKind) {
+	b.stack = append(b.stack, &SyntaxNode{kind: kind})
+}
+
+// checkpoint returns a value that can later be passed to startNodeAt.
+func (b *syntaxBuilder) checkpoint() int {
+	return len(b.top().children)
+}
+
+// startNodeAt starts a new node that wraps all the children added to the
+// innermost open node since checkpoint cp was taken.
+func (b *syntaxBuilder) startNodeAt(cp int, kind SyntaxKind) {
+	parent := b.top()
+	node := &SyntaxNode{kind: kind}
+	node.children = append(node.children, parent.children[cp:]...)
+	parent.children = parent.children[:cp]
+	b.stack = append(b.stack, node)
+}
+
+// finishNode closes the innermost open node and returns it.
+func (b *syntaxBuilder) finishNode() *SyntaxNode {
+	node := b.top()
+	b.stack = b.stack[:len(b.stack)-1]
+	if len(node.children) > 0 {
+		node.span = Span{
+			Start: node.children[0].Span().Start,
+			End:   node.children[len(node.children)-1].Span().End,
+		}
+	}
+	if len(b.stack) > 0 {
+		parent := b.top()
+		parent.children = append(parent.children, node)
+	}
+	return node
+}
+
+// token adds tok and its leading trivia to the innermost open node.
+func (b *syntaxBuilder) token(tok token) {
+	for _, t := range tok.leading {
+		b.addToken(t)
+	}
+	b.addToken(tok)
+}
+
+func (b *syntaxBuilder) addToken(tok token) {
+	node := b.top()
+	node.children = append(node.children, &SyntaxToken{
+		kind: tokenKinds[tok.name],
+		text: b.buf[tok.span.Start.Offset:tok.span.End.Offset],
+		span: tok.span,
+	})
+}
@@ -0,0 +1,82 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package ungrammar
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSyntaxTree(t *testing.T) {
+	var tests = []struct {
+		input    string
+		wantTree string
+	}{
+		{`x = a?`, `Grammar(Definition(Ident"x" Eq"=" Opt(Node(Ident"a") Qmark"?")))`},
+		{`x = 'a' | b*`, `Grammar(Definition(Ident"x" Eq"=" Alt(Token(Literal"'a'") Pipe"|" Rep(Node(Ident"b") Star"*"))))`},
+		{`x = l:(a b) // c`, `Grammar(Definition(Ident"x" Eq"=" Labeled(Ident"l" Colon":" Paren(LParen"(" Seq(Node(Ident"a") Node(Ident"b")) RParen")"))))`},
+		{`x = a y = b`, `Grammar(Definition(Ident"x" Eq"=" Node(Ident"a")) Definition(Ident"y" Eq"=" Node(Ident"b")))`},
+
+		// Errors
+		{`foo bar`, `Grammar(Error(Ident"foo" Ident"bar"))`},
+		{`x = a @ y = b`, `Grammar(Definition(Ident"x" Eq"=" Node(Ident"a") Error(BadToken"@")) Definition(Ident"y" Eq"=" Node(Ident"b")))`},
+		{`x = ( a`, `Grammar(Definition(Ident"x" Eq"=" Paren(LParen"(" Node(Ident"a"))))`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			p := NewParser(tt.input)
+			tree, _ := p.ParseSyntaxTree()
+			if got := tree.String(); got != tt.wantTree {
+				t.Errorf("got tree  %v\nwant tree %v", got, tt.wantTree)
+			}
+			if got := tree.Text(); got != tt.input {
+				t.Errorf("got text %q, want %q", got, tt.input)
+			}
+		})
+	}
+}
+
+// Check that syntax trees reproduce their input exactly, that the spans of
+// nodes match their text, and that the same errors are reported as with
+// ParseGrammar.
+func TestSyntaxTreeRoundTrip(t *testing.T) {
+	inputs := []string{
+		readFileOrPanic(filepath.Join("testdata", "ungrammar.ungrammar")),
+		readFileOrPanic(filepath.Join("testdata", "exprlang.ungrammar")),
+		readFileOrPanic(filepath.Join("testdata", "rust.ungrammar")),
+		"",
+		"  // just a comment\n",
+		"x = a | | b\n",
+		"x = a b 'two   y = t",
+		"\nfoo = @\nbar = ( joe\nx = y",
+	}
+
+	for _, input := range inputs {
+		_, wantErr := NewParser(input).ParseGrammar()
+		tree, err := NewParser(input).ParseSyntaxTree()
+
+		if (err == nil) != (wantErr == nil) || (err != nil && err.Error() != wantErr.Error()) {
+			t.Errorf("got error %v, want %v", err, wantErr)
+		}
+
+		if got := tree.Text(); got != input {
+			t.Errorf("round trip mismatch: got %q, want %q", got, input)
+		}
+
+		var check func(n *SyntaxNode)
+		check = func(n *SyntaxNode) {
+			sp := n.Span()
+			if text := input[sp.Start.Offset:sp.End.Offset]; text != n.Text() {
+				t.Errorf("%v node at %v: span text %q != node text %q", n.Kind(), sp, text, n.Text())
+			}
+			for _, c := range n.Children() {
+				if cn, ok := c.(*SyntaxNode); ok {
+					check(cn)
+				}
+			}
+		}
+		check(tree)
+	}
+}
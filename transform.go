@@ -0,0 +1,222 @@
+// go-ungrammar: grammar transformations.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package ungrammar
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// Clone returns a deep copy of g.
+func (g *Grammar) Clone() *Grammar {
+	rules := make(map[string]Rule, len(g.Rules))
+	for name, r := range g.Rules {
+		rules[name] = Clone(r)
+	}
+	return &Grammar{
+		Rules:   rules,
+		Names:   slices.Clone(g.Names),
+		NameLoc: maps.Clone(g.NameLoc),
+		Docs:    maps.Clone(g.Docs),
+		Doc:     g.Doc,
+	}
+}
+
+// Rewrite returns a copy of g with the rule tree of every rule rewritten by
+// Apply(rule, pre, post), in the order of g.OrderedNames; g isn't modified.
+// Cursor.Name returns the name of the rule being rewritten. If post
+// terminates the traversal of a rule, Rewrite stops and the remaining rules
+// are left unchanged.
+func (g *Grammar) Rewrite(pre, post ApplyFunc) *Grammar {
+	ng := g.Clone()
+	for _, name := range ng.OrderedNames() {
+		r, aborted := applyNamed(name, ng.Rules[name], pre, post)
+		ng.Rules[name] = r
+		if aborted {
+			break
+		}
+	}
+	return ng
+}
+
+// Inline returns a copy of g with every reference to the rule name replaced
+// by (a copy of) the rule's definition, and the rule itself removed. It
+// returns an error if name isn't defined, or if it refers to itself.
+//
+// For example, inlining Op in:
+//
+//	BinExpr = Expr Op Expr
+//	Op = '+' | '-'
+//
+// produces:
+//
+//	BinExpr = Expr ('+' | '-') Expr
+func (g *Grammar) Inline(name string) (*Grammar, error) {
+	body, ok := g.Rules[name]
+	if !ok {
+		return nil, fmt.Errorf("undefined rule %s", name)
+	}
+	for _, node := range nodeRefs(body) {
+		if node.Name == name {
+			return nil, fmt.Errorf("%s: rule %s refers to itself", node.Location(), name)
+		}
+	}
+
+	ng := g.Rewrite(func(c *Cursor) bool {
+		if node, ok := c.Rule().(*Node); ok && node.Name == name {
+			c.Replace(Clone(body))
+			return false
+		}
+		return true
+	}, nil)
+	ng.remove(name)
+	return ng, nil
+}
+
+// remove removes the rule name from g.
+func (g *Grammar) remove(name string) {
+	delete(g.Rules, name)
+	delete(g.NameLoc, name)
+	delete(g.Docs, name)
+	g.Names = slices.DeleteFunc(g.Names, func(n string) bool { return n == name })
+}
+
+// Flatten returns a copy of g with nested rules simplified where that doesn't
+// change the grammar: sequences directly nested in sequences, and
+// alternations directly nested in alternations, are merged into their
+// parents, and sequences or alternations of a single rule (which can result
+// from deleting rules with a Cursor) are replaced by that rule. Rules left
+// empty by such deletions (sequences and alternations of no rules, and
+// labels, '?' and '*' of them) are dropped from their sequences and
+// alternations. For example, "a (b c) d" becomes "a b c d", and "a | (b | c)"
+// becomes "a | b | c".
+//
+// Doc comments of merged alternatives are kept; an alternative's doc is moved
+// to the first alternative of a nested alternation merged in its place.
+func (g *Grammar) Flatten() *Grammar {
+	return g.Rewrite(nil, func(c *Cursor) bool {
+		switch r := c.Rule().(type) {
+		case *Seq:
+			var rules []Rule
+			for _, sub := range r.Rules {
+				if seq, ok := sub.(*Seq); ok {
+					rules = append(rules, seq.Rules...)
+				} else {
+					rules = append(rules, sub)
+				}
+			}
+			r.Rules = rules
+			if len(r.Rules) == 1 {
+				c.Replace(r.Rules[0])
+			}
+		case *Alt:
+			var rules []Rule
+			var docs []string
+			hasDocs := false
+			for i, sub := range r.Rules {
+				doc := ""
+				if i < len(r.Docs) {
+					doc = r.Docs[i]
+				}
+				if alt, ok := sub.(*Alt); ok {
+					for j, inner := range alt.Rules {
+						innerDoc := ""
+						if j < len(alt.Docs) {
+							innerDoc = alt.Docs[j]
+						}
+						if j == 0 && innerDoc == "" {
+							innerDoc = doc
+						}
+						rules = append(rules, inner)
+						docs = append(docs, innerDoc)
+						hasDocs = hasDocs || innerDoc != ""
+					}
+				} else {
+					rules = append(rules, sub)
+					docs = append(docs, doc)
+					hasDocs = hasDocs || doc != ""
+				}
+			}
+			r.Rules = rules
+			r.Docs = nil
+			if hasDocs {
+				r.Docs = docs
+			}
+			if len(r.Rules) == 1 {
+				c.Replace(r.Rules[0])
+			}
+		}
+		if isEmpty(c.Rule()) && c.Index() >= 0 {
+			c.Delete()
+		}
+		return true
+	})
+}
+
+// isEmpty reports whether r is a sequence or alternation of no rules, or a
+// label, '?' or '*' of one.
+func isEmpty(r Rule) bool {
+	switch r := r.(type) {
+	case *Seq:
+		return len(r.Rules) == 0
+	case *Alt:
+		return len(r.Rules) == 0
+	case *Labeled:
+		return isEmpty(r.Rule)
+	case *Opt:
+		return isEmpty(r.Rule)
+	case *Rep:
+		return isEmpty(r.Rule)
+	}
+	return false
+}
+
+// RemoveLabels returns a copy of g with all labels removed: every Labeled
+// rule is replaced by the rule it labels. Labels of missing (nil) rules, as
+// found in grammars with syntax errors, are kept.
+func (g *Grammar) RemoveLabels() *Grammar {
+	return g.Rewrite(nil, func(c *Cursor) bool {
+		if lbl, ok := c.Rule().(*Labeled); ok && lbl.Rule != nil {
+			c.Replace(lbl.Rule)
+		}
+		return true
+	})
+}
+
+// Rename returns a copy of g with the rule oldName renamed to newName, along
+// with all the references to it. It returns an error if oldName isn't
+// defined or newName is.
+func (g *Grammar) Rename(oldName, newName string) (*Grammar, error) {
+	if _, ok := g.Rules[oldName]; !ok {
+		return nil, fmt.Errorf("undefined rule %s", oldName)
+	}
+	if _, ok := g.Rules[newName]; ok {
+		return nil, fmt.Errorf("rule %s already defined", newName)
+	}
+
+	ng := g.Rewrite(func(c *Cursor) bool {
+		if node, ok := c.Rule().(*Node); ok && node.Name == oldName {
+			node.Name = newName
+		}
+		return true
+	}, nil)
+
+	ng.Rules[newName] = ng.Rules[oldName]
+	if loc, ok := ng.NameLoc[oldName]; ok {
+		ng.NameLoc[newName] = loc
+	}
+	if doc, ok := ng.Docs[oldName]; ok {
+		ng.Docs[newName] = doc
+	}
+	if i := slices.Index(ng.Names, oldName); i >= 0 {
+		ng.Names[i] = newName
+	}
+	delete(ng.Rules, oldName)
+	delete(ng.NameLoc, oldName)
+	delete(ng.Docs, oldName)
+	return ng, nil
+}
@@ -0,0 +1,191 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package ungrammar
+
+import (
+	"strings"
+	"testing"
+)
+
+func mustFormat(t *testing.T, g *Grammar) string {
+	t.Helper()
+	var sb strings.Builder
+	if err := g.Format(&sb); err != nil {
+		t.Fatal(err)
+	}
+	return sb.String()
+}
+
+func TestInline(t *testing.T) {
+	const input = `BinExpr = lhs:Expr op:Op rhs:Expr
+Expr = 'int' | Op Expr
+Op = '+' | '-'
+`
+	g, err := NewParser(input).ParseGrammar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ng, err := g.Inline("Op")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `BinExpr =
+  lhs:Expr op:('+' | '-') rhs:Expr
+
+Expr =
+  'int'
+| ('+' | '-') Expr
+`
+	if got := mustFormat(t, ng); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if _, ok := ng.NameLoc["Op"]; ok {
+		t.Errorf("Op still in NameLoc")
+	}
+
+	// g is unchanged.
+	if got := mustFormat(t, g); !strings.Contains(got, "op:Op") {
+		t.Errorf("original grammar modified:\n%s", got)
+	}
+
+	if _, err := g.Inline("Expr"); err == nil || err.Error() != "2:19: rule Expr refers to itself" {
+		t.Errorf("got error %v", err)
+	}
+	if _, err := g.Inline("Nope"); err == nil {
+		t.Errorf("got no error inlining undefined rule")
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  string
+	}{
+		{`x = a (b c) d`, "x =\n  a b c d\n"},
+		{`x = a (b (c d))`, "x =\n  a b c d\n"},
+		{`x = a | (b | c)`, "x =\n  a\n| b\n| c\n"},
+		{`x = (a b)*`, "x =\n  (a b)*\n"},
+		{`x = l:(a b) c`, "x =\n  l:(a b) c\n"},
+		{
+			"x =\n  a\n  // doc bc\n| (b | c)\n",
+			"x =\n  a\n  // doc bc\n| b\n| c\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			g, err := NewParser(tt.input).ParseGrammar()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := mustFormat(t, g.Flatten()); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+// Rules emptied by deletions are dropped, so the result can be formatted.
+func TestFlattenDeleted(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  string
+	}{
+		{`x = a (b c)? | d`, "x =\n  a\n| d\n"},
+		{`x = (b c) | d`, "x =\n  d\n"},
+		{`x = a l:(b | c)* d`, "x =\n  a d\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			g, err := NewParser(tt.input).ParseGrammar()
+			if err != nil {
+				t.Fatal(err)
+			}
+			g = g.Rewrite(func(c *Cursor) bool {
+				if node, ok := c.Rule().(*Node); ok && (node.Name == "b" || node.Name == "c") {
+					c.Delete()
+				}
+				return true
+			}, nil)
+			if got := mustFormat(t, g.Flatten()); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoveLabels(t *testing.T) {
+	g, err := NewParser(`x = lhs:a op:('+' | '-') rhs:a?`).ParseGrammar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := mustFormat(t, g.RemoveLabels()), "x =\n  a ('+' | '-') a?\n"; got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Labels of rules missing due to syntax errors are kept.
+	g, _ = NewParser("x = a l:\ny = b").ParseGrammar()
+	seq := g.RemoveLabels().Rules["x"].(*Seq)
+	if lbl, ok := seq.Rules[1].(*Labeled); !ok || lbl.Label != "l" || lbl.Rule != nil {
+		t.Errorf("got rule %v, want label of nil rule", seq.Rules[1])
+	}
+}
+
+func TestRename(t *testing.T) {
+	const input = `// The program.
+Program = Stmt*
+
+// A statement.
+Stmt = 'let' | Stmt ';'
+`
+	g, err := NewParser(input).ParseGrammar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ng, err := g.Rename("Stmt", "Statement")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `// The program.
+Program =
+  Statement*
+
+// A statement.
+Statement =
+  'let'
+| Statement ';'
+`
+	if got := mustFormat(t, ng); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if got := ng.NameLoc["Statement"].String(); got != "5:1" {
+		t.Errorf("got location %s, want 5:1", got)
+	}
+
+	if _, err := g.Rename("Stmt", "Program"); err == nil {
+		t.Errorf("got no error renaming to existing rule")
+	}
+	if _, err := g.Rename("Nope", "Other"); err == nil {
+		t.Errorf("got no error renaming undefined rule")
+	}
+}
+
+func TestRewriteName(t *testing.T) {
+	g, err := NewParser(`x = a y = b`).ParseGrammar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ng := g.Rewrite(func(c *Cursor) bool {
+		if n, ok := c.Rule().(*Node); ok {
+			n.Name = c.Name() + "_" + n.Name
+		}
+		return true
+	}, nil)
+	if got, want := ng.String(), "x: x_a\ny: y_b\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -9,6 +9,7 @@ package ungrammar
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
@@ -22,88 +23,179 @@ type Grammar struct {
 	// Rules maps ruleName --> Rule
 	Rules map[string]Rule
 
+	// Names lists the rule names in the order in which they're defined in the
+	// input. If a name is defined more than once, it appears here only once,
+	// in the position of its last definition; Rules, NameLoc and Docs hold the
+	// last definition too.
+	Names []string
+
 	// NameLoc maps ruleName --> its location in the input, for accurate error
 	// reporting. Rules carry their own locations, but since names are just
 	// strings, locations are kept here.
-	NameLoc map[string]location
+	NameLoc map[string]Pos
+
+	// Docs maps ruleName --> the doc comment of its definition. A doc comment
+	// is a group of comments on consecutive lines that immediately precedes
+	// the rule's name; the comment markers are stripped (see Labeled for an
+	// example). Rules without a doc comment have no entry in the map.
+	Docs map[string]string
+
+	// Doc is the first comment group of the input, if it isn't the doc comment
+	// of the first rule (e.g. because it's followed by an empty line).
+	Doc string
 }
 
 // Rule is the interface defining an Ungrammar CST subtree. At runtime, a value
 // implemeting the Rule interface will have a concrete type which is one of the
 // exported types in this file.
 type Rule interface {
-	Location() location
+	// Location returns the position where the rule starts in the input; it's
+	// the same as Span().Start. For Seq, Alt, Opt and Rep rules without a span
+	// (e.g. built by Rewrite), it's the location of their first sub-rule.
+	Location() Pos
+
+	// Span returns the full range of input the rule was parsed from, including
+	// quantifiers, labels and (for Seq and Alt) enclosing parentheses. A
+	// parenthesized Node, Token or Labeled like "(A)" has no node of its own,
+	// so its span doesn't include the parentheses. Rules that weren't created
+	// by a Parser have a zero Span.
+	Span() Span
+
 	String() string
 }
 
+// Labeled is a rule with a label, like "lhs:Expr".
+//
+// Doc holds the doc comment immediately preceding the label, if any. For
+// example, the following has "the left operand" as the doc of the label:
+//
+//	BinExpr =
+//	  // the left operand
+//	  lhs:Expr op:'+' rhs:Expr
+//
+// If the label starts an alternative of an Alt, the comment is the doc of the
+// alternative instead (see Alt.Docs).
 type Labeled struct {
-	Label    string
-	Rule     Rule
-	labelLoc location
+	Label string
+	Rule  Rule
+	Doc   string
+	span  Span
 }
 
 type Node struct {
-	Name    string
-	nameLoc location
+	Name string
+	span Span
 }
 
 type Token struct {
-	Value    string
-	valueLoc location
+	Value string
+	span  Span
 }
 
 type Seq struct {
 	Rules []Rule
+	span  Span
 }
 
+// Alt is an alternation of rules, like "A | B".
+//
+// Docs holds the doc comments of the alternatives: Docs[i] is the doc comment
+// preceding the alternative Rules[i] or the '|' before it. Docs is nil if no
+// alternative has a doc comment.
 type Alt struct {
 	Rules []Rule
+	Docs  []string
+	span  Span
 }
 
 type Opt struct {
 	Rule Rule
+	span Span
 }
 
 type Rep struct {
 	Rule Rule
+	span Span
 }
 
 // Location methods
 
-func (seq *Seq) Location() location {
-	return seq.Rules[0].Location()
+func (seq *Seq) Location() Pos {
+	if !seq.span.Start.IsValid() && len(seq.Rules) > 0 && seq.Rules[0] != nil {
+		return seq.Rules[0].Location()
+	}
+	return seq.span.Start
+}
+
+func (tok *Token) Location() Pos {
+	return tok.span.Start
+}
+
+func (node *Node) Location() Pos {
+	return node.span.Start
+}
+
+func (alt *Alt) Location() Pos {
+	if !alt.span.Start.IsValid() && len(alt.Rules) > 0 && alt.Rules[0] != nil {
+		return alt.Rules[0].Location()
+	}
+	return alt.span.Start
+}
+
+func (lbl *Labeled) Location() Pos {
+	return lbl.span.Start
+}
+
+func (opt *Opt) Location() Pos {
+	if !opt.span.Start.IsValid() && opt.Rule != nil {
+		return opt.Rule.Location()
+	}
+	return opt.span.Start
+}
+
+func (rep *Rep) Location() Pos {
+	if !rep.span.Start.IsValid() && rep.Rule != nil {
+		return rep.Rule.Location()
+	}
+	return rep.span.Start
+}
+
+// Span methods
+
+func (seq *Seq) Span() Span {
+	return seq.span
 }
 
-func (tok *Token) Location() location {
-	return tok.valueLoc
+func (tok *Token) Span() Span {
+	return tok.span
 }
 
-func (node *Node) Location() location {
-	return node.nameLoc
+func (node *Node) Span() Span {
+	return node.span
 }
 
-func (alt *Alt) Location() location {
-	return alt.Rules[0].Location()
+func (alt *Alt) Span() Span {
+	return alt.span
 }
 
-func (lbl *Labeled) Location() location {
-	return lbl.labelLoc
+func (lbl *Labeled) Span() Span {
+	return lbl.span
 }
 
-func (opt *Opt) Location() location {
-	return opt.Rule.Location()
+func (opt *Opt) Span() Span {
+	return opt.span
 }
 
-func (rep *Rep) Location() location {
-	return rep.Rule.Location()
+func (rep *Rep) Span() Span {
+	return rep.span
 }
 
 // String methods
 
 func (g *Grammar) String() string {
 	var sb strings.Builder
-	for name, rule := range g.Rules {
-		fmt.Fprintf(&sb, "%s: %s\n", name, ruleString(rule))
+	for _, name := range g.OrderedNames() {
+		fmt.Fprintf(&sb, "%s: %s\n", name, ruleString(g.Rules[name]))
 	}
 	return sb.String()
 }
@@ -152,3 +244,27 @@ func ruleString(r Rule) string {
 		return r.String()
 	}
 }
+
+// OrderedNames returns the names of all the rules in g in a deterministic
+// order: first the names listed in g.Names, followed by the names of any rules
+// missing from g.Names (e.g. because g was constructed without a Parser) in
+// sorted order. Names listed in g.Names without a rule in g.Rules are
+// skipped.
+func (g *Grammar) OrderedNames() []string {
+	listed := make(map[string]bool, len(g.Names))
+	var names []string
+	for _, name := range g.Names {
+		listed[name] = true
+		if _, ok := g.Rules[name]; ok {
+			names = append(names, name)
+		}
+	}
+	var rest []string
+	for name := range g.Rules {
+		if !listed[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	return append(names, rest...)
+}
@@ -0,0 +1,153 @@
+// go-ungrammar: semantic validation of grammars.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package ungrammar
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Validate checks g for semantic errors that the parser doesn't detect, and
+// returns them in an ErrorList (or nil if there are none). It reports:
+//
+//   - References to undefined rules (Node names that aren't in g.Rules).
+//   - Unused rules: rules not referenced by any other rule. Roots are exempt;
+//     note that without roots, the entry rules of the grammar (e.g. a
+//     "SourceFile" rule) are reported as unused.
+//   - If roots are provided: rules that can't be reached from any of them.
+//
+// The returned ErrorList holds a Diagnostic for each problem. References to
+// undefined rules are errors (CodeUndefinedRule) reported at the referencing
+// Node, with a suggested fix if a defined rule has a similar name. Unused and
+// unreachable rules are warnings (CodeUnusedRule, CodeUnreachableRule)
+// reported at the rule's name (from g.NameLoc).
+func (g *Grammar) Validate(roots ...string) error {
+	var errs ErrorList
+	emit := func(sev Severity, code Code, span Span, format string, args ...any) *Diagnostic {
+		d := &Diagnostic{
+			Severity: sev,
+			Code:     code,
+			Span:     span,
+			Message:  fmt.Sprintf(format, args...),
+		}
+		errs.Add(d)
+		return d
+	}
+
+	// refs maps each rule name to the names of the other rules it references.
+	names := g.OrderedNames()
+	refs := make(map[string][]string)
+	usedBy := make(map[string]bool)
+	for _, name := range names {
+		for _, node := range nodeRefs(g.Rules[name]) {
+			if _, ok := g.Rules[node.Name]; !ok {
+				d := emit(SeverityError, CodeUndefinedRule, node.Span(), "undefined rule %s", node.Name)
+				if similar := closestName(node.Name, names); similar != "" {
+					d.Fixes = []Fix{{
+						Message: fmt.Sprintf("replace with %s", similar),
+						Edits:   []TextEdit{{Span: node.Span(), NewText: similar}},
+					}}
+				}
+				continue
+			}
+			if node.Name != name {
+				refs[name] = append(refs[name], node.Name)
+				usedBy[node.Name] = true
+			}
+		}
+	}
+
+	isRoot := make(map[string]bool)
+	for _, root := range roots {
+		if _, ok := g.Rules[root]; !ok {
+			emit(SeverityError, CodeUndefinedRoot, Span{}, "undefined root rule %s", root)
+		}
+		isRoot[root] = true
+	}
+
+	reachable := make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		if reachable[name] {
+			return
+		}
+		reachable[name] = true
+		for _, ref := range refs[name] {
+			visit(ref)
+		}
+	}
+	for _, root := range roots {
+		if _, ok := g.Rules[root]; ok {
+			visit(root)
+		}
+	}
+
+	for _, name := range names {
+		switch {
+		case isRoot[name]:
+		case !usedBy[name]:
+			emit(SeverityWarning, CodeUnusedRule, nameSpan(name, g.NameLoc[name]), "rule %s is unused", name)
+		case len(roots) > 0 && !reachable[name]:
+			emit(SeverityWarning, CodeUnreachableRule, nameSpan(name, g.NameLoc[name]),
+				"rule %s is unreachable from %s", name, strings.Join(roots, ", "))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// nodeRefs returns all the Node rules in the rule tree r, in source order.
+func nodeRefs(r Rule) []*Node {
+	if r == nil {
+		return nil
+	}
+	var nodes []*Node
+	Inspect(r, func(r Rule) bool {
+		if node, ok := r.(*Node); ok {
+			nodes = append(nodes, node)
+		}
+		return true
+	})
+	return nodes
+}
+
+// closestName returns the name in names closest to name by edit distance, if
+// it's close enough to be a plausible misspelling; otherwise it returns "".
+func closestName(name string, names []string) string {
+	best := ""
+	bestDist := len(name)/3 + 1
+	for _, candidate := range names {
+		if d := editDistance(strings.ToLower(name), strings.ToLower(candidate)); d < bestDist {
+			best, bestDist = candidate, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
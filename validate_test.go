@@ -0,0 +1,74 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package ungrammar
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	var tests = []struct {
+		input      string
+		roots      []string
+		wantErrors []string
+	}{
+		{`x = a a = 't'`, []string{"x"}, nil},
+		{`x = a | b`, []string{"x"}, []string{"1:5: undefined rule a", "1:9: undefined rule b"}},
+		{`x = y? y = 't' z = y`, nil, []string{"1:1: rule x is unused", "1:16: rule z is unused"}},
+		{`x = y? y = 't' z = y`, []string{"x", "z"}, nil},
+
+		// Self-references don't count as uses.
+		{`x = 't' y = y*`, []string{"x"}, []string{"1:9: rule y is unused"}},
+
+		// Rules referencing each other, but unreachable from the root.
+		{`x = 't' y = z z = y`, []string{"x"}, []string{"1:9: rule y is unreachable from x", "1:15: rule z is unreachable from x"}},
+
+		{`x = 't'`, []string{"x", "nope"}, []string{"undefined root rule nope"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			g, err := NewParser(tt.input).ParseGrammar()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var gotErrors []string
+			if err := g.Validate(tt.roots...); err != nil {
+				for _, e := range err.(ErrorList) {
+					gotErrors = append(gotErrors, e.Error())
+				}
+			}
+			if !slices.Equal(gotErrors, tt.wantErrors) {
+				t.Errorf("errors mismatch got != want:\n%v", displaySliceDiff(gotErrors, tt.wantErrors))
+			}
+		})
+	}
+}
+
+func TestValidateTestdata(t *testing.T) {
+	var tests = []struct {
+		filename string
+		roots    []string
+	}{
+		{"ungrammar.ungrammar", []string{"Grammar"}},
+		{"exprlang.ungrammar", []string{"Program"}},
+		{"rust.ungrammar", []string{"SourceFile", "MacroItems", "Adt"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			contents := readFileOrPanic(filepath.Join("testdata", tt.filename))
+			g, err := NewParser(contents).ParseGrammar()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := g.Validate(tt.roots...); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
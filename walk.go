@@ -0,0 +1,90 @@
+// go-ungrammar: traversal of rule trees.
+//
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package ungrammar
+
+// A Visitor's Visit method is invoked for each rule encountered by Walk. If
+// the result visitor w is not nil, Walk visits each of the children of rule
+// with the visitor w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(rule Rule) (w Visitor)
+}
+
+// Walk traverses a rule tree in depth-first order, modeled on ast.Walk: it
+// starts by calling v.Visit(rule); rule must not be nil. If the visitor w
+// returned by v.Visit(rule) is not nil, Walk is invoked recursively with
+// visitor w for each of the non-nil children of rule, followed by a call of
+// w.Visit(nil).
+//
+// The children of a rule are its sub-rules in source order: the Rule of
+// Labeled, Opt and Rep, and the Rules of Seq and Alt. Node and Token have no
+// children; Walk doesn't follow Nodes to the rules they refer to. Nil
+// children, which appear in grammars parsed with errors, are skipped.
+func Walk(v Visitor, rule Rule) {
+	if v = v.Visit(rule); v == nil {
+		return
+	}
+	for _, child := range Children(rule) {
+		if child != nil {
+			Walk(v, child)
+		}
+	}
+	v.Visit(nil)
+}
+
+// Children returns the direct sub-rules of rule, in source order (see Walk).
+// The returned slice may share memory with rule and must not be modified.
+func Children(rule Rule) []Rule {
+	switch r := rule.(type) {
+	case *Labeled:
+		return []Rule{r.Rule}
+	case *Opt:
+		return []Rule{r.Rule}
+	case *Rep:
+		return []Rule{r.Rule}
+	case *Seq:
+		return r.Rules
+	case *Alt:
+		return r.Rules
+	}
+	return nil
+}
+
+type inspector func(Rule) bool
+
+func (f inspector) Visit(rule Rule) Visitor {
+	if f(rule) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses a rule tree in depth-first order, modeled on
+// ast.Inspect: it starts by calling f(rule); rule must not be nil. If f
+// returns true, Inspect invokes f recursively for each of the non-nil
+// children of rule, followed by a call of f(nil).
+func Inspect(rule Rule, f func(Rule) bool) {
+	Walk(inspector(f), rule)
+}
+
+// InspectWithPath is like Inspect, but also passes f the path from the root
+// of the traversal to rule: the ancestors of rule, outermost first, so the
+// parent of rule is path[len(path)-1]. The path is empty for the root. f
+// isn't called with nil after visiting children, and must not retain or
+// modify path.
+func InspectWithPath(rule Rule, f func(rule Rule, path []Rule) bool) {
+	var path []Rule
+	Inspect(rule, func(r Rule) bool {
+		if r == nil {
+			path = path[:len(path)-1]
+			return false
+		}
+		if !f(r, path) {
+			return false
+		}
+		path = append(path, r)
+		return true
+	})
+}
@@ -0,0 +1,127 @@
+// Eli Bendersky [https://eli.thegreenplace.net]
+// This code is in the public domain.
+
+package ungrammar
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func mustParseRule(t *testing.T, input string) Rule {
+	t.Helper()
+	g, err := NewParser("x = " + input).ParseGrammar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g.Rules["x"]
+}
+
+// traceVisitor records the rules it visits, and the nil calls marking the end
+// of their children.
+type traceVisitor struct {
+	trace *[]string
+}
+
+func (v traceVisitor) Visit(r Rule) Visitor {
+	if r == nil {
+		*v.trace = append(*v.trace, "end")
+		return nil
+	}
+	*v.trace = append(*v.trace, FormatRule(r))
+	return v
+}
+
+func TestWalk(t *testing.T) {
+	r := mustParseRule(t, `a (l:b | 'c')*`)
+	var trace []string
+	Walk(traceVisitor{&trace}, r)
+
+	want := []string{
+		"a (l:b | 'c')*",
+		"a", "end",
+		"(l:b | 'c')*",
+		"l:b | 'c'",
+		"l:b",
+		"b", "end",
+		"end",
+		"'c'", "end",
+		"end",
+		"end",
+		"end",
+	}
+	if !slices.Equal(trace, want) {
+		t.Errorf("got %q\nwant %q", trace, want)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	r := mustParseRule(t, `a (b c)? | d:e*`)
+
+	var nodes []string
+	Inspect(r, func(r Rule) bool {
+		if n, ok := r.(*Node); ok {
+			nodes = append(nodes, n.Name)
+		}
+		return true
+	})
+	if want := []string{"a", "b", "c", "e"}; !slices.Equal(nodes, want) {
+		t.Errorf("got nodes %v, want %v", nodes, want)
+	}
+
+	// Returning false prunes the traversal below a rule.
+	nodes = nil
+	Inspect(r, func(r Rule) bool {
+		if n, ok := r.(*Node); ok {
+			nodes = append(nodes, n.Name)
+		}
+		_, isOpt := r.(*Opt)
+		return !isOpt
+	})
+	if want := []string{"a", "e"}; !slices.Equal(nodes, want) {
+		t.Errorf("got nodes %v, want %v", nodes, want)
+	}
+}
+
+func TestInspectWithPath(t *testing.T) {
+	r := mustParseRule(t, `a (b c)? | d:e*`)
+
+	var got []string
+	InspectWithPath(r, func(r Rule, path []Rule) bool {
+		if n, ok := r.(*Node); ok {
+			var types []string
+			for _, p := range path {
+				types = append(types, strings.TrimPrefix(fmt.Sprintf("%T", p), "*ungrammar."))
+			}
+			got = append(got, n.Name+": "+strings.Join(types, " "))
+		}
+		return true
+	})
+
+	want := []string{
+		"a: Alt Seq",
+		"b: Alt Seq Opt Seq",
+		"c: Alt Seq Opt Seq",
+		"e: Alt Labeled Rep",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q\nwant %q", got, want)
+	}
+}
+
+func TestWalkSkipsNil(t *testing.T) {
+	g, _ := NewParser(`x = a l:`).ParseGrammar()
+	var n int
+	Inspect(g.Rules["x"], func(r Rule) bool {
+		if r != nil {
+			n++
+		}
+		return true
+	})
+	// Seq, a and the Labeled with a nil Rule.
+	if n != 3 {
+		t.Errorf("got %d rules, want 3", n)
+	}
+}